@@ -140,3 +140,38 @@ func TestEncryptFile(t *testing.T) {
         return
     }
 }
+
+func TestHmac(t *testing.T) {
+    signBase := crypts.NewEncryptionBase()
+    signBase.SetPassphrase(passphrase)
+    signature, err := signBase.SignHmac([]byte(testSentence))
+    if err != nil {
+        t.Log(err.Error())
+        t.Fail()
+        return
+    }
+
+    verifyBase := crypts.NewEncryptionBase()
+    verifyBase.SetPassphrase(passphrase)
+    isVerified, err := verifyBase.VerifyHmac([]byte(testSentence), signature)
+    if err != nil {
+        t.Log(err.Error())
+        t.Fail()
+        return
+    }
+
+    log.Printf("hmac signature \t= %s", signature)
+
+    if !isVerified {
+        t.Log("hmac signature is not verified")
+        t.Fail()
+        return
+    }
+
+    isVerified, _ = verifyBase.VerifyHmac([]byte(testSentence+"tampered"), signature)
+    if isVerified {
+        t.Log("tampered message should not be verified")
+        t.Fail()
+        return
+    }
+}
@@ -0,0 +1,35 @@
+package crypts
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/base64"
+    "fmt"
+)
+
+// SignHmac generate HMAC-SHA256 of message using passphrase as the key, ex: signing webhook payload
+func (base *EncryptionBase) SignHmac(message []byte) (signature string, err error) {
+    if len(base.passphrase) == 0 {
+        return "", fmt.Errorf("passphrase is empty, can't sign the message")
+    }
+
+    hmacHash := hmac.New(sha256.New, base.passphrase)
+    hmacHash.Write(message)
+    signatureResult := hmacHash.Sum(nil)
+
+    result := signatureResult
+    if base.encodeUrlBase64 {
+        result = []byte(base64.RawURLEncoding.EncodeToString(signatureResult))
+    }
+
+    return string(result), nil
+}
+
+func (base *EncryptionBase) VerifyHmac(message []byte, signature string) (isVerified bool, err error) {
+    expectedSignature, err := base.SignHmac(message)
+    if err != nil {
+        return false, err
+    }
+
+    return hmac.Equal([]byte(expectedSignature), []byte(signature)), nil
+}
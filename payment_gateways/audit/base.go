@@ -0,0 +1,92 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// HeaderCorrelationID header sent to payment gateway, so the request can be traced on their side
+const HeaderCorrelationID = "X-Correlation-ID"
+
+type correlationIDKey struct{}
+
+type Entry struct {
+	CorrelationID string    `json:"correlation_id"`
+	Gateway       string    `json:"gateway"`
+	Action        string    `json:"action"`
+	Identifier    string    `json:"identifier"`
+	Error         string    `json:"error,omitempty"`
+	Time          time.Time `json:"time"`
+}
+
+// Logger audit log writer, default write to standard log
+type Logger func(entry Entry)
+
+var loggerMutex sync.RWMutex
+var logger Logger = defaultLogger
+
+// SetLogger replace audit log writer, ex: save audit log to database
+func SetLogger(auditLogger Logger) {
+	loggerMutex.Lock()
+	defer loggerMutex.Unlock()
+
+	if auditLogger == nil {
+		auditLogger = defaultLogger
+	}
+
+	logger = auditLogger
+}
+
+func WithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, correlationID)
+}
+
+// GetCorrelationID return empty string if context didn't have correlation id
+func GetCorrelationID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	correlationID, _ := ctx.Value(correlationIDKey{}).(string)
+	return correlationID
+}
+
+// EnsureCorrelationID generate new correlation id if context didn't have one
+func EnsureCorrelationID(ctx context.Context) context.Context {
+	if GetCorrelationID(ctx) != "" {
+		return ctx
+	}
+
+	return WithCorrelationID(ctx, uuid.New().String())
+}
+
+// Log write audit log for every call to payment gateway
+func Log(ctx context.Context, gateway, action, identifier string, err error) {
+	entry := Entry{
+		CorrelationID: GetCorrelationID(ctx),
+		Gateway:       gateway,
+		Action:        action,
+		Identifier:    identifier,
+		Time:          time.Now(),
+	}
+
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	loggerMutex.RLock()
+	auditLogger := logger
+	loggerMutex.RUnlock()
+
+	auditLogger(entry)
+}
+
+func defaultLogger(entry Entry) {
+	entryMarshal, _ := json.Marshal(entry)
+	log.Printf("Payment gateway audit, Data := %s", string(entryMarshal))
+}
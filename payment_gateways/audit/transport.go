@@ -0,0 +1,30 @@
+package audit
+
+import (
+	"net/http"
+)
+
+// Transport add correlation id from request context to outbound payment gateway request
+type Transport struct {
+	Base http.RoundTripper
+}
+
+func NewTransport(base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &Transport{Base: base}
+}
+
+func (transport *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	correlationID := GetCorrelationID(req.Context())
+	if correlationID == "" || req.Header.Get(HeaderCorrelationID) != "" {
+		return transport.Base.RoundTrip(req)
+	}
+
+	// RoundTrip should not modify the request
+	newReq := req.Clone(req.Context())
+	newReq.Header.Set(HeaderCorrelationID, correlationID)
+	return transport.Base.RoundTrip(newReq)
+}
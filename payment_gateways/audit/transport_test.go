@@ -0,0 +1,43 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTransportCorrelationID(t *testing.T) {
+	var receivedID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedID = r.Header.Get(HeaderCorrelationID)
+	}))
+	defer server.Close()
+
+	ctx := WithCorrelationID(context.Background(), "correlation-123")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+
+	client := &http.Client{Transport: NewTransport(nil)}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fail()
+		t.Log(err.Error())
+		return
+	}
+	_ = resp.Body.Close()
+
+	if receivedID != "correlation-123" {
+		t.Fail()
+		t.Logf("expected correlation id sent to server, got [%s]", receivedID)
+		return
+	}
+
+	if req.Header.Get(HeaderCorrelationID) != "" {
+		t.Fail()
+		t.Log("original request should not be modified")
+		return
+	}
+
+	t.Log("success send correlation id")
+	return
+}
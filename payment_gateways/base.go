@@ -1,16 +1,19 @@
 package payment_gateways
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"time"
 
 	"github.com/spf13/cast"
 
+	"github.com/fari-99/go-helper/payment_gateways/audit"
 	"github.com/fari-99/go-helper/payment_gateways/flip_helpers"
 	"github.com/fari-99/go-helper/payment_gateways/ipay88_helpers"
 	ipay88Constant "github.com/fari-99/go-helper/payment_gateways/ipay88_helpers/constants"
 	"github.com/fari-99/go-helper/payment_gateways/models"
+	"github.com/fari-99/go-helper/payment_gateways/resilience"
 	"github.com/fari-99/go-helper/payment_gateways/xendit_helpers"
 	xenditConstant "github.com/fari-99/go-helper/payment_gateways/xendit_helpers/constants"
 )
@@ -51,7 +54,11 @@ func GetRandomFutureTime() *time.Time {
 	return &futureTime
 }
 
-func CreateInvoice(transactionModel models.Transactions) (*models.Invoices, error) {
+// CreateInvoice context cancellation and deadline is carried to payment gateway call,
+// correlation id is generated if context didn't have one (see audit.WithCorrelationID)
+func CreateInvoice(ctx context.Context, transactionModel models.Transactions) (*models.Invoices, error) {
+	ctx = audit.EnsureCorrelationID(ctx)
+
 	switch transactionModel.PaymentGatewayID {
 	case XenditID:
 		xenditHelpers := xendit_helpers.NewXenditHelpers(transactionModel.TransactionUuid)
@@ -62,7 +69,7 @@ func CreateInvoice(transactionModel models.Transactions) (*models.Invoices, erro
 		xenditHelpers.SetPaymentMethods(transactionModel.PaymentMethods)
 
 		xenditInvoice := xendit_helpers.NewInvoices(xenditHelpers)
-		invoiceModel, err := xenditInvoice.CreateInvoice()
+		invoiceModel, err := xenditInvoice.CreateInvoice(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -77,7 +84,7 @@ func CreateInvoice(transactionModel models.Transactions) (*models.Invoices, erro
 		ipay88Helper.SetShippingAddress(*transactionModel.TransactionShippingAddress)
 		ipay88Helper.SetTransactionCompanies(transactionModel.TransactionCompanies)
 
-		invoiceModel, err := ipay88Helper.CreatPaymentRequest()
+		invoiceModel, err := ipay88Helper.CreatPaymentRequest(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -94,7 +101,7 @@ func CreateInvoice(transactionModel models.Transactions) (*models.Invoices, erro
 		}
 
 		flipAcceptPayment := flip_helpers.NewAcceptPayments(flipData)
-		invoiceModel, err := flipAcceptPayment.CreateBill()
+		invoiceModel, err := flipAcceptPayment.CreateBill(ctx)
 		if err != nil {
 			return nil, err
 		}
@@ -105,19 +112,31 @@ func CreateInvoice(transactionModel models.Transactions) (*models.Invoices, erro
 	}
 }
 
-func GetDetails(paymentGatewayID int, identifier string) (interface{}, error) {
+func GetDetails(ctx context.Context, paymentGatewayID int, identifier string) (interface{}, error) {
+	ctx = audit.EnsureCorrelationID(ctx)
+
 	switch paymentGatewayID {
 	case XenditID:
-		xenditInvoice := xendit_helpers.NewInvoices(nil)
-		invoice, err := xenditInvoice.GetInvoiceByID(identifier)
+		xenditHelpers, err := xendit_helpers.NewXenditClientHelpers()
+		if err != nil {
+			return nil, err
+		}
+
+		xenditInvoice := xendit_helpers.NewInvoices(xenditHelpers)
+		invoice, err := xenditInvoice.GetInvoiceByID(ctx, identifier)
 		return invoice, err
 	case Ipay88ID:
 		panic("not yet available, ipay88 didn't use id, but query params to check data")
 	case FlipID:
 		flipAcceptPayment := flip_helpers.NewAcceptPayments(nil)
-		bill, err := flipAcceptPayment.GetBill(cast.ToInt64(identifier))
+		bill, err := flipAcceptPayment.GetBill(ctx, cast.ToInt64(identifier))
 		return bill, err
 	default:
 		return nil, fmt.Errorf("payment gateway not found")
 	}
 }
+
+// GetHealth circuit breaker state for every payment gateway, can be used on health check endpoint
+func GetHealth() map[string]resilience.GatewayHealth {
+	return resilience.Health()
+}
@@ -1,20 +1,26 @@
 package flip_helpers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
 	"github.com/fari-99/go-flip"
 	flipConstants "github.com/fari-99/go-flip/constants"
 	flipModel "github.com/fari-99/go-flip/models"
+	"github.com/google/uuid"
+	"github.com/spf13/cast"
 
+	"github.com/fari-99/go-helper/payment_gateways/audit"
 	"github.com/fari-99/go-helper/payment_gateways/models"
+	"github.com/fari-99/go-helper/payment_gateways/resilience"
 )
 
+// AcceptPayments go-flip didn't accept context, so context only used for timeout, cancellation and audit log
 type AcceptPayments interface {
-	CreateBill() (*models.Invoices, error)
-	GetBill(billID int64) (*flipModel.EditBillingResponse, error) // TODO: change on go-flip get bill response
-	UpdateBill(billID int64, isActive bool) (*flipModel.EditBillingResponse, error)
+	CreateBill(ctx context.Context) (*models.Invoices, error)
+	GetBill(ctx context.Context, billID int64) (*flipModel.EditBillingResponse, error) // TODO: change on go-flip get bill response
+	UpdateBill(ctx context.Context, billID int64, isActive bool) (*flipModel.EditBillingResponse, error)
 	ConfirmCallback(token string) (bool, error)
 }
 
@@ -26,7 +32,7 @@ func NewAcceptPayments(flipData *FlipData) AcceptPayments {
 	return acceptPayments{flipData}
 }
 
-func (repo acceptPayments) CreateBill() (*models.Invoices, error) {
+func (repo acceptPayments) CreateBill(ctx context.Context) (*models.Invoices, error) {
 	transactionModel := repo.flipData.TransactionModel
 	transactionUser := repo.flipData.TransactionUser
 
@@ -45,8 +51,16 @@ func (repo acceptPayments) CreateBill() (*models.Invoices, error) {
 		SenderAddress:         transactionUser.Address,
 	}
 
-	flipBase := flip.NewBaseFlip()
-	bill, idemKey, err := flipBase.CreateBill(createBillParams)
+	// same idempotency key for every attempt, so retry didn't create duplicate bill
+	idemKey := uuid.New().String()
+	gateway := resilience.GetGateway(resilience.GatewayFlip)
+	bill, err := resilience.Execute(ctx, gateway, true, func(ctx context.Context) (*flipModel.CreateBillResponse, error) {
+		flipBase := flip.NewBaseFlip().SetIdempotencyKey(idemKey)
+		bill, _, err := flipBase.CreateBill(createBillParams)
+		return bill, err
+	})
+
+	audit.Log(ctx, resilience.GatewayFlip, "create-bill", transactionModel.TransactionUuid, err)
 	if err != nil {
 		return nil, err
 	}
@@ -68,9 +82,14 @@ func (repo acceptPayments) CreateBill() (*models.Invoices, error) {
 	return &invoice, nil
 }
 
-func (repo acceptPayments) GetBill(billID int64) (*flipModel.EditBillingResponse, error) {
-	flipBase := flip.NewBaseFlip()
-	bill, err := flipBase.GetBill(billID)
+func (repo acceptPayments) GetBill(ctx context.Context, billID int64) (*flipModel.EditBillingResponse, error) {
+	gateway := resilience.GetGateway(resilience.GatewayFlip)
+	bill, err := resilience.Execute(ctx, gateway, true, func(ctx context.Context) (*flipModel.EditBillingResponse, error) {
+		flipBase := flip.NewBaseFlip()
+		return flipBase.GetBill(billID)
+	})
+
+	audit.Log(ctx, resilience.GatewayFlip, "get-bill", cast.ToString(billID), err)
 	if err != nil {
 		return nil, err
 	}
@@ -78,7 +97,7 @@ func (repo acceptPayments) GetBill(billID int64) (*flipModel.EditBillingResponse
 	return bill, nil
 }
 
-func (repo acceptPayments) UpdateBill(billID int64, isActive bool) (*flipModel.EditBillingResponse, error) {
+func (repo acceptPayments) UpdateBill(ctx context.Context, billID int64, isActive bool) (*flipModel.EditBillingResponse, error) {
 	transactionModel := repo.flipData.TransactionModel
 
 	status := flipConstants.BillStatusActive
@@ -97,8 +116,13 @@ func (repo acceptPayments) UpdateBill(billID int64, isActive bool) (*flipModel.E
 		Status:                status,
 	}
 
-	flipBase := flip.NewBaseFlip()
-	bill, err := flipBase.EditBill(billID, updateData)
+	gateway := resilience.GetGateway(resilience.GatewayFlip)
+	bill, err := resilience.Execute(ctx, gateway, true, func(ctx context.Context) (*flipModel.EditBillingResponse, error) {
+		flipBase := flip.NewBaseFlip()
+		return flipBase.EditBill(billID, updateData)
+	})
+
+	audit.Log(ctx, resilience.GatewayFlip, "update-bill", cast.ToString(billID), err)
 	if err != nil {
 		return nil, err
 	}
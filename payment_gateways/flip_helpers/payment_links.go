@@ -0,0 +1,338 @@
+package flip_helpers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fari-99/go-flip"
+	flipConstants "github.com/fari-99/go-flip/constants"
+	flipModel "github.com/fari-99/go-flip/models"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/google/uuid"
+	"github.com/spf13/cast"
+
+	"github.com/fari-99/go-helper/payment_gateways/audit"
+	"github.com/fari-99/go-helper/payment_gateways/resilience"
+)
+
+// PaymentStatusSuccessful status flip give on payment list for paid payment
+const PaymentStatusSuccessful = "SUCCESSFUL"
+
+// flip only accept fixed amount between this range
+const minBillAmount = 10000
+const maxBillAmount = 10000000
+
+const paymentPerPage = 100
+
+/*
+PaymentLinkTemplate template for reusable flip bill (type MULTIPLE), ex: recurring donation, event tickets
+
+	Fixed Amount Example
+	template := &PaymentLinkTemplate{
+		Title:      "Event Ticket",
+		Amount:     150000,
+		UsageLimit: 100, // only 100 tickets available
+	}
+
+	Open Amount Example
+	template := &PaymentLinkTemplate{
+		Title:  "Donation",
+		Amount: 0, // customer fill the amount by themselves
+	}
+*/
+type PaymentLinkTemplate struct {
+	Title                 string
+	Amount                float64    // 0 for open amount
+	ExpiredAt             *time.Time // nil for link without expiry date
+	RedirectUrl           string
+	UsageLimit            int // 0 for unlimited, flip didn't have usage limit, checked on EnforceUsageLimit
+	IsAddressRequired     bool
+	IsPhoneNumberRequired bool
+}
+
+func (model PaymentLinkTemplate) Validate() error {
+	return validation.ValidateStruct(&model,
+		validation.Field(&model.Title, validation.Required),
+		validation.Field(&model.Amount, validation.When(model.Amount != 0, validation.Min(float64(minBillAmount)), validation.Max(float64(maxBillAmount)))),
+		validation.Field(&model.UsageLimit, validation.Min(0)),
+	)
+}
+
+// IsOpenAmount true if customer can fill the amount by themselves
+func (model PaymentLinkTemplate) IsOpenAmount() bool {
+	return model.Amount == 0
+}
+
+type PaymentLinks interface {
+	CreatePaymentLink(ctx context.Context) (*flipModel.CreateBillResponse, error)
+	UpdatePaymentLink(ctx context.Context, billID int64, isActive bool) (*flipModel.EditBillingResponse, error)
+	DeactivatePaymentLink(ctx context.Context, billID int64) (*flipModel.EditBillingResponse, error)
+	GetPaymentLink(ctx context.Context, billID int64) (*flipModel.EditBillingResponse, error)
+	GetAllPaymentLinks(ctx context.Context) (*flipModel.GetAllBillingResponse, error)
+	GetPaymentLinkPayments(ctx context.Context, billID int64, params flipModel.GetPaymentRequest) (*flipModel.GetPaymentResponse, error)
+	CountSuccessfulPayments(ctx context.Context, billID int64) (int, error)
+	EnforceUsageLimit(ctx context.Context, billID int64) (bool, error)
+}
+
+type paymentLinks struct {
+	template *PaymentLinkTemplate
+}
+
+func NewPaymentLinks(template *PaymentLinkTemplate) PaymentLinks {
+	return paymentLinks{template}
+}
+
+func (repo paymentLinks) CreatePaymentLink(ctx context.Context) (*flipModel.CreateBillResponse, error) {
+	if repo.template == nil {
+		return nil, fmt.Errorf("payment link template is empty")
+	}
+
+	if err := repo.template.Validate(); err != nil {
+		return nil, err
+	}
+
+	createBillParams := flipModel.CreateBillRequest{
+		Title:                 repo.template.Title,
+		Type:                  flipConstants.BillTypeMultiple,
+		Amount:                repo.formatAmount(),
+		ExpiredDate:           repo.formatExpiredDate(),
+		RedirectUrl:           repo.template.RedirectUrl,
+		IsAddressRequired:     formatFlag(repo.template.IsAddressRequired),
+		IsPhoneNumberRequired: formatFlag(repo.template.IsPhoneNumberRequired),
+		Step:                  flipConstants.BillStepOne, // multiple use bill didn't have sender, customer input their data
+	}
+
+	// same idempotency key for every attempt, so retry didn't create duplicate payment link
+	idemKey := uuid.New().String()
+	gateway := resilience.GetGateway(resilience.GatewayFlip)
+	bill, err := resilience.Execute(ctx, gateway, true, func(ctx context.Context) (*flipModel.CreateBillResponse, error) {
+		flipBase := flip.NewBaseFlip().SetIdempotencyKey(idemKey)
+		bill, _, err := flipBase.CreateBill(createBillParams)
+		return bill, err
+	})
+
+	audit.Log(ctx, resilience.GatewayFlip, "create-payment-link", repo.template.Title, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return bill, nil
+}
+
+// UpdatePaymentLink replace every field of the payment link using the template, empty template field is sent as empty,
+// use DeactivatePaymentLink to only change the status
+func (repo paymentLinks) UpdatePaymentLink(ctx context.Context, billID int64, isActive bool) (*flipModel.EditBillingResponse, error) {
+	if repo.template == nil {
+		return nil, fmt.Errorf("payment link template is empty")
+	}
+
+	status := flipConstants.BillStatusActive
+	if !isActive {
+		status = flipConstants.BillStatusInActive
+	}
+
+	updateData := flipModel.EditBillingRequest{
+		Title:                 repo.template.Title,
+		Type:                  flipConstants.BillTypeMultiple,
+		Amount:                repo.formatAmount(),
+		ExpiredDate:           repo.formatExpiredDate(),
+		RedirectUrl:           repo.template.RedirectUrl,
+		IsAddressRequired:     formatFlag(repo.template.IsAddressRequired),
+		IsPhoneNumberRequired: formatFlag(repo.template.IsPhoneNumberRequired),
+		Status:                status,
+	}
+
+	return repo.editPaymentLink(ctx, "update-payment-link", billID, updateData)
+}
+
+// DeactivatePaymentLink keep the current payment link data and only change the status to inactive, template is not used
+func (repo paymentLinks) DeactivatePaymentLink(ctx context.Context, billID int64) (*flipModel.EditBillingResponse, error) {
+	current, err := repo.GetPaymentLink(ctx, billID)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.editPaymentLink(ctx, "deactivate-payment-link", billID, getDeactivateRequest(current))
+}
+
+// getDeactivateRequest edit request using current payment link data, flip replace every field on edit
+func getDeactivateRequest(current *flipModel.EditBillingResponse) flipModel.EditBillingRequest {
+	updateData := flipModel.EditBillingRequest{
+		Title:                 current.Title,
+		Type:                  current.Type,
+		RedirectUrl:           current.RedirectUrl,
+		IsAddressRequired:     formatFlag(current.IsAddressRequired == 1),
+		IsPhoneNumberRequired: formatFlag(current.IsPhoneNumberRequired == 1),
+		Status:                flipConstants.BillStatusInActive,
+	}
+
+	if current.Amount > 0 {
+		updateData.Amount = cast.ToString(current.Amount)
+	}
+
+	if current.ExpiredDate != nil {
+		updateData.ExpiredDate = *current.ExpiredDate
+	}
+
+	return updateData
+}
+
+func (repo paymentLinks) editPaymentLink(ctx context.Context, action string, billID int64, updateData flipModel.EditBillingRequest) (*flipModel.EditBillingResponse, error) {
+	gateway := resilience.GetGateway(resilience.GatewayFlip)
+	bill, err := resilience.Execute(ctx, gateway, true, func(ctx context.Context) (*flipModel.EditBillingResponse, error) {
+		flipBase := flip.NewBaseFlip()
+		return flipBase.EditBill(billID, updateData)
+	})
+
+	audit.Log(ctx, resilience.GatewayFlip, action, cast.ToString(billID), err)
+	if err != nil {
+		return nil, err
+	}
+
+	return bill, nil
+}
+
+func (repo paymentLinks) GetPaymentLink(ctx context.Context, billID int64) (*flipModel.EditBillingResponse, error) {
+	gateway := resilience.GetGateway(resilience.GatewayFlip)
+	bill, err := resilience.Execute(ctx, gateway, true, func(ctx context.Context) (*flipModel.EditBillingResponse, error) {
+		flipBase := flip.NewBaseFlip()
+		return flipBase.GetBill(billID)
+	})
+
+	audit.Log(ctx, resilience.GatewayFlip, "get-payment-link", cast.ToString(billID), err)
+	if err != nil {
+		return nil, err
+	}
+
+	return bill, nil
+}
+
+func (repo paymentLinks) GetAllPaymentLinks(ctx context.Context) (*flipModel.GetAllBillingResponse, error) {
+	gateway := resilience.GetGateway(resilience.GatewayFlip)
+	bills, err := resilience.Execute(ctx, gateway, true, func(ctx context.Context) (*flipModel.GetAllBillingResponse, error) {
+		flipBase := flip.NewBaseFlip()
+		return flipBase.GetAllBill()
+	})
+
+	audit.Log(ctx, resilience.GatewayFlip, "get-all-payment-links", "", err)
+	if err != nil {
+		return nil, err
+	}
+
+	var paymentLinkList flipModel.GetAllBillingResponse
+	for _, bill := range *bills {
+		if bill.Type == flipConstants.BillTypeMultiple {
+			paymentLinkList = append(paymentLinkList, bill)
+		}
+	}
+
+	return &paymentLinkList, nil
+}
+
+func (repo paymentLinks) GetPaymentLinkPayments(ctx context.Context, billID int64, params flipModel.GetPaymentRequest) (*flipModel.GetPaymentResponse, error) {
+	gateway := resilience.GetGateway(resilience.GatewayFlip)
+	payments, err := resilience.Execute(ctx, gateway, true, func(ctx context.Context) (*flipModel.GetPaymentResponse, error) {
+		flipBase := flip.NewBaseFlip()
+		return flipBase.GetPayment(billID, params)
+	})
+
+	audit.Log(ctx, resilience.GatewayFlip, "get-payment-link-payments", cast.ToString(billID), err)
+	if err != nil {
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+func (repo paymentLinks) CountSuccessfulPayments(ctx context.Context, billID int64) (int, error) {
+	var total int
+	page := 1
+	for {
+		params := flipModel.GetPaymentRequest{
+			Pagination: cast.ToString(paymentPerPage),
+			Page:       cast.ToString(page),
+		}
+
+		payments, err := repo.GetPaymentLinkPayments(ctx, billID, params)
+		if err != nil {
+			return 0, err
+		}
+
+		for _, payment := range payments.Data {
+			if payment.Status == PaymentStatusSuccessful || payment.Status == flipConstants.BillPaymentStatusDone {
+				total++
+			}
+		}
+
+		if payments.TotalPage <= page {
+			break
+		}
+
+		page++
+	}
+
+	return total, nil
+}
+
+// EnforceUsageLimit deactivate payment link when total successful payments reach template usage limit,
+// call this on flip payment callback. return true if payment link is deactivated
+func (repo paymentLinks) EnforceUsageLimit(ctx context.Context, billID int64) (bool, error) {
+	if repo.template == nil {
+		return false, fmt.Errorf("payment link template is empty")
+	}
+
+	return enforceUsageLimit(ctx, repo.template.UsageLimit, billID, repo.CountSuccessfulPayments,
+		func(ctx context.Context, billID int64) error {
+			_, err := repo.DeactivatePaymentLink(ctx, billID)
+			return err
+		})
+}
+
+func enforceUsageLimit(ctx context.Context, usageLimit int, billID int64,
+	countPayments func(ctx context.Context, billID int64) (int, error),
+	deactivate func(ctx context.Context, billID int64) error) (bool, error) {
+	if usageLimit == 0 {
+		return false, nil
+	}
+
+	total, err := countPayments(ctx, billID)
+	if err != nil {
+		return false, err
+	}
+
+	if total < usageLimit {
+		return false, nil
+	}
+
+	err = deactivate(ctx, billID)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (repo paymentLinks) formatAmount() string {
+	if repo.template.IsOpenAmount() {
+		return "" // leave blank for open amount
+	}
+
+	return fmt.Sprintf("%.2f", repo.template.Amount)
+}
+
+func (repo paymentLinks) formatExpiredDate() string {
+	if repo.template.ExpiredAt == nil {
+		return ""
+	}
+
+	return repo.template.ExpiredAt.Format(flipConstants.TimeFormatExpiredDate)
+}
+
+func formatFlag(flag bool) string {
+	if flag {
+		return flipConstants.SelfieFlagTrue
+	}
+
+	return flipConstants.SelfieFlagFalse
+}
@@ -0,0 +1,130 @@
+package flip_helpers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	flipConstants "github.com/fari-99/go-flip/constants"
+	flipModel "github.com/fari-99/go-flip/models"
+)
+
+func TestPaymentLinkTemplateValidate(t *testing.T) {
+	openAmount := PaymentLinkTemplate{Title: "Donation"}
+	if err := openAmount.Validate(); err != nil {
+		t.Fail()
+		t.Log(err.Error())
+		return
+	}
+
+	if !openAmount.IsOpenAmount() {
+		t.Fail()
+		t.Log("template without amount should be open amount")
+		return
+	}
+
+	fixedAmount := PaymentLinkTemplate{Title: "Event Ticket", Amount: 150000, UsageLimit: 100}
+	if err := fixedAmount.Validate(); err != nil {
+		t.Fail()
+		t.Log(err.Error())
+		return
+	}
+
+	if fixedAmount.IsOpenAmount() {
+		t.Fail()
+		t.Log("template with amount should be fixed amount")
+		return
+	}
+
+	invalidAmount := PaymentLinkTemplate{Title: "Event Ticket", Amount: 5000}
+	if err := invalidAmount.Validate(); err == nil {
+		t.Fail()
+		t.Log("amount below flip minimum should be invalid")
+		return
+	}
+
+	t.Log("success validate payment link template")
+	return
+}
+
+func TestEnforceUsageLimit(t *testing.T) {
+	ctx := context.Background()
+
+	var deactivated []int64
+	deactivate := func(ctx context.Context, billID int64) error {
+		deactivated = append(deactivated, billID)
+		return nil
+	}
+
+	countPayments := func(total int, err error) func(ctx context.Context, billID int64) (int, error) {
+		return func(ctx context.Context, billID int64) (int, error) {
+			return total, err
+		}
+	}
+
+	testCases := []struct {
+		name          string
+		usageLimit    int
+		total         int
+		countErr      error
+		isDeactivated bool
+		isError       bool
+	}{
+		{name: "unlimited", usageLimit: 0, total: 1000},
+		{name: "below limit", usageLimit: 100, total: 99},
+		{name: "limit reached", usageLimit: 100, total: 100, isDeactivated: true},
+		{name: "over limit", usageLimit: 100, total: 101, isDeactivated: true},
+		{name: "count error", usageLimit: 100, countErr: errors.New("flip unavailable"), isError: true},
+	}
+
+	for _, testCase := range testCases {
+		deactivated = nil
+		isDeactivated, err := enforceUsageLimit(ctx, testCase.usageLimit, 1, countPayments(testCase.total, testCase.countErr), deactivate)
+		if (err != nil) != testCase.isError || isDeactivated != testCase.isDeactivated || (len(deactivated) == 1) != testCase.isDeactivated {
+			t.Fail()
+			t.Logf("[%s] expected deactivated %t error %t, got %t %v (%v)", testCase.name, testCase.isDeactivated, testCase.isError, isDeactivated, deactivated, err)
+			return
+		}
+	}
+
+	t.Log("success enforce usage limit")
+	return
+}
+
+func TestGetDeactivateRequest(t *testing.T) {
+	expiredDate := "2026-12-31 23:59"
+	current := &flipModel.EditBillingResponse{
+		Title:             "Event Ticket",
+		Type:              flipConstants.BillTypeMultiple,
+		Amount:            150000,
+		ExpiredDate:       &expiredDate,
+		RedirectUrl:       "https://example.com/thanks",
+		IsAddressRequired: 1,
+		Status:            flipConstants.BillStatusActive,
+	}
+
+	request := getDeactivateRequest(current)
+	if request.Title != current.Title || request.Amount != "150000" || request.ExpiredDate != expiredDate ||
+		request.RedirectUrl != current.RedirectUrl || request.IsAddressRequired != flipConstants.SelfieFlagTrue ||
+		request.IsPhoneNumberRequired != flipConstants.SelfieFlagFalse {
+		t.Fail()
+		t.Logf("expected current payment link data kept, got %+v", request)
+		return
+	}
+
+	if request.Status != flipConstants.BillStatusInActive {
+		t.Fail()
+		t.Logf("expected status %s, got %s", flipConstants.BillStatusInActive, request.Status)
+		return
+	}
+
+	openAmount := getDeactivateRequest(&flipModel.EditBillingResponse{Title: "Donation"})
+	if openAmount.Amount != "" || openAmount.ExpiredDate != "" {
+		t.Fail()
+		t.Logf("expected open amount without expiry, got %+v", openAmount)
+		return
+	}
+
+	t.Log("success build deactivate request")
+	return
+}
@@ -1,6 +1,7 @@
 package payment_gateways
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -114,7 +115,7 @@ func TestCreateBill(t *testing.T) {
 	os.Setenv("FLIP_VALIDATION_TOKEN", "YOUR FLIP VALIDATION TOKEN")
 
 	flipData := GetTestFlipData()
-	invoices, err := CreateInvoice(flipData)
+	invoices, err := CreateInvoice(context.Background(), flipData)
 	if err != nil {
 		t.Fail()
 		t.Log(err.Error())
@@ -122,6 +123,6 @@ func TestCreateBill(t *testing.T) {
 	}
 
 	invoiceMarshal, _ := json.MarshalIndent(invoices, "", " ")
-	log.Printf(string(invoiceMarshal))
+	log.Println(string(invoiceMarshal))
 	return
 }
@@ -4,13 +4,17 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"net/http"
 	"os"
 
+	"github.com/go-resty/resty/v2"
 	"github.com/google/uuid"
 	"github.com/spf13/cast"
 
+	"github.com/fari-99/go-helper/payment_gateways/audit"
 	ipay88Model "github.com/fari-99/go-helper/payment_gateways/ipay88_helpers/models"
 	"github.com/fari-99/go-helper/payment_gateways/models"
+	"github.com/fari-99/go-helper/payment_gateways/resilience"
 )
 
 type BaseIpay88Helper struct {
@@ -230,3 +234,26 @@ func generateSellers(companies map[uint64]models.TransactionCompanies) ([]ipay88
 
 	return sellers, nil
 }
+
+// newRestyClient resty client that send correlation id from request context to ipay88
+func newRestyClient() *resty.Client {
+	return resty.New().SetTransport(audit.NewTransport(nil))
+}
+
+// restyError resty didn't return error on non 2xx response, server error counted as ipay88 failure,
+// client error is marked permanent so it's not retried
+func restyError(resp *resty.Response, err error) error {
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode() >= http.StatusInternalServerError {
+		return fmt.Errorf("ipay88 server error, status [%d]", resp.StatusCode())
+	}
+
+	if resp.StatusCode() >= http.StatusBadRequest {
+		return resilience.Permanent(fmt.Errorf("ipay88 client error, status [%d]", resp.StatusCode()))
+	}
+
+	return nil
+}
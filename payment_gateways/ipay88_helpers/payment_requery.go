@@ -1,17 +1,20 @@
 package ipay88_helpers
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/spf13/cast"
 
+	"github.com/fari-99/go-helper/payment_gateways/audit"
 	"github.com/fari-99/go-helper/payment_gateways/ipay88_helpers/constants"
 	"github.com/fari-99/go-helper/payment_gateways/ipay88_helpers/models"
+	"github.com/fari-99/go-helper/payment_gateways/resilience"
 )
 
-func (base *BaseIpay88Helper) PaymentRequery() ([]byte, error) {
+func (base *BaseIpay88Helper) PaymentRequery(ctx context.Context) ([]byte, error) {
 	url, err := constants.GetIpay88Url(constants.Ipay88PaymentRequeryUrl)
 	if err != nil {
 		return nil, err
@@ -28,11 +31,21 @@ func (base *BaseIpay88Helper) PaymentRequery() ([]byte, error) {
 	queryMarshal, _ := json.Marshal(paymentRequery)
 	_ = json.Unmarshal(queryMarshal, &query)
 
-	client := resty.New()
-	resp, err := client.R().
-		SetQueryParams(query).
-		Get(*url)
+	gateway := resilience.GetGateway(resilience.GatewayIpay88)
+	resp, err := resilience.Execute(ctx, gateway, true, func(ctx context.Context) (*resty.Response, error) {
+		client := newRestyClient()
+		resp, err := client.R().
+			SetContext(ctx).
+			SetQueryParams(query).
+			Get(*url)
+		return resp, restyError(resp, err)
+	})
+
+	audit.Log(ctx, resilience.GatewayIpay88, "payment-requery", invoices.TransactionUuid, err)
+	if err != nil {
+		return nil, err
+	}
 
-	log.Printf(string(resp.Body()))
-	return resp.Body(), err
+	log.Println(string(resp.Body()))
+	return resp.Body(), nil
 }
@@ -1,6 +1,7 @@
 package ipay88_helpers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -8,12 +9,14 @@ import (
 	"github.com/go-resty/resty/v2"
 	"github.com/spf13/cast"
 
+	"github.com/fari-99/go-helper/payment_gateways/audit"
 	"github.com/fari-99/go-helper/payment_gateways/ipay88_helpers/constants"
 	ipay88Model "github.com/fari-99/go-helper/payment_gateways/ipay88_helpers/models"
 	"github.com/fari-99/go-helper/payment_gateways/models"
+	"github.com/fari-99/go-helper/payment_gateways/resilience"
 )
 
-func (base *BaseIpay88Helper) CreatPaymentRequest() (*models.Invoices, error) {
+func (base *BaseIpay88Helper) CreatPaymentRequest(ctx context.Context) (*models.Invoices, error) {
 	currencyLabel, _ := constants.GetCurrencyLabel(constants.CurrencyIDR)
 	requestType, _ := constants.GetRequestTypeLabel(constants.RequestTypeRedirect)
 	encodingType, _ := constants.GetEncodingLabel(constants.EncodingUTF_8)
@@ -71,10 +74,17 @@ func (base *BaseIpay88Helper) CreatPaymentRequest() (*models.Invoices, error) {
 		return nil, err
 	}
 
-	client := resty.New()
-	resp, err := client.R().
-		SetBody(paymentRequestInput).
-		Post(*url)
+	gateway := resilience.GetGateway(resilience.GatewayIpay88)
+	resp, err := resilience.Execute(ctx, gateway, false, func(ctx context.Context) (*resty.Response, error) {
+		client := newRestyClient()
+		resp, err := client.R().
+			SetContext(ctx).
+			SetBody(paymentRequestInput).
+			Post(*url)
+		return resp, restyError(resp, err)
+	})
+
+	audit.Log(ctx, resilience.GatewayIpay88, "create-payment-request", transactionUuid, err)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,27 @@
+package models
+
+// normalized card charge status, same for every payment gateway
+const (
+	CardStatusRequiresAuthentication = "REQUIRES_AUTHENTICATION" // 3DS needed, show authentication url to customer
+	CardStatusAuthorized             = "AUTHORIZED"              // amount is held, waiting to be captured
+	CardStatusCaptured               = "CAPTURED"
+	CardStatusVoided                 = "VOIDED"
+	CardStatusPending                = "PENDING"
+	CardStatusFailed                 = "FAILED"
+)
+
+type CardCharges struct {
+	TransactionUuid  string `json:"transaction_uuid"`
+	PaymentGatewayID int8   `json:"payment_gateway_id"`
+
+	ChargeID          string  `json:"charge_id"`
+	Status            string  `json:"status"`
+	AuthorizedAmount  float64 `json:"authorized_amount"`
+	CapturedAmount    float64 `json:"captured_amount"`
+	Currency          string  `json:"currency"`
+	CardBrand         string  `json:"card_brand"`
+	MaskedCardNumber  string  `json:"masked_card_number"`
+	AuthenticationUrl string  `json:"authentication_url"`
+	FailureReason     string  `json:"failure_reason"`
+	ResponseJson      string  `json:"response_json"`
+}
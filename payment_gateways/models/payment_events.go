@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// normalized payment event type, same for every payment gateway
+const (
+	PaymentEventInvoiceCreated = "payment.invoice-created"
+	PaymentEventPaid           = "payment.paid"
+	PaymentEventExpired        = "payment.expired"
+	PaymentEventFailed         = "payment.failed"
+	PaymentEventCancelled      = "payment.cancelled"
+	PaymentEventRefunded       = "payment.refunded"
+)
+
+type PaymentEvents struct {
+	EventID          string      `json:"event_id"`
+	EventType        string      `json:"event_type"`
+	TransactionUuid  string      `json:"transaction_uuid"`
+	PaymentGatewayID int8        `json:"payment_gateway_id"`
+	Identifier       string      `json:"identifier"` // invoice id / bill id on payment gateway
+	Amount           float64     `json:"amount"`
+	OccurredAt       time.Time   `json:"occurred_at"`
+	Data             interface{} `json:"data"`
+}
@@ -0,0 +1,259 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	GatewayXendit = "xendit"
+	GatewayIpay88 = "ipay88"
+	GatewayFlip   = "flip"
+)
+
+type Policy struct {
+	Timeout          time.Duration // timeout for every attempt, 0 for no timeout
+	MaxRetries       int           // retry only used on idempotent call
+	InitialBackoff   time.Duration // backoff for first retry, doubled on next retry
+	MaxBackoff       time.Duration
+	FailureThreshold int           // consecutive failures before circuit breaker open
+	OpenDuration     time.Duration // how long circuit breaker open before trial call allowed
+	MaxAbandoned     int           // timed out call without context still running in background before new call rejected, 0 for unlimited
+}
+
+// ErrTooManyAbandoned too many timed out call still running in background, payment gateway is not responding
+var ErrTooManyAbandoned = errors.New("too many timed out payment gateway call still running")
+
+func DefaultPolicy() Policy {
+	return Policy{
+		Timeout:          15 * time.Second,
+		MaxRetries:       2,
+		InitialBackoff:   500 * time.Millisecond,
+		MaxBackoff:       5 * time.Second,
+		FailureThreshold: 5,
+		OpenDuration:     30 * time.Second,
+		MaxAbandoned:     20,
+	}
+}
+
+type GatewayHealth struct {
+	State               string     `json:"state"`
+	Healthy             bool       `json:"healthy"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastOpenedAt        *time.Time `json:"last_opened_at"`
+}
+
+type Gateway struct {
+	name    string
+	policy  Policy
+	breaker *CircuitBreaker
+
+	abandoned int32 // timed out call still running in background
+}
+
+var gatewaysMutex sync.RWMutex
+var gateways = map[string]*Gateway{}
+
+// SetPolicy replace policy for payment gateway, circuit breaker state is reset
+func SetPolicy(gatewayName string, policy Policy) {
+	gatewaysMutex.Lock()
+	defer gatewaysMutex.Unlock()
+
+	gateways[gatewayName] = newGateway(gatewayName, policy)
+}
+
+// GetGateway get payment gateway resilience config, created with DefaultPolicy if not yet set
+func GetGateway(gatewayName string) *Gateway {
+	gatewaysMutex.RLock()
+	gateway, ok := gateways[gatewayName]
+	gatewaysMutex.RUnlock()
+	if ok {
+		return gateway
+	}
+
+	gatewaysMutex.Lock()
+	defer gatewaysMutex.Unlock()
+
+	if gateway, ok = gateways[gatewayName]; !ok {
+		gateway = newGateway(gatewayName, DefaultPolicy())
+		gateways[gatewayName] = gateway
+	}
+
+	return gateway
+}
+
+// Health circuit breaker state of every payment gateway already called, for health check endpoint
+func Health() map[string]GatewayHealth {
+	gatewaysMutex.RLock()
+	defer gatewaysMutex.RUnlock()
+
+	health := make(map[string]GatewayHealth)
+	for gatewayName, gateway := range gateways {
+		health[gatewayName] = gateway.breaker.health()
+	}
+
+	return health
+}
+
+func newGateway(gatewayName string, policy Policy) *Gateway {
+	return &Gateway{
+		name:    gatewayName,
+		policy:  policy,
+		breaker: NewCircuitBreaker(policy.FailureThreshold, policy.OpenDuration),
+	}
+}
+
+func (gateway *Gateway) Name() string {
+	return gateway.name
+}
+
+func (gateway *Gateway) Policy() Policy {
+	return gateway.policy
+}
+
+func (gateway *Gateway) Health() GatewayHealth {
+	return gateway.breaker.health()
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent mark error as not retryable and not counted as gateway failure, ex: validation error from payment gateway
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return permanentError{err: err}
+}
+
+/*
+Execute call payment gateway with timeout, retry and circuit breaker from gateway policy.
+Only set idempotent to true for call that safe to be repeated (get data, or create using idempotency key)
+
+	invoiceData, err := resilience.Execute(ctx, resilience.GetGateway(resilience.GatewayXendit), true,
+		func(ctx context.Context) (*xendit.Invoice, error) {
+			return getInvoice(ctx, invoiceID)
+		})
+*/
+func Execute[T any](ctx context.Context, gateway *Gateway, idempotent bool, call func(ctx context.Context) (T, error)) (T, error) {
+	maxAttempt := 1
+	if idempotent {
+		maxAttempt += gateway.policy.MaxRetries
+	}
+
+	var result T
+	var err error
+	for attempt := 1; attempt <= maxAttempt; attempt++ {
+		if err = gateway.breaker.Allow(); err != nil {
+			return result, err
+		}
+
+		result, err = executeAttempt(ctx, gateway, call)
+		if err == nil {
+			gateway.breaker.OnSuccess()
+			return result, nil
+		}
+
+		var permanent permanentError
+		if errors.As(err, &permanent) {
+			gateway.breaker.OnIgnored()
+			return result, permanent.err
+		}
+
+		if ctx.Err() != nil { // cancelled by caller, not payment gateway fault
+			gateway.breaker.OnIgnored()
+			return result, err
+		}
+
+		gateway.breaker.OnFailure()
+		if attempt == maxAttempt {
+			break
+		}
+
+		select {
+		case <-time.After(gateway.backoff(attempt)):
+		case <-ctx.Done():
+			return result, ctx.Err()
+		}
+	}
+
+	return result, err
+}
+
+const (
+	attemptRunning int32 = iota
+	attemptFinished
+	attemptAbandoned
+)
+
+type attemptResult[T any] struct {
+	result T
+	err    error
+}
+
+func executeAttempt[T any](ctx context.Context, gateway *Gateway, call func(ctx context.Context) (T, error)) (T, error) {
+	if gateway.policy.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, gateway.policy.Timeout)
+		defer cancel()
+	}
+
+	if gateway.policy.MaxAbandoned > 0 && int(atomic.LoadInt32(&gateway.abandoned)) >= gateway.policy.MaxAbandoned {
+		var result T
+		return result, ErrTooManyAbandoned
+	}
+
+	// some payment gateway sdk didn't accept context, so we stop waiting when context is done.
+	// the call can't be stopped and keep running in background, counted as abandoned until it returns
+	var state int32 // attemptRunning, attemptFinished or attemptAbandoned
+	done := make(chan attemptResult[T], 1)
+	go func() {
+		result, err := call(ctx)
+		done <- attemptResult[T]{result: result, err: err}
+		if !atomic.CompareAndSwapInt32(&state, attemptRunning, attemptFinished) {
+			atomic.AddInt32(&gateway.abandoned, -1)
+		}
+	}()
+
+	select {
+	case output := <-done:
+		return output.result, output.err
+	case <-ctx.Done():
+		if !atomic.CompareAndSwapInt32(&state, attemptRunning, attemptAbandoned) {
+			output := <-done // finished at the same time
+			return output.result, output.err
+		}
+
+		atomic.AddInt32(&gateway.abandoned, 1)
+		var result T
+		return result, ctx.Err()
+	}
+}
+
+func (gateway *Gateway) backoff(attempt int) time.Duration {
+	backoff := gateway.policy.InitialBackoff << (attempt - 1)
+	if backoff <= 0 || (gateway.policy.MaxBackoff > 0 && backoff > gateway.policy.MaxBackoff) {
+		backoff = gateway.policy.MaxBackoff
+	}
+
+	if backoff <= 0 {
+		return 0
+	}
+
+	jitter := time.Duration(rand.Int63n(int64(backoff)/2 + 1))
+	return backoff/2 + jitter
+}
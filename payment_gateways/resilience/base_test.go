@@ -0,0 +1,179 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func getTestPolicy() Policy {
+	return Policy{
+		Timeout:          50 * time.Millisecond,
+		MaxRetries:       2,
+		InitialBackoff:   time.Millisecond,
+		MaxBackoff:       5 * time.Millisecond,
+		FailureThreshold: 3,
+		OpenDuration:     50 * time.Millisecond,
+	}
+}
+
+func TestExecuteRetryIdempotent(t *testing.T) {
+	gateway := newGateway("test-retry", getTestPolicy())
+
+	var totalCall int
+	result, err := Execute(context.Background(), gateway, true, func(ctx context.Context) (string, error) {
+		totalCall++
+		if totalCall < 3 {
+			return "", errors.New("gateway unavailable")
+		}
+
+		return "success", nil
+	})
+	if err != nil {
+		t.Fail()
+		t.Log(err.Error())
+		return
+	}
+
+	if result != "success" || totalCall != 3 {
+		t.Fail()
+		t.Logf("expected success after 3 call, got [%s] after %d call", result, totalCall)
+		return
+	}
+
+	var totalCallNonIdempotent int
+	_, err = Execute(context.Background(), gateway, false, func(ctx context.Context) (string, error) {
+		totalCallNonIdempotent++
+		return "", errors.New("gateway unavailable")
+	})
+	if err == nil || totalCallNonIdempotent != 1 {
+		t.Fail()
+		t.Logf("non idempotent call should not be retried, called %d times", totalCallNonIdempotent)
+		return
+	}
+
+	t.Log("success retry idempotent call")
+	return
+}
+
+func TestExecuteTimeout(t *testing.T) {
+	gateway := newGateway("test-timeout", getTestPolicy())
+
+	_, err := Execute(context.Background(), gateway, false, func(ctx context.Context) (string, error) {
+		time.Sleep(time.Second) // payment gateway sdk without context
+		return "success", nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fail()
+		t.Logf("expected deadline exceeded, got %v", err)
+		return
+	}
+
+	t.Log("success timeout slow call")
+	return
+}
+
+func TestExecuteMaxAbandoned(t *testing.T) {
+	policy := getTestPolicy()
+	policy.Timeout = 5 * time.Millisecond
+	policy.MaxAbandoned = 1
+	policy.FailureThreshold = 10
+	gateway := newGateway("test-abandoned", policy)
+
+	release := make(chan struct{})
+	slowCall := func(ctx context.Context) (string, error) {
+		<-release // payment gateway sdk without context
+		return "success", nil
+	}
+
+	if _, err := Execute(context.Background(), gateway, false, slowCall); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fail()
+		t.Logf("expected deadline exceeded, got %v", err)
+		return
+	}
+
+	if _, err := Execute(context.Background(), gateway, false, slowCall); !errors.Is(err, ErrTooManyAbandoned) {
+		t.Fail()
+		t.Logf("expected ErrTooManyAbandoned, got %v", err)
+		return
+	}
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&gateway.abandoned) != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	result, err := Execute(context.Background(), gateway, false, slowCall)
+	if err != nil || result != "success" {
+		t.Fail()
+		t.Logf("expected call allowed after abandoned call returned, got %s (%v)", result, err)
+		return
+	}
+
+	t.Log("success limit abandoned call")
+	return
+}
+
+func TestExecuteCircuitBreaker(t *testing.T) {
+	gateway := newGateway("test-breaker", getTestPolicy())
+
+	failedCall := func(ctx context.Context) (string, error) {
+		return "", errors.New("gateway unavailable")
+	}
+
+	_, _ = Execute(context.Background(), gateway, true, failedCall) // 3 attempt, reach failure threshold
+	if gateway.Health().State != StateOpen.String() {
+		t.Fail()
+		t.Logf("expected breaker open, got %s", gateway.Health().State)
+		return
+	}
+
+	_, err := Execute(context.Background(), gateway, true, failedCall)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fail()
+		t.Logf("expected circuit open error, got %v", err)
+		return
+	}
+
+	time.Sleep(getTestPolicy().OpenDuration)
+	_, err = Execute(context.Background(), gateway, false, func(ctx context.Context) (string, error) {
+		return "success", nil
+	})
+	if err != nil || gateway.Health().State != StateClosed.String() {
+		t.Fail()
+		t.Logf("expected breaker closed after trial call, got %s", gateway.Health().State)
+		return
+	}
+
+	t.Log("success open and close circuit breaker")
+	return
+}
+
+func TestExecutePermanentError(t *testing.T) {
+	gateway := newGateway("test-permanent", getTestPolicy())
+
+	validationErr := errors.New("amount is invalid")
+
+	var totalCall int
+	_, err := Execute(context.Background(), gateway, true, func(ctx context.Context) (string, error) {
+		totalCall++
+		return "", Permanent(validationErr)
+	})
+	if !errors.Is(err, validationErr) || totalCall != 1 {
+		t.Fail()
+		t.Logf("permanent error should not be retried, called %d times", totalCall)
+		return
+	}
+
+	if gateway.Health().ConsecutiveFailures != 0 {
+		t.Fail()
+		t.Log("permanent error should not be counted as gateway failure")
+		return
+	}
+
+	t.Log("success handle permanent error")
+	return
+}
@@ -0,0 +1,139 @@
+package resilience
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open, payment gateway is unavailable")
+
+type BreakerState int
+
+const (
+	StateClosed BreakerState = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (state BreakerState) String() string {
+	switch state {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreaker open after FailureThreshold consecutive failures, and let one trial call pass (half-open)
+// after OpenDuration, the trial call decide to close or open the breaker again. failureThreshold 0 disable the breaker
+type CircuitBreaker struct {
+	mutex sync.Mutex
+
+	failureThreshold int
+	openDuration     time.Duration
+
+	state               BreakerState
+	consecutiveFailures int
+	openedAt            time.Time
+	trialInFlight       bool
+}
+
+func NewCircuitBreaker(failureThreshold int, openDuration time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		failureThreshold: failureThreshold,
+		openDuration:     openDuration,
+		state:            StateClosed,
+	}
+}
+
+// Allow return ErrCircuitOpen if call is not allowed to go to payment gateway
+func (breaker *CircuitBreaker) Allow() error {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	switch breaker.state {
+	case StateOpen:
+		if time.Since(breaker.openedAt) < breaker.openDuration {
+			return ErrCircuitOpen
+		}
+
+		breaker.state = StateHalfOpen
+		breaker.trialInFlight = true
+		return nil
+	case StateHalfOpen:
+		if breaker.trialInFlight {
+			return ErrCircuitOpen
+		}
+
+		breaker.trialInFlight = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+func (breaker *CircuitBreaker) OnSuccess() {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	breaker.state = StateClosed
+	breaker.consecutiveFailures = 0
+	breaker.trialInFlight = false
+}
+
+func (breaker *CircuitBreaker) OnFailure() {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	breaker.consecutiveFailures++
+	breaker.trialInFlight = false
+
+	if breaker.state == StateHalfOpen || (breaker.failureThreshold > 0 && breaker.consecutiveFailures >= breaker.failureThreshold) {
+		breaker.state = StateOpen
+		breaker.openedAt = time.Now()
+	}
+}
+
+// OnIgnored release half-open trial without changing breaker state, used for error caused by caller
+func (breaker *CircuitBreaker) OnIgnored() {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	breaker.trialInFlight = false
+}
+
+func (breaker *CircuitBreaker) State() BreakerState {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	if breaker.state == StateOpen && time.Since(breaker.openedAt) >= breaker.openDuration {
+		return StateHalfOpen
+	}
+
+	return breaker.state
+}
+
+func (breaker *CircuitBreaker) health() GatewayHealth {
+	state := breaker.State()
+
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	health := GatewayHealth{
+		State:               state.String(),
+		ConsecutiveFailures: breaker.consecutiveFailures,
+		Healthy:             state != StateOpen,
+	}
+
+	if !breaker.openedAt.IsZero() {
+		openedAt := breaker.openedAt
+		health.LastOpenedAt = &openedAt
+	}
+
+	return health
+}
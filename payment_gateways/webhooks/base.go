@@ -0,0 +1,288 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cast"
+
+	"github.com/fari-99/go-helper/crypts"
+	"github.com/fari-99/go-helper/payment_gateways/audit"
+	"github.com/fari-99/go-helper/payment_gateways/models"
+)
+
+const (
+	HeaderSignature  = "X-Webhook-Signature"
+	HeaderTimestamp  = "X-Webhook-Timestamp"
+	HeaderEventType  = "X-Webhook-Event"
+	HeaderDeliveryID = "X-Webhook-Delivery-ID"
+)
+
+type Subscribers struct {
+	ID         string   `json:"id"`
+	Url        string   `json:"url"`
+	Secret     string   `json:"-"`           // used to sign payload, shared with merchant
+	EventTypes []string `json:"event_types"` // empty for all event
+	IsActive   bool     `json:"is_active"`
+}
+
+func (model Subscribers) isSubscribed(eventType string) bool {
+	if !model.IsActive {
+		return false
+	}
+
+	if len(model.EventTypes) == 0 {
+		return true
+	}
+
+	for _, subscribedEvent := range model.EventTypes {
+		if subscribedEvent == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+type Config struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration // backoff for first retry, doubled on next retry
+	MaxBackoff     time.Duration
+	Timeout        time.Duration // timeout for every attempt
+	HttpClient     *http.Client
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+		Timeout:        10 * time.Second,
+	}
+}
+
+type Dispatcher struct {
+	config      Config
+	deliveryLog DeliveryLog
+
+	mutex       sync.RWMutex
+	subscribers map[string]Subscribers
+}
+
+// NewDispatcher send payment events to merchant endpoints, nil config use DefaultConfig and nil delivery log use memory
+func NewDispatcher(config *Config, deliveryLog DeliveryLog) *Dispatcher {
+	if config == nil {
+		defaultConfig := DefaultConfig()
+		config = &defaultConfig
+	}
+
+	if config.HttpClient == nil {
+		config.HttpClient = &http.Client{Transport: audit.NewTransport(nil)}
+	}
+
+	if deliveryLog == nil {
+		deliveryLog = NewMemoryDeliveryLog()
+	}
+
+	return &Dispatcher{
+		config:      *config,
+		deliveryLog: deliveryLog,
+		subscribers: make(map[string]Subscribers),
+	}
+}
+
+func (dispatcher *Dispatcher) AddSubscriber(subscriber Subscribers) *Dispatcher {
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+
+	dispatcher.subscribers[subscriber.ID] = subscriber
+	return dispatcher
+}
+
+func (dispatcher *Dispatcher) RemoveSubscriber(subscriberID string) *Dispatcher {
+	dispatcher.mutex.Lock()
+	defer dispatcher.mutex.Unlock()
+
+	delete(dispatcher.subscribers, subscriberID)
+	return dispatcher
+}
+
+func (dispatcher *Dispatcher) getSubscriber(subscriberID string) (Subscribers, bool) {
+	dispatcher.mutex.RLock()
+	defer dispatcher.mutex.RUnlock()
+
+	subscriber, ok := dispatcher.subscribers[subscriberID]
+	return subscriber, ok
+}
+
+// Dispatch send event to every subscribed merchant, wait until all delivery is done or failed after max attempts
+func (dispatcher *Dispatcher) Dispatch(ctx context.Context, event models.PaymentEvents) ([]Deliveries, error) {
+	if event.EventID == "" {
+		event.EventID = uuid.New().String()
+	}
+
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	dispatcher.mutex.RLock()
+	var subscribers []Subscribers
+	for _, subscriber := range dispatcher.subscribers {
+		if subscriber.isSubscribed(event.EventType) {
+			subscribers = append(subscribers, subscriber)
+		}
+	}
+	dispatcher.mutex.RUnlock()
+
+	deliveries := make([]Deliveries, len(subscribers))
+
+	var waitGroup sync.WaitGroup
+	for idx, subscriber := range subscribers {
+		delivery := Deliveries{
+			ID:           uuid.New().String(),
+			SubscriberID: subscriber.ID,
+			EventID:      event.EventID,
+			EventType:    event.EventType,
+			Payload:      string(payload),
+			Status:       DeliveryStatusPending,
+			CreatedAt:    time.Now(),
+		}
+
+		waitGroup.Add(1)
+		go func(idx int, subscriber Subscribers, delivery Deliveries) {
+			defer waitGroup.Done()
+			deliveries[idx] = dispatcher.deliver(ctx, subscriber, delivery)
+		}(idx, subscriber, delivery)
+	}
+
+	waitGroup.Wait()
+	return deliveries, nil
+}
+
+// Replay send stored delivery payload again, ex: after merchant fixed their endpoint
+func (dispatcher *Dispatcher) Replay(ctx context.Context, deliveryID string) (*Deliveries, error) {
+	delivery, err := dispatcher.deliveryLog.Get(deliveryID)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriber, ok := dispatcher.getSubscriber(delivery.SubscriberID)
+	if !ok {
+		return nil, fmt.Errorf("subscriber [%s] not found", delivery.SubscriberID)
+	}
+
+	delivery.Status = DeliveryStatusPending
+	result := dispatcher.deliver(ctx, subscriber, *delivery)
+	return &result, nil
+}
+
+func (dispatcher *Dispatcher) deliver(ctx context.Context, subscriber Subscribers, delivery Deliveries) Deliveries {
+	_ = dispatcher.deliveryLog.Save(delivery)
+
+	for attempt := 1; attempt <= dispatcher.config.MaxAttempts; attempt++ {
+		delivery.Attempts++
+		statusCode, err := dispatcher.send(ctx, subscriber, delivery)
+		delivery.LastStatusCode = statusCode
+
+		if err == nil {
+			deliveredAt := time.Now()
+			delivery.Status = DeliveryStatusDelivered
+			delivery.DeliveredAt = &deliveredAt
+			delivery.LastError = ""
+			_ = dispatcher.deliveryLog.Save(delivery)
+			return delivery
+		}
+
+		delivery.LastError = err.Error()
+		_ = dispatcher.deliveryLog.Save(delivery)
+
+		if attempt == dispatcher.config.MaxAttempts {
+			break
+		}
+
+		select {
+		case <-time.After(dispatcher.backoff(attempt)):
+		case <-ctx.Done():
+			delivery.Status = DeliveryStatusFailed
+			delivery.LastError = ctx.Err().Error()
+			_ = dispatcher.deliveryLog.Save(delivery)
+			return delivery
+		}
+	}
+
+	delivery.Status = DeliveryStatusFailed
+	_ = dispatcher.deliveryLog.Save(delivery)
+	return delivery
+}
+
+func (dispatcher *Dispatcher) send(ctx context.Context, subscriber Subscribers, delivery Deliveries) (int, error) {
+	if dispatcher.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dispatcher.config.Timeout)
+		defer cancel()
+	}
+
+	timestamp := cast.ToString(time.Now().Unix())
+	signature, err := SignPayload(subscriber.Secret, timestamp, []byte(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscriber.Url, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderSignature, signature)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderEventType, delivery.EventType)
+	req.Header.Set(HeaderDeliveryID, delivery.ID)
+
+	resp, err := dispatcher.config.HttpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return resp.StatusCode, fmt.Errorf("merchant endpoint response status [%d]", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+func (dispatcher *Dispatcher) backoff(attempt int) time.Duration {
+	backoff := dispatcher.config.InitialBackoff << (attempt - 1)
+	if backoff <= 0 || (dispatcher.config.MaxBackoff > 0 && backoff > dispatcher.config.MaxBackoff) {
+		backoff = dispatcher.config.MaxBackoff
+	}
+
+	return backoff
+}
+
+// SignPayload HMAC-SHA256 of "timestamp.payload", receiver compute the same to verify webhook
+func SignPayload(secret, timestamp string, payload []byte) (string, error) {
+	signBase := crypts.NewEncryptionBase()
+	signBase.SetPassphrase(secret)
+	return signBase.SignHmac(buildSignedMessage(timestamp, payload))
+}
+
+func buildSignedMessage(timestamp string, payload []byte) []byte {
+	message := make([]byte, 0, len(timestamp)+1+len(payload))
+	message = append(message, timestamp+"."...)
+	return append(message, payload...)
+}
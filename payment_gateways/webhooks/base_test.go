@@ -0,0 +1,125 @@
+package webhooks
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fari-99/go-helper/payment_gateways/models"
+)
+
+func getTestDispatcher() *Dispatcher {
+	config := DefaultConfig()
+	config.MaxAttempts = 3
+	config.InitialBackoff = time.Millisecond
+	config.MaxBackoff = 5 * time.Millisecond
+
+	return NewDispatcher(&config, nil)
+}
+
+func TestDispatch(t *testing.T) {
+	receiver := NewTestReceiver("merchant-secret")
+	defer receiver.Close()
+
+	otherReceiver := NewTestReceiver("other-secret")
+	defer otherReceiver.Close()
+
+	dispatcher := getTestDispatcher().
+		AddSubscriber(Subscribers{ID: "merchant-1", Url: receiver.Url(), Secret: "merchant-secret", IsActive: true}).
+		AddSubscriber(Subscribers{ID: "merchant-2", Url: otherReceiver.Url(), Secret: "other-secret", IsActive: true,
+			EventTypes: []string{models.PaymentEventExpired}})
+
+	event := models.PaymentEvents{
+		EventType:       models.PaymentEventPaid,
+		TransactionUuid: "uuid-123456789",
+		Amount:          150000,
+	}
+
+	deliveries, err := dispatcher.Dispatch(context.Background(), event)
+	if err != nil {
+		t.Fail()
+		t.Log(err.Error())
+		return
+	}
+
+	if len(deliveries) != 1 || deliveries[0].Status != DeliveryStatusDelivered {
+		t.Fail()
+		t.Logf("expected 1 delivered webhook, got %d", len(deliveries))
+		return
+	}
+
+	events := receiver.Events()
+	if len(events) != 1 || events[0].TransactionUuid != event.TransactionUuid || len(receiver.Errors()) != 0 {
+		t.Fail()
+		t.Log("merchant should receive verified webhook")
+		return
+	}
+
+	if len(otherReceiver.Events()) != 0 {
+		t.Fail()
+		t.Log("merchant not subscribed to event should not receive webhook")
+		return
+	}
+
+	t.Log("success dispatch webhook")
+	return
+}
+
+func TestDispatchRetryAndReplay(t *testing.T) {
+	receiver := NewTestReceiver("merchant-secret")
+	defer receiver.Close()
+	receiver.SetStatusCode(http.StatusInternalServerError)
+
+	dispatcher := getTestDispatcher().
+		AddSubscriber(Subscribers{ID: "merchant-1", Url: receiver.Url(), Secret: "merchant-secret", IsActive: true})
+
+	deliveries, _ := dispatcher.Dispatch(context.Background(), models.PaymentEvents{EventType: models.PaymentEventPaid})
+	if len(deliveries) != 1 || deliveries[0].Status != DeliveryStatusFailed || deliveries[0].Attempts != 3 {
+		t.Fail()
+		t.Log("expected failed delivery after 3 attempts")
+		return
+	}
+
+	failedDeliveries, _ := dispatcher.deliveryLog.List(DeliveryFilter{Status: DeliveryStatusFailed})
+	if len(failedDeliveries) != 1 {
+		t.Fail()
+		t.Log("failed delivery should be on delivery log")
+		return
+	}
+
+	receiver.SetStatusCode(http.StatusOK)
+	delivery, err := dispatcher.Replay(context.Background(), deliveries[0].ID)
+	if err != nil {
+		t.Fail()
+		t.Log(err.Error())
+		return
+	}
+
+	if delivery.Status != DeliveryStatusDelivered || delivery.Attempts != 4 {
+		t.Fail()
+		t.Logf("expected delivered after replay, got [%s]", delivery.Status)
+		return
+	}
+
+	t.Log("success retry and replay webhook")
+	return
+}
+
+func TestVerifyRequestInvalidSignature(t *testing.T) {
+	receiver := NewTestReceiver("merchant-secret")
+	defer receiver.Close()
+
+	dispatcher := getTestDispatcher().
+		AddSubscriber(Subscribers{ID: "merchant-1", Url: receiver.Url(), Secret: "wrong-secret", IsActive: true})
+
+	_, _ = dispatcher.Dispatch(context.Background(), models.PaymentEvents{EventType: models.PaymentEventPaid})
+	if len(receiver.Events()) != 0 || len(receiver.Errors()) == 0 {
+		t.Fail()
+		t.Log("webhook with invalid signature should be rejected")
+		return
+	}
+
+	t.Log("success reject invalid signature")
+	return
+}
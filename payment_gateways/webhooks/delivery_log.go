@@ -0,0 +1,100 @@
+package webhooks
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DeliveryStatusPending   = "PENDING"
+	DeliveryStatusDelivered = "DELIVERED"
+	DeliveryStatusFailed    = "FAILED"
+)
+
+type Deliveries struct {
+	ID             string     `json:"id"`
+	SubscriberID   string     `json:"subscriber_id"`
+	EventID        string     `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Payload        string     `json:"payload"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	LastStatusCode int        `json:"last_status_code"`
+	LastError      string     `json:"last_error"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+}
+
+type DeliveryFilter struct {
+	SubscriberID string
+	EventID      string
+	Status       string
+}
+
+// DeliveryLog store every webhook delivery, implement this to save delivery log on your database
+type DeliveryLog interface {
+	Save(delivery Deliveries) error
+	Get(deliveryID string) (*Deliveries, error)
+	List(filter DeliveryFilter) ([]Deliveries, error)
+}
+
+type memoryDeliveryLog struct {
+	mutex      sync.RWMutex
+	deliveries map[string]Deliveries
+}
+
+func NewMemoryDeliveryLog() DeliveryLog {
+	return &memoryDeliveryLog{
+		deliveries: make(map[string]Deliveries),
+	}
+}
+
+func (repo *memoryDeliveryLog) Save(delivery Deliveries) error {
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+
+	repo.deliveries[delivery.ID] = delivery
+	return nil
+}
+
+func (repo *memoryDeliveryLog) Get(deliveryID string) (*Deliveries, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+
+	delivery, ok := repo.deliveries[deliveryID]
+	if !ok {
+		return nil, fmt.Errorf("delivery [%s] not found", deliveryID)
+	}
+
+	return &delivery, nil
+}
+
+func (repo *memoryDeliveryLog) List(filter DeliveryFilter) ([]Deliveries, error) {
+	repo.mutex.RLock()
+	defer repo.mutex.RUnlock()
+
+	var deliveries []Deliveries
+	for _, delivery := range repo.deliveries {
+		if filter.SubscriberID != "" && delivery.SubscriberID != filter.SubscriberID {
+			continue
+		}
+
+		if filter.EventID != "" && delivery.EventID != filter.EventID {
+			continue
+		}
+
+		if filter.Status != "" && delivery.Status != filter.Status {
+			continue
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.Before(deliveries[j].CreatedAt)
+	})
+
+	return deliveries, nil
+}
@@ -0,0 +1,125 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/spf13/cast"
+
+	"github.com/fari-99/go-helper/crypts"
+	"github.com/fari-99/go-helper/payment_gateways/models"
+)
+
+// VerifyRequest verify webhook signature on merchant side, tolerance 0 skip timestamp check
+func VerifyRequest(r *http.Request, secret string, tolerance time.Duration) (*models.PaymentEvents, error) {
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := r.Header.Get(HeaderTimestamp)
+	if timestamp == "" || r.Header.Get(HeaderSignature) == "" {
+		return nil, fmt.Errorf("webhook signature or timestamp is empty")
+	}
+
+	if tolerance > 0 {
+		signedAt := time.Unix(cast.ToInt64(timestamp), 0)
+		if time.Since(signedAt) > tolerance || time.Until(signedAt) > tolerance {
+			return nil, fmt.Errorf("webhook timestamp is outside tolerance")
+		}
+	}
+
+	verifyBase := crypts.NewEncryptionBase()
+	verifyBase.SetPassphrase(secret)
+	isVerified, err := verifyBase.VerifyHmac(buildSignedMessage(timestamp, payload), r.Header.Get(HeaderSignature))
+	if err != nil {
+		return nil, err
+	}
+
+	if !isVerified {
+		return nil, fmt.Errorf("webhook signature is invalid")
+	}
+
+	var event models.PaymentEvents
+	err = json.Unmarshal(payload, &event)
+	if err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+// TestReceiver httptest server that verify and record webhook, use it on merchant or dispatcher test
+type TestReceiver struct {
+	Server *httptest.Server
+
+	secret     string
+	mutex      sync.Mutex
+	statusCode int
+	events     []models.PaymentEvents
+	errors     []error
+}
+
+func NewTestReceiver(secret string) *TestReceiver {
+	receiver := &TestReceiver{
+		secret:     secret,
+		statusCode: http.StatusOK,
+	}
+
+	receiver.Server = httptest.NewServer(http.HandlerFunc(receiver.handle))
+	return receiver
+}
+
+func (receiver *TestReceiver) handle(w http.ResponseWriter, r *http.Request) {
+	event, err := VerifyRequest(r, receiver.secret, 5*time.Minute)
+
+	receiver.mutex.Lock()
+	defer receiver.mutex.Unlock()
+
+	if err != nil {
+		receiver.errors = append(receiver.errors, err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	receiver.events = append(receiver.events, *event)
+	w.WriteHeader(receiver.statusCode)
+}
+
+func (receiver *TestReceiver) Url() string {
+	return receiver.Server.URL
+}
+
+// SetStatusCode response status for next webhook, ex: http.StatusInternalServerError to test retry
+func (receiver *TestReceiver) SetStatusCode(statusCode int) *TestReceiver {
+	receiver.mutex.Lock()
+	defer receiver.mutex.Unlock()
+
+	receiver.statusCode = statusCode
+	return receiver
+}
+
+// Events every verified webhook, including webhook responded with non 2xx status
+func (receiver *TestReceiver) Events() []models.PaymentEvents {
+	receiver.mutex.Lock()
+	defer receiver.mutex.Unlock()
+
+	return append([]models.PaymentEvents(nil), receiver.events...)
+}
+
+// Errors every webhook failed to be verified
+func (receiver *TestReceiver) Errors() []error {
+	receiver.mutex.Lock()
+	defer receiver.mutex.Unlock()
+
+	return append([]error(nil), receiver.errors...)
+}
+
+func (receiver *TestReceiver) Close() {
+	receiver.Server.Close()
+}
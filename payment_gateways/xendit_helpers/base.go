@@ -2,18 +2,23 @@ package xendit_helpers
 
 import (
 	"fmt"
+	"net/http"
 	"os"
+	"sync"
 
 	"github.com/spf13/cast"
 	"github.com/xendit/xendit-go"
 
+	"github.com/fari-99/go-helper/payment_gateways/audit"
 	"github.com/fari-99/go-helper/payment_gateways/models"
+	"github.com/fari-99/go-helper/payment_gateways/resilience"
 	xenditConstant "github.com/fari-99/go-helper/payment_gateways/xendit_helpers/constants"
 )
 
 type BaseXenditHelpers struct {
 	XenditSecretKey         string
 	XenditVerificationToken string
+	XenditMidLabel          string // optional, merchant id label for credit cards
 	Currency                string
 	ReminderTimeUnit        string
 	ReminderTime            int
@@ -26,6 +31,8 @@ type BaseXenditHelpers struct {
 	PaymentMethods          []models.PaymentMethods
 }
 
+var xenditClientOnce sync.Once
+
 type XenditInvoiceData struct {
 	descriptions string
 
@@ -65,11 +72,35 @@ func NewXenditHelpers(transactionUuid string) *BaseXenditHelpers {
 		ReminderTime:            cast.ToInt(os.Getenv("XENDIT_REMINDER_TIME")),
 		XenditSecretKey:         os.Getenv("XENDIT_SECRET_KEY"),
 		XenditVerificationToken: os.Getenv("XENDIT_VERIFICATION_TOKEN"),
+		XenditMidLabel:          os.Getenv("XENDIT_MID_LABEL"),
 	}
 
 	return base
 }
 
+// NewXenditClientHelpers only need XENDIT_SECRET_KEY, for call that didn't create invoice, ex: get or cancel invoice
+func NewXenditClientHelpers() (*BaseXenditHelpers, error) {
+	if os.Getenv("XENDIT_SECRET_KEY") == "" {
+		return nil, fmt.Errorf("xendit secret key is empty")
+	}
+
+	base := &BaseXenditHelpers{
+		XenditSecretKey: os.Getenv("XENDIT_SECRET_KEY"),
+		XenditMidLabel:  os.Getenv("XENDIT_MID_LABEL"),
+	}
+
+	return base, nil
+}
+
+// setupXenditClient xendit sdk use global http client, set once so correlation id is sent on every request
+func setupXenditClient() {
+	xenditClientOnce.Do(func() {
+		xendit.SetHTTPClient(&http.Client{
+			Transport: audit.NewTransport(nil),
+		})
+	})
+}
+
 func (base *BaseXenditHelpers) SetTransactionDetails(transactionModel models.Transactions) *BaseXenditHelpers {
 	base.TransactionModel = &transactionModel
 	return base
@@ -250,3 +281,22 @@ func generateXenditItems(transactionItems []models.TransactionItems) ([]xendit.I
 
 	return invoiceItems, total, nil
 }
+
+// xenditError convert xendit error to go error, client error (4xx) is marked permanent so it's not retried
+func xenditError(errXendit *xendit.Error) error {
+	if errXendit == nil {
+		return nil
+	}
+
+	status := errXendit.GetStatus()
+	isClientError := status >= http.StatusBadRequest && status < http.StatusInternalServerError
+	isRetryable := status == http.StatusTeapot || // xendit sdk use teapot status for go error, ex: connection error
+		status == http.StatusRequestTimeout ||
+		status == http.StatusTooManyRequests
+
+	if isClientError && !isRetryable {
+		return resilience.Permanent(errXendit)
+	}
+
+	return errXendit
+}
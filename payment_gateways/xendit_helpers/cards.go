@@ -0,0 +1,254 @@
+package xendit_helpers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/xendit/xendit-go"
+	"github.com/xendit/xendit-go/card"
+
+	"github.com/fari-99/go-helper/payment_gateways/audit"
+	"github.com/fari-99/go-helper/payment_gateways/models"
+	"github.com/fari-99/go-helper/payment_gateways/resilience"
+	"github.com/fari-99/go-helper/payment_gateways/xendit_helpers/constants"
+	xenditModels "github.com/fari-99/go-helper/payment_gateways/xendit_helpers/models"
+)
+
+type CardChargeData struct {
+	TokenID        string                                   // card token created on client using xendit.js
+	Authentication *xenditModels.CardAuthenticationCallback // 3DS authentication result, nil if not yet authenticated
+	CardCVN        string
+	Capture        bool // false only authorize the amount, capture later using CaptureCharge
+	IsRecurring    bool
+}
+
+type Cards interface {
+	CreateCharge(ctx context.Context, chargeData CardChargeData) (*models.CardCharges, error)
+	CaptureCharge(ctx context.Context, chargeID string, amount float64) (*models.CardCharges, error)
+	VoidCharge(ctx context.Context, chargeID string) (*models.CardCharges, error)
+	GetCharge(ctx context.Context, chargeID string) (*models.CardCharges, error)
+}
+
+type cards struct {
+	base *BaseXenditHelpers
+}
+
+func NewCards(base *BaseXenditHelpers) Cards {
+	setupXenditClient()
+	return cards{base: base}
+}
+
+func (repo cards) CreateCharge(ctx context.Context, chargeData CardChargeData) (*models.CardCharges, error) {
+	transactionUuid := repo.base.TransactionUuid
+	if chargeData.TokenID == "" {
+		return nil, fmt.Errorf("card token is empty")
+	}
+
+	// card need 3DS, charge only after authentication is verified
+	authentication := chargeData.Authentication
+	if authentication != nil && authentication.Status != constants.CardAuthenticationVerified {
+		return repo.generateAuthenticationResult(*authentication), nil
+	}
+
+	_, totalItem, err := generateXenditItems(repo.base.TransactionItemModels)
+	if err != nil {
+		return nil, err
+	}
+
+	_, totalAdditionalFee, err := getAdditionalFee()
+	if err != nil {
+		return nil, err
+	}
+
+	chargeParams := card.CreateChargeParams{
+		TokenID:     chargeData.TokenID,
+		ExternalID:  transactionUuid,
+		Amount:      totalItem + totalAdditionalFee,
+		CardCVN:     chargeData.CardCVN,
+		Capture:     &chargeData.Capture,
+		MidLabel:    repo.base.XenditMidLabel,
+		Currency:    repo.base.Currency,
+		IsRecurring: &chargeData.IsRecurring,
+	}
+
+	if authentication != nil {
+		chargeParams.AuthenticationID = authentication.ID
+	}
+
+	xendit.Opt.SecretKey = repo.base.XenditSecretKey
+	gateway := resilience.GetGateway(resilience.GatewayXendit)
+	chargeResp, err := resilience.Execute(ctx, gateway, false, func(ctx context.Context) (*xendit.CardCharge, error) {
+		chargeResp, errXendit := card.CreateChargeWithContext(ctx, &chargeParams)
+		return chargeResp, xenditError(errXendit)
+	})
+
+	audit.Log(ctx, resilience.GatewayXendit, "create-card-charge", transactionUuid, err)
+
+	var errXendit *xendit.Error
+	if errors.As(err, &errXendit) && errXendit.GetErrorCode() == constants.CardErrorAuthenticationRequired {
+		return &models.CardCharges{
+			TransactionUuid:  transactionUuid,
+			PaymentGatewayID: repo.getPaymentGatewayID(),
+			Status:           models.CardStatusRequiresAuthentication,
+			FailureReason:    errXendit.Message,
+		}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.generateChargeResult(chargeResp), nil
+}
+
+func (repo cards) CaptureCharge(ctx context.Context, chargeID string, amount float64) (*models.CardCharges, error) {
+	params := card.CaptureChargeParams{
+		ChargeID: chargeID,
+		Amount:   amount,
+	}
+
+	xendit.Opt.SecretKey = repo.base.XenditSecretKey
+	gateway := resilience.GetGateway(resilience.GatewayXendit)
+	chargeResp, err := resilience.Execute(ctx, gateway, false, func(ctx context.Context) (*xendit.CardCharge, error) {
+		chargeResp, errXendit := card.CaptureChargeWithContext(ctx, &params)
+		return chargeResp, xenditError(errXendit)
+	})
+
+	audit.Log(ctx, resilience.GatewayXendit, "capture-card-charge", chargeID, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.generateChargeResult(chargeResp), nil
+}
+
+// VoidCharge release authorized amount that is not yet captured
+func (repo cards) VoidCharge(ctx context.Context, chargeID string) (*models.CardCharges, error) {
+	externalID := repo.base.TransactionUuid
+	if externalID == "" {
+		externalID = chargeID
+	}
+
+	params := card.ReverseAuthorizationParams{
+		ChargeID:   chargeID,
+		ExternalID: externalID,
+	}
+
+	xendit.Opt.SecretKey = repo.base.XenditSecretKey
+	gateway := resilience.GetGateway(resilience.GatewayXendit)
+	reverseResp, err := resilience.Execute(ctx, gateway, false, func(ctx context.Context) (*xendit.CardReverseAuthorization, error) {
+		reverseResp, errXendit := card.ReverseAuthorizationWithContext(ctx, &params)
+		return reverseResp, xenditError(errXendit)
+	})
+
+	audit.Log(ctx, resilience.GatewayXendit, "void-card-charge", chargeID, err)
+	if err != nil {
+		return nil, err
+	}
+
+	status := models.CardStatusPending
+	switch reverseResp.Status {
+	case constants.CardReverseSucceeded:
+		status = models.CardStatusVoided
+	case constants.CardReverseFailed:
+		status = models.CardStatusFailed
+	}
+
+	reverseRespMarshal, _ := json.Marshal(reverseResp)
+	cardCharge := models.CardCharges{
+		TransactionUuid:  repo.base.TransactionUuid,
+		PaymentGatewayID: repo.getPaymentGatewayID(),
+		ChargeID:         reverseResp.CreditCardChargeID,
+		Status:           status,
+		AuthorizedAmount: reverseResp.Amount,
+		Currency:         reverseResp.Currency,
+		ResponseJson:     string(reverseRespMarshal),
+	}
+
+	return &cardCharge, nil
+}
+
+func (repo cards) GetCharge(ctx context.Context, chargeID string) (*models.CardCharges, error) {
+	params := card.GetChargeParams{
+		ChargeID: chargeID,
+	}
+
+	xendit.Opt.SecretKey = repo.base.XenditSecretKey
+	gateway := resilience.GetGateway(resilience.GatewayXendit)
+	chargeResp, err := resilience.Execute(ctx, gateway, true, func(ctx context.Context) (*xendit.CardCharge, error) {
+		chargeResp, errXendit := card.GetChargeWithContext(ctx, &params)
+		return chargeResp, xenditError(errXendit)
+	})
+
+	audit.Log(ctx, resilience.GatewayXendit, "get-card-charge", chargeID, err)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.generateChargeResult(chargeResp), nil
+}
+
+func (repo cards) generateChargeResult(chargeResp *xendit.CardCharge) *models.CardCharges {
+	status := models.CardStatusPending
+	switch chargeResp.Status {
+	case constants.CardChargeAuthorized:
+		status = models.CardStatusAuthorized
+	case constants.CardChargeCaptured:
+		status = models.CardStatusCaptured
+	case constants.CardChargeReversed:
+		status = models.CardStatusVoided
+	case constants.CardChargeFailed:
+		status = models.CardStatusFailed
+	}
+
+	transactionUuid := repo.base.TransactionUuid
+	if transactionUuid == "" {
+		transactionUuid = chargeResp.ExternalID
+	}
+
+	chargeRespMarshal, _ := json.Marshal(chargeResp)
+	cardCharge := models.CardCharges{
+		TransactionUuid:  transactionUuid,
+		PaymentGatewayID: repo.getPaymentGatewayID(),
+		ChargeID:         chargeResp.ID,
+		Status:           status,
+		AuthorizedAmount: chargeResp.AuthorizedAmount,
+		CapturedAmount:   chargeResp.CaptureAmount,
+		Currency:         chargeResp.Currency,
+		CardBrand:        chargeResp.CardBrand,
+		MaskedCardNumber: chargeResp.MaskedCardNumber,
+		FailureReason:    chargeResp.FailureReason,
+		ResponseJson:     string(chargeRespMarshal),
+	}
+
+	return &cardCharge
+}
+
+func (repo cards) generateAuthenticationResult(authentication xenditModels.CardAuthenticationCallback) *models.CardCharges {
+	cardCharge := models.CardCharges{
+		TransactionUuid:   repo.base.TransactionUuid,
+		PaymentGatewayID:  repo.getPaymentGatewayID(),
+		MaskedCardNumber:  authentication.MaskedCardNumber,
+		AuthenticationUrl: authentication.PayerAuthenticationUrl,
+		FailureReason:     authentication.FailureReason,
+	}
+
+	switch authentication.Status {
+	case constants.CardAuthenticationInReview:
+		cardCharge.Status = models.CardStatusRequiresAuthentication
+	default:
+		cardCharge.Status = models.CardStatusFailed
+	}
+
+	return &cardCharge
+}
+
+func (repo cards) getPaymentGatewayID() int8 {
+	if repo.base.TransactionModel == nil {
+		return 0
+	}
+
+	return repo.base.TransactionModel.PaymentGatewayID
+}
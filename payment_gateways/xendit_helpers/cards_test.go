@@ -0,0 +1,213 @@
+package xendit_helpers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/xendit/xendit-go"
+	"github.com/xendit/xendit-go/card"
+
+	"github.com/fari-99/go-helper/payment_gateways/models"
+	"github.com/fari-99/go-helper/payment_gateways/xendit_helpers/constants"
+	xenditModels "github.com/fari-99/go-helper/payment_gateways/xendit_helpers/models"
+)
+
+type cardRequesterMock struct {
+	response    interface{}
+	errorResult *xendit.Error
+	params      *interface{} // optional, request params sent to xendit
+}
+
+func (m cardRequesterMock) Call(ctx context.Context, method string, path string, secretKey string, header http.Header, params interface{}, result interface{}) *xendit.Error {
+	if m.params != nil {
+		*m.params = params
+	}
+
+	if m.errorResult != nil {
+		return m.errorResult
+	}
+
+	responseMarshal, _ := json.Marshal(m.response)
+	_ = json.Unmarshal(responseMarshal, result)
+	return nil
+}
+
+// setTestAPIRequester xendit sdk use global api requester, restored after test
+func setTestAPIRequester(t *testing.T, requester xendit.APIRequester) {
+	original := xendit.GetAPIRequester()
+	xendit.SetAPIRequester(requester)
+	t.Cleanup(func() {
+		xendit.SetAPIRequester(original)
+	})
+}
+
+func getTestCards() Cards {
+	_ = os.Setenv("XENDIT_SECRET_KEY", "secret-key")
+	_ = os.Setenv("XENDIT_VERIFICATION_TOKEN", "verification-token")
+	_ = os.Setenv("XENDIT_REMINDER_UNIT", "hours")
+	_ = os.Setenv("XENDIT_REMINDER_TIME", "1")
+
+	base := NewXenditHelpers("uuid-123456789")
+	base.SetTransactionItems([]models.TransactionItems{
+		{TransactionItemUuid: "item-uuid-123456789", Qty: 1, TotalPrice: 100000},
+	})
+
+	return NewCards(base)
+}
+
+func TestCardChargeAuthorized(t *testing.T) {
+	cardHelper := getTestCards()
+	setTestAPIRequester(t, cardRequesterMock{response: xendit.CardCharge{
+		ID:               "charge-123",
+		Status:           constants.CardChargeAuthorized,
+		AuthorizedAmount: 105000,
+		ExternalID:       "uuid-123456789",
+	}})
+
+	authentication := &xenditModels.CardAuthenticationCallback{ID: "auth-123", Status: constants.CardAuthenticationVerified}
+	cardCharge, err := cardHelper.CreateCharge(context.Background(), CardChargeData{TokenID: "token-123", Authentication: authentication})
+	if err != nil {
+		t.Fail()
+		t.Log(err.Error())
+		return
+	}
+
+	if cardCharge.Status != models.CardStatusAuthorized || cardCharge.ChargeID != "charge-123" {
+		t.Fail()
+		t.Logf("expected authorized charge, got [%s]", cardCharge.Status)
+		return
+	}
+
+	t.Log("success authorize card charge")
+	return
+}
+
+func TestCardChargeRequiresAuthentication(t *testing.T) {
+	cardHelper := getTestCards()
+	setTestAPIRequester(t, cardRequesterMock{errorResult: &xendit.Error{
+		Status:    http.StatusBadRequest,
+		ErrorCode: constants.CardErrorAuthenticationRequired,
+		Message:   "authentication id is required",
+	}})
+
+	cardCharge, err := cardHelper.CreateCharge(context.Background(), CardChargeData{TokenID: "token-123"})
+	if err != nil {
+		t.Fail()
+		t.Log(err.Error())
+		return
+	}
+
+	if cardCharge.Status != models.CardStatusRequiresAuthentication {
+		t.Fail()
+		t.Logf("expected requires authentication, got [%s]", cardCharge.Status)
+		return
+	}
+
+	inReview := &xenditModels.CardAuthenticationCallback{
+		ID:                     "auth-123",
+		Status:                 constants.CardAuthenticationInReview,
+		PayerAuthenticationUrl: "https://example.com/3ds",
+	}
+
+	cardCharge, err = cardHelper.CreateCharge(context.Background(), CardChargeData{TokenID: "token-123", Authentication: inReview})
+	if err != nil {
+		t.Fail()
+		t.Log(err.Error())
+		return
+	}
+
+	if cardCharge.Status != models.CardStatusRequiresAuthentication || cardCharge.AuthenticationUrl != inReview.PayerAuthenticationUrl {
+		t.Fail()
+		t.Log("expected authentication url for card in review")
+		return
+	}
+
+	t.Log("success handle 3DS authentication")
+	return
+}
+
+func TestCardCaptureCharge(t *testing.T) {
+	cardHelper := getTestCards()
+
+	var params interface{}
+	setTestAPIRequester(t, cardRequesterMock{params: &params, response: xendit.CardCharge{
+		ID:            "charge-123",
+		Status:        constants.CardChargeCaptured,
+		CaptureAmount: 50000,
+		ExternalID:    "uuid-123456789",
+	}})
+
+	cardCharge, err := cardHelper.CaptureCharge(context.Background(), "charge-123", 50000)
+	if err != nil {
+		t.Fail()
+		t.Log(err.Error())
+		return
+	}
+
+	if cardCharge.Status != models.CardStatusCaptured || cardCharge.ChargeID != "charge-123" {
+		t.Fail()
+		t.Logf("expected captured charge, got [%s]", cardCharge.Status)
+		return
+	}
+
+	captureParams, ok := params.(*card.CaptureChargeParams)
+	if !ok || captureParams.ChargeID != "charge-123" || captureParams.Amount != 50000 {
+		t.Fail()
+		t.Logf("expected capture amount sent to xendit, got %#v", params)
+		return
+	}
+
+	t.Log("success capture card charge")
+	return
+}
+
+func TestCardVoidCharge(t *testing.T) {
+	cardHelper := getTestCards()
+
+	reverseStatuses := map[string]string{
+		constants.CardReverseSucceeded: models.CardStatusVoided,
+		constants.CardReversePending:   models.CardStatusPending,
+		constants.CardReverseFailed:    models.CardStatusFailed,
+	}
+
+	for reverseStatus, expectedStatus := range reverseStatuses {
+		setTestAPIRequester(t, cardRequesterMock{response: xendit.CardReverseAuthorization{
+			ID:                 "reverse-123",
+			ExternalID:         "uuid-123456789",
+			CreditCardChargeID: "charge-123",
+			Amount:             105000,
+			Status:             reverseStatus,
+		}})
+
+		cardCharge, err := cardHelper.VoidCharge(context.Background(), "charge-123")
+		if err != nil {
+			t.Fail()
+			t.Log(err.Error())
+			return
+		}
+
+		if cardCharge.Status != expectedStatus || cardCharge.ChargeID != "charge-123" {
+			t.Fail()
+			t.Logf("expected [%s] for reverse status [%s], got [%s]", expectedStatus, reverseStatus, cardCharge.Status)
+			return
+		}
+	}
+
+	setTestAPIRequester(t, cardRequesterMock{errorResult: &xendit.Error{
+		Status:    http.StatusNotFound,
+		ErrorCode: "CREDIT_CARD_CHARGE_NOT_FOUND_ERROR",
+		Message:   "charge not found",
+	}})
+
+	if _, err := cardHelper.VoidCharge(context.Background(), "charge-unknown"); err == nil {
+		t.Fail()
+		t.Log("expected error void unknown charge")
+		return
+	}
+
+	t.Log("success void card charge")
+	return
+}
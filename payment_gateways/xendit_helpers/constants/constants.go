@@ -56,3 +56,28 @@ const (
 	InvoicePaid    = "PAID"
 	InvoiceExpired = "EXPIRED"
 )
+
+// Xendit card charge status
+const (
+	CardChargeAuthorized = "AUTHORIZED"
+	CardChargeCaptured   = "CAPTURED"
+	CardChargeReversed   = "REVERSED"
+	CardChargeFailed     = "FAILED"
+)
+
+// Xendit card 3DS authentication status
+const (
+	CardAuthenticationVerified = "VERIFIED"
+	CardAuthenticationInReview = "IN_REVIEW"
+	CardAuthenticationFailed   = "FAILED"
+)
+
+// Xendit card reverse authorization (void) status
+const (
+	CardReverseSucceeded = "SUCCEEDED"
+	CardReversePending   = "PENDING"
+	CardReverseFailed    = "FAILED"
+)
+
+// CardErrorAuthenticationRequired error code when card need 3DS but charge didn't have authentication id
+const CardErrorAuthenticationRequired = "AUTHENTICATION_ID_MISSING_ERROR"
@@ -1,22 +1,26 @@
 package xendit_helpers
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 	"time"
 
 	"github.com/xendit/xendit-go"
 	"github.com/xendit/xendit-go/invoice"
 
+	"github.com/fari-99/go-helper/payment_gateways/audit"
 	"github.com/fari-99/go-helper/payment_gateways/models"
+	"github.com/fari-99/go-helper/payment_gateways/resilience"
 	"github.com/fari-99/go-helper/payment_gateways/xendit_helpers/constants"
 )
 
+// Invoices error from xendit is *xendit.Error, get it using errors.As.
+// other error come from resilience, ex: resilience.ErrCircuitOpen or context.DeadlineExceeded
 type Invoices interface {
-	GetAllInvoices() ([]xendit.Invoice, *xendit.Error)
-	GetInvoiceByID(xenditInvoiceID string) (*xendit.Invoice, *xendit.Error)
-	CreateInvoice() (*models.Invoices, error)
-	CancelInvoice(xenditInvoiceID string) (*xendit.Invoice, *xendit.Error)
+	GetAllInvoices(ctx context.Context) ([]xendit.Invoice, error)
+	GetInvoiceByID(ctx context.Context, xenditInvoiceID string) (*xendit.Invoice, error)
+	CreateInvoice(ctx context.Context) (*models.Invoices, error)
+	CancelInvoice(ctx context.Context, xenditInvoiceID string) (*xendit.Invoice, error)
 }
 
 type invoices struct {
@@ -24,10 +28,11 @@ type invoices struct {
 }
 
 func NewInvoices(base *BaseXenditHelpers) Invoices {
+	setupXenditClient()
 	return invoices{base: base}
 }
 
-func (repo invoices) GetAllInvoices() ([]xendit.Invoice, *xendit.Error) {
+func (repo invoices) GetAllInvoices(ctx context.Context) ([]xendit.Invoice, error) {
 	params := invoice.GetAllParams{
 		ForUserID:          "",
 		Statuses:           nil,
@@ -46,21 +51,33 @@ func (repo invoices) GetAllInvoices() ([]xendit.Invoice, *xendit.Error) {
 	}
 
 	xendit.Opt.SecretKey = repo.base.XenditSecretKey
-	invoiceList, errXendit := invoice.GetAll(&params)
-	return invoiceList, errXendit
+	gateway := resilience.GetGateway(resilience.GatewayXendit)
+	invoiceList, err := resilience.Execute(ctx, gateway, true, func(ctx context.Context) ([]xendit.Invoice, error) {
+		invoiceList, errXendit := invoice.GetAllWithContext(ctx, &params)
+		return invoiceList, xenditError(errXendit)
+	})
+
+	audit.Log(ctx, resilience.GatewayXendit, "get-all-invoices", "", err)
+	return invoiceList, err
 }
 
-func (repo invoices) GetInvoiceByID(xenditInvoiceID string) (*xendit.Invoice, *xendit.Error) {
+func (repo invoices) GetInvoiceByID(ctx context.Context, xenditInvoiceID string) (*xendit.Invoice, error) {
 	params := invoice.GetParams{
 		ID: xenditInvoiceID,
 	}
 
 	xendit.Opt.SecretKey = repo.base.XenditSecretKey
-	invoiceData, errXendit := invoice.Get(&params)
-	return invoiceData, errXendit
+	gateway := resilience.GetGateway(resilience.GatewayXendit)
+	invoiceData, err := resilience.Execute(ctx, gateway, true, func(ctx context.Context) (*xendit.Invoice, error) {
+		invoiceData, errXendit := invoice.GetWithContext(ctx, &params)
+		return invoiceData, xenditError(errXendit)
+	})
+
+	audit.Log(ctx, resilience.GatewayXendit, "get-invoice", xenditInvoiceID, err)
+	return invoiceData, err
 }
 
-func (repo invoices) CreateInvoice() (*models.Invoices, error) {
+func (repo invoices) CreateInvoice(ctx context.Context) (*models.Invoices, error) {
 	transactionUuid := repo.base.TransactionUuid
 	transactionDetails := repo.base.TransactionModel
 
@@ -92,13 +109,19 @@ func (repo invoices) CreateInvoice() (*models.Invoices, error) {
 		Locale:                         "id", // default ID
 		Items:                          xenditInvoiceData.invoiceItems,
 		Fees:                           xenditInvoiceData.additionalFee,
-		// MidLabel:                       "test-mid", // if using credit cards
+		MidLabel:                       repo.base.XenditMidLabel, // if using credit cards
 	}
 
 	xendit.Opt.SecretKey = repo.base.XenditSecretKey
-	invoiceResp, errXendit := invoice.Create(&invoiceParams)
-	if errXendit != nil {
-		return nil, fmt.Errorf(errXendit.Error())
+	gateway := resilience.GetGateway(resilience.GatewayXendit)
+	invoiceResp, err := resilience.Execute(ctx, gateway, false, func(ctx context.Context) (*xendit.Invoice, error) {
+		invoiceResp, errXendit := invoice.CreateWithContext(ctx, &invoiceParams)
+		return invoiceResp, xenditError(errXendit)
+	})
+
+	audit.Log(ctx, resilience.GatewayXendit, "create-invoice", transactionUuid, err)
+	if err != nil {
+		return nil, err
 	}
 
 	invoiceRespMarshal, _ := json.Marshal(invoiceResp)
@@ -118,12 +141,18 @@ func (repo invoices) CreateInvoice() (*models.Invoices, error) {
 	return &invoiceModel, nil
 }
 
-func (repo invoices) CancelInvoice(xenditInvoiceID string) (*xendit.Invoice, *xendit.Error) {
+func (repo invoices) CancelInvoice(ctx context.Context, xenditInvoiceID string) (*xendit.Invoice, error) {
 	params := invoice.ExpireParams{
 		ID: xenditInvoiceID,
 	}
 
 	xendit.Opt.SecretKey = repo.base.XenditSecretKey
-	invoiceData, errXendit := invoice.Expire(&params)
-	return invoiceData, errXendit
+	gateway := resilience.GetGateway(resilience.GatewayXendit)
+	invoiceData, err := resilience.Execute(ctx, gateway, true, func(ctx context.Context) (*xendit.Invoice, error) {
+		invoiceData, errXendit := invoice.ExpireWithContext(ctx, &params)
+		return invoiceData, xenditError(errXendit)
+	})
+
+	audit.Log(ctx, resilience.GatewayXendit, "cancel-invoice", xenditInvoiceID, err)
+	return invoiceData, err
 }
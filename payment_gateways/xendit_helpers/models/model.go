@@ -16,3 +16,20 @@ func (model CallbackHeaders) Validate() error {
 		validation.Field(&model.WebhookID, validation.Required),
 	)
 }
+
+// CardAuthenticationCallback 3DS authentication result from xendit.js or callback XenditCallbackCardAuthentication
+type CardAuthenticationCallback struct {
+	ID                     string `json:"id"`
+	CreditCardTokenID      string `json:"credit_card_token_id"`
+	Status                 string `json:"status"`
+	PayerAuthenticationUrl string `json:"payer_authentication_url"`
+	FailureReason          string `json:"failure_reason"`
+	MaskedCardNumber       string `json:"masked_card_number"`
+}
+
+func (model CardAuthenticationCallback) Validate() error {
+	return validation.ValidateStruct(&model,
+		validation.Field(&model.ID, validation.Required),
+		validation.Field(&model.Status, validation.Required),
+	)
+}
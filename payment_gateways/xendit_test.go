@@ -1,6 +1,7 @@
 package payment_gateways
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -157,7 +158,7 @@ func TestXenditCreateInvoice(t *testing.T) {
 		return
 	}
 
-	invoices, err := CreateInvoice(transactionModel)
+	invoices, err := CreateInvoice(context.Background(), transactionModel)
 	if err != nil {
 		t.Fail()
 		t.Log(err.Error())
@@ -165,6 +166,6 @@ func TestXenditCreateInvoice(t *testing.T) {
 	}
 
 	invoiceMarshal, _ := json.MarshalIndent(invoices, "", " ")
-	log.Printf(string(invoiceMarshal))
+	log.Println(string(invoiceMarshal))
 	return
 }
@@ -2,34 +2,46 @@ package rabbitmq
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+// ErrChannelNotOpen queue is used before connection to rabbitmq is opened
+var ErrChannelNotOpen = errors.New("rabbitmq channel is not open")
+
 type QueueSetup struct {
 	exchangeName string
 	queueName    string
-	connection   *amqp.Connection
-	channel      *amqp.Channel
-	closed       bool
+
+	connectionConfig *ConnectionConfig
+	nextNode         int                // next cluster node to dial
+	manager          *ConnectionManager // nil if queue has their own connection
+	connectionIndex  int                // shared connection used from manager
+	connection       *amqp.Connection
+	channel          *amqp.Channel
+	closed           bool
 
 	errorConnection chan *amqp.Error
 
 	queueConfig    *QueueConfig
-	queueConsumer  ConsumerHandler
+	queueConsumer  DeliveryHandler
+	middlewares    []Middleware
+	dedupStore     IdempotencyStore
 	exchangeConfig *ExchangeConfig
 
 	isPublisher         bool
 	maxReconnectAttempt int
 	reconnectAttempt    int
+	reconnectRunning    int32 // 1 while reconnect goroutine is running, read by rpc client
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -37,6 +49,21 @@ type QueueSetup struct {
 	waitGroup sync.WaitGroup
 
 	customRetry func(delivery amqp.Delivery)
+	retryConfig *RetryConfig
+
+	publishMutex        sync.Mutex   // serialize publish on channel
+	channelMutex        sync.RWMutex // guard connection, channel and publisher confirm replaced on reconnect
+	publisherChannel    publishChannel
+	publisherConfirm    *publisherConfirm
+	publishInterceptors []PublishInterceptor
+	publishBuffer       *publishBuffer
+
+	logger            *slog.Logger
+	silenceMessageLog bool
+
+	metrics         Metrics
+	connectionState int32 // ConnectionState, read by Health from other goroutine
+	totalReconnect  int64
 }
 
 type QueueConfig struct {
@@ -56,6 +83,8 @@ type QueueDeclareConfig struct {
 	Exclusive  bool       // If true, the queue can only be used by the declaring connection
 	NoWait     bool       // If true, the server won't respond to the method (fire-and-forget)
 	Args       amqp.Table // Optional arguments (e.g., message TTL, DLX)
+
+	DeadLetter *DeadLetterConfig // If not nil, dead letter exchange and queue declared before the queue
 }
 
 type QueueBindConfig struct {
@@ -65,18 +94,43 @@ type QueueBindConfig struct {
 }
 
 func NewBaseQueue(exchangeName, queueName string) *QueueSetup {
-	log.Println("Initialize RabbitMQ Queue connection...")
+	return NewBaseQueueWithConfig(exchangeName, queueName, nil)
+}
+
+// NewBaseQueueE same as NewBaseQueue, but return error if connection can't be opened
+func NewBaseQueueE(exchangeName, queueName string) (*QueueSetup, error) {
+	return NewBaseQueueWithConfigE(exchangeName, queueName, nil)
+}
+
+// NewBaseQueueWithConfig nil connection config use DefaultConnectionConfig.
+// open connection error is only logged, connection opened again on AddPublisher or AddConsumer,
+// use NewBaseQueueWithConfigE to get the error
+func NewBaseQueueWithConfig(exchangeName, queueName string, connectionConfig *ConnectionConfig) *QueueSetup {
+	queueSetup, _ := NewBaseQueueWithConfigE(exchangeName, queueName, connectionConfig)
+	return queueSetup
+}
+
+// NewBaseQueueWithConfigE same as NewBaseQueueWithConfig, but return error if connection can't be opened
+func NewBaseQueueWithConfigE(exchangeName, queueName string, connectionConfig *ConnectionConfig) (*QueueSetup, error) {
+	if connectionConfig == nil {
+		connectionConfig = DefaultConnectionConfig()
+	}
+
+	return newQueueSetup(exchangeName, queueName, connectionConfig).setQueueUtil()
+}
+
+func newQueueSetup(exchangeName, queueName string, connectionConfig *ConnectionConfig) *QueueSetup {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	queueSetup := &QueueSetup{
-		exchangeName: exchangeName,
-		ctx:          ctx, // default ctx
-		cancel:       cancel,
+		exchangeName:     exchangeName,
+		connectionConfig: connectionConfig,
+		ctx:              ctx, // default ctx
+		cancel:           cancel,
 	}
 
 	queueSetup.setQueueName(queueName)
-	log.Println("Success Initialize RabbitMQ Queue connection...")
-	return queueSetup.setQueueUtil()
+	return queueSetup
 }
 
 func (base *QueueSetup) SetContext(ctx context.Context) *QueueSetup {
@@ -91,20 +145,15 @@ func (base *QueueSetup) SetCustomRetry(retry func(delivery amqp.Delivery)) *Queu
 	return base
 }
 
-func (base *QueueSetup) setQueueUtil() *QueueSetup {
-	defer func() {
-		if r := recover(); r != nil {
-			fmt.Println("Recovered from panic setup queue, ", r)
-		}
-	}()
-
+// setQueueUtil queue is returned even on error, so builder can open the connection again
+func (base *QueueSetup) setQueueUtil() (*QueueSetup, error) {
 	err := base.openConnection()
 	if err != nil {
-		loggingMessage("error open connection", err.Error())
-		panic(err.Error())
+		base.getLogger().Error("Error open connection", slog.Any("error", err))
+		return base, err
 	}
 
-	return base
+	return base, nil
 }
 
 func (base *QueueSetup) setQueueName(queueName string) *QueueSetup {
@@ -125,15 +174,28 @@ func (base *QueueSetup) setExchangeName() *QueueSetup {
 }
 
 func (base *QueueSetup) declareQueue() error {
+	if base.channel == nil {
+		return ErrChannelNotOpen
+	}
+
 	queueDeclareConfig := base.queueConfig.QueueDeclareConfig
 
+	args := queueDeclareConfig.Args
+	if queueDeclareConfig.DeadLetter != nil {
+		var err error
+		args, err = base.declareDeadLetter(queueDeclareConfig)
+		if err != nil {
+			return err
+		}
+	}
+
 	_, err := base.channel.QueueDeclare(
 		base.queueName,
 		queueDeclareConfig.Durable,
 		queueDeclareConfig.AutoDelete,
 		queueDeclareConfig.Exclusive,
 		queueDeclareConfig.NoWait,
-		queueDeclareConfig.Args,
+		args,
 	)
 
 	if err != nil {
@@ -144,8 +206,10 @@ func (base *QueueSetup) declareQueue() error {
 }
 
 func (base *QueueSetup) Close() {
-	loggingMessage("Closing Connection", nil)
+	logger := base.getLogger()
+	logger.Info("Closing connection")
 	base.closed = true
+	base.setConnectionState(ConnectionStateClosed)
 
 	// get consumer tag
 	var consumerTag string
@@ -154,87 +218,189 @@ func (base *QueueSetup) Close() {
 	}
 
 	// closed channel so didn't get another message
-	if base.channel != nil && consumerTag != "" {
-		_ = base.channel.Cancel(consumerTag, false)
+	channel := base.getChannel()
+	if channel != nil && consumerTag != "" {
+		_ = channel.Cancel(consumerTag, false)
 	}
 
 	cancelFunc := func(connection *amqp.Connection, channel *amqp.Channel) {
 		if channel != nil {
 			err := channel.Close()
 			if err != nil {
-				loggingMessage("Error closing channel", err.Error())
+				logger.Error("Error closing channel", slog.Any("error", err))
 			}
 		}
 
-		if connection != nil {
+		if connection != nil && base.manager == nil { // shared connection closed by manager
 			err := connection.Close()
 			if err != nil {
-				loggingMessage("Error closing connection", err.Error())
+				logger.Error("Error closing connection", slog.Any("error", err))
 			}
 		}
 	}
 
-	if base.queueConfig.QueueConsumerConfig.AutoAck {
-		loggingMessage("waiting for consumer done with their process [AutoAck True]", nil)
+	isAutoAck := base.queueConfig != nil && base.queueConfig.QueueConsumerConfig != nil &&
+		base.queueConfig.QueueConsumerConfig.AutoAck
+	if isAutoAck {
+		logger.Info("Waiting for consumer done with their process", slog.Bool("auto_ack", true))
 		base.waitGroup.Wait() // wait for all process get processed
 		base.cancel()         // cancel all go routine
 	} else {
-		loggingMessage("waiting for consumer done with their process [AutoAck False]", nil)
+		logger.Info("Waiting for consumer done with their process", slog.Bool("auto_ack", false))
 		base.cancel()         // cancel all go routine
 		base.waitGroup.Wait() // wait for all process get processed
 	}
 
-	cancelFunc(base.connection, base.channel) // stop all connection for channel and connection rabbitmq
+	if base.publishBuffer != nil && base.publishBuffer.size() > 0 {
+		logger.Warn("Buffered message is not published", slog.Int("total", base.publishBuffer.size()))
+	}
+
+	cancelFunc(base.getConnection(), base.getChannel()) // stop all connection for channel and connection rabbitmq
+}
+
+// startReconnect reconnect goroutine reopen connection and channel when it's closed
+func (base *QueueSetup) startReconnect() {
+	atomic.StoreInt32(&base.reconnectRunning, 1)
+	go base.reconnect()
+}
+
+// isReconnectRunning false for queue without AddPublisher or AddConsumer, or reconnect already stopped
+func (base *QueueSetup) isReconnectRunning() bool {
+	return atomic.LoadInt32(&base.reconnectRunning) == 1
 }
 
 func (base *QueueSetup) reconnect() {
+	defer atomic.StoreInt32(&base.reconnectRunning, 0)
+
+	var flushPublishBuffer chan struct{}
+	if base.publishBuffer != nil {
+		flushPublishBuffer = base.publishBuffer.flush
+	}
+
+	logger := base.getLogger()
 	for {
 		select {
 		case <-base.ctx.Done():
-			loggingMessage("Reconnect cancelled", nil)
+			logger.Info("Reconnect cancelled")
 			return
+		case <-flushPublishBuffer:
+			base.flushPublishBuffer() // stopped if channel is closed, continue after reconnected
 		case err := <-base.errorConnection:
 			if base.closed {
-				loggingMessage("Reconnect skipped: connection already closed", nil)
+				logger.Info("Reconnect skipped, connection already closed")
 				return
 			}
 
+			if base.publishBuffer != nil {
+				base.publishBuffer.activate()
+			}
+
+			// publisher with buffer keep reconnecting, so buffered message is not kept forever,
+			// attempt is reset after recovered, so only connection lost again before recovered is counted
 			base.reconnectAttempt++
-			if base.isPublisher && base.reconnectAttempt > base.maxReconnectAttempt {
-				loggingMessage("Publisher exceeded max reconnect attempts", nil)
+			if base.isPublisher && base.publishBuffer == nil && base.reconnectAttempt > base.maxReconnectAttempt {
+				logger.Error("Publisher exceeded max reconnect attempts", slog.Int("attempt", base.reconnectAttempt))
+				base.setConnectionState(ConnectionStateClosed)
+				return
+			}
+
+			base.setConnectionState(ConnectionStateReconnecting)
+			atomic.AddInt64(&base.totalReconnect, 1)
+			base.getMetrics().Reconnected(base.queueName, base.getRole())
+
+			logger.Warn("Reconnecting due to error", slog.Any("error", err), slog.Int("attempt", base.reconnectAttempt))
+			if base.isPublisher {
+				if base.recoverPublisher() {
+					base.reconnectAttempt = 0
+					base.flushPublishBuffer()
+				}
+
+				continue
+			}
+
+			if !base.reopenConnection() {
 				return
 			}
 
-			loggingMessage("Reconnecting due to error", err)
-			_ = base.openConnection()
-			if base.exchangeName != "" {
-				base.AddConsumerExchange(true)
-			} else {
-				base.AddConsumer(true)
+			if errDeclare := base.redeclareConsumer(); errDeclare != nil {
+				logger.Error("Error declare consumer on reconnect", slog.Any("error", errDeclare))
+			}
+
+			if errRecover := base.recoverQueueConsumers(); errRecover != nil {
+				logger.Error("Error recover consumer on reconnect", slog.Any("error", errRecover))
+				continue
 			}
 
-			_ = base.recoverQueueConsumers()
+			base.reconnectAttempt = 0
 		}
 	}
 
 }
 
+func (base *QueueSetup) recoverPublisher() bool {
+	if !base.reopenConnection() {
+		return false
+	}
+
+	err := base.declareQueue()
+	if err != nil {
+		base.getLogger().Error("Error declare queue on reconnect publisher", slog.Any("error", err))
+		return false
+	}
+
+	return true
+}
+
+func (base *QueueSetup) redeclareConsumer() error {
+	err := base.declareRetryQueues()
+	if err != nil {
+		return err
+	}
+
+	if base.exchangeName == "" || base.exchangeConfig == nil {
+		return base.declareQueue()
+	}
+
+	err = base.exchangeDeclare()
+	if err != nil {
+		return err
+	}
+
+	err = base.declareQueue()
+	if err != nil {
+		return err
+	}
+
+	return base.bindQueue()
+}
+
 func (base *QueueSetup) recoverQueueConsumers() error {
 	var consumer = base.queueConsumer
 
-	loggingMessage("Recovering queueConsumer...", nil)
+	logger := base.getConsumerLogger()
+	logger.Info("Recovering consumer")
 	messages, err := base.registerQueueConsumer()
 	if err != nil {
 		return err
 	}
 
-	loggingMessage("Consumer recovered! Continuing message processing...", nil)
+	logger.Info("Consumer recovered, continuing message processing")
 	base.executeMessageConsumer(consumer, messages, true)
 	return nil
 }
 
 func (base *QueueSetup) registerQueueConsumer() (<-chan amqp.Delivery, error) {
 	consumerConfig := base.queueConfig.QueueConsumerConfig
+
+	// qos is per channel, need to set again after reconnect
+	if !consumerConfig.AutoAck {
+		base.getConsumerLogger().Debug("Setting up qos", slog.Int("prefetch_count", consumerConfig.PrefetchCount))
+		err := base.channel.Qos(consumerConfig.PrefetchCount, 0, false)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	message, err := base.channel.Consume(
 		base.queueName,
 		consumerConfig.Consumer,
@@ -247,210 +413,333 @@ func (base *QueueSetup) registerQueueConsumer() (<-chan amqp.Delivery, error) {
 	return message, err
 }
 
-func (base *QueueSetup) executeMessageConsumer(consumer ConsumerHandler, deliveries <-chan amqp.Delivery, isRecovery bool) {
+func (base *QueueSetup) executeMessageConsumer(consumer DeliveryHandler, deliveries <-chan amqp.Delivery, isRecovery bool) {
 	if !isRecovery {
 		base.queueConsumer = consumer
 	}
 
-	base.waitGroup.Add(1)
-	go func() {
-		defer base.waitGroup.Done()
+	workers := base.queueConfig.QueueConsumerConfig.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	for worker := 1; worker <= workers; worker++ {
+		base.waitGroup.Add(1)
+		go base.consumeWorker(worker, consumer, deliveries)
+	}
+
+	base.getConsumerLogger().Info("Waiting for messages", slog.Int("workers", workers))
+	return
+}
+
+// consumeWorker every worker take message from the same deliveries, prefetch count limit message taken before ack
+func (base *QueueSetup) consumeWorker(worker int, consumer DeliveryHandler, deliveries <-chan amqp.Delivery) {
+	defer base.waitGroup.Done()
+
+	logger := base.getConsumerLogger().With(slog.Int("worker", worker))
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Recovered from panic on consumer worker", slog.Any("panic", r))
+			go base.Close() // close wait for all workers done, including this one
+		}
+	}()
+
+	logger.Info("Consumer ready", slog.Int("pid", os.Getpid()))
+
+	isAutoAck := base.queueConfig.QueueConsumerConfig.AutoAck
+
+	for {
+		select {
+		case delivery, ok := <-deliveries:
+			if !ok {
+				logger.Info("Deliveries channel closed")
+				return
+			}
+
+			base.handleDelivery(consumer, delivery, isAutoAck)
+		case <-base.ctx.Done():
+			logger.Info("Shutdown signal received, consumer worker exiting")
+			return
+		}
+	}
+}
+
+func (base *QueueSetup) handleDelivery(consumer DeliveryHandler, delivery amqp.Delivery, isAutoAck bool) {
+	logger := base.getDeliveryLogger(delivery)
+	base.logMessage(logger, "Message received")
+
+	metrics := base.getMetrics()
+	metrics.MessageConsumed(base.queueName, base.getRole())
 
+	var handlerErr error
+	func() {
 		defer func() {
 			if r := recover(); r != nil {
-				loggingMessage("Recovered from panic on your queue", r)
-				base.Close()
+				logger.Error("Recovered from panic during message handling", slog.Any("panic", r), slog.String("body", string(delivery.Body)))
+				handlerErr = fmt.Errorf("panic during message handling: %v", r)
 			}
 		}()
 
-		loggingMessage("Consumer Ready", map[string]interface{}{"PID": os.Getpid()})
+		startTime := time.Now()
+		defer func() {
+			metrics.HandlerDuration(base.queueName, base.getRole(), time.Since(startTime))
+		}()
 
-		isAutoAck := base.queueConfig.QueueConsumerConfig.AutoAck
+		handlerErr = consumer(withLogger(base.ctx, logger), delivery)
+	}()
 
-		for {
-			select {
-			case delivery, ok := <-deliveries:
-				if !ok {
-					loggingMessage("Deliveries channel closed", nil)
-					return
-				}
+	action, delay := getHandlerAction(handlerErr)
+	if handlerErr != nil {
+		logger.Warn("Error handling message", slog.Any("error", handlerErr), slog.String("action", action.String()))
+	}
 
-				var handlerData ConsumerHandlerData
-				_ = json.Unmarshal(delivery.Body[:], &handlerData)
-
-				handled := true
-				func() {
-					defer func() {
-						if r := recover(); r != nil {
-							errorData := map[string]interface{}{
-								"panic_message": fmt.Sprintf("%s", r),
-								"handler_data":  handlerData,
-							}
-
-							loggingMessage("Recovered from panic during message handling", errorData)
-							handled = false
-
-							base.handleRetry(delivery, isAutoAck)
-						}
-					}()
-
-					consumer(handlerData)
-				}()
-
-				if !isAutoAck && handled {
-					if err := delivery.Ack(false); err != nil {
-						loggingMessage("Error acknowledging message", err.Error())
-					} else {
-						loggingMessage("Acknowledged message", nil)
-					}
-				}
-			case <-base.ctx.Done():
-				loggingMessage("Shutdown signal received on loop. Exiting.", nil)
-				return
-			}
+	if action == ActionRetry {
+		base.handleRetry(delivery, isAutoAck, delay)
+		return
+	}
+
+	if isAutoAck {
+		if action != ActionAck && action != ActionDrop {
+			logger.Warn("Can't settle message on AutoAck consumer", slog.String("action", action.String()))
 		}
-	}()
 
-	loggingMessage(" [*] Waiting for messages. To exit press CTRL+C", nil)
-	return
+		metrics.MessageSettled(base.queueName, base.getRole(), ActionAck) // already acked by broker
+		return
+	}
+
+	var err error
+	switch action {
+	case ActionAck, ActionDrop:
+		err = delivery.Ack(false)
+	case ActionRequeue:
+		err = delivery.Nack(false, true)
+	case ActionDeadLetter:
+		err = delivery.Reject(false) // This sends to DLX if configured
+	}
+
+	if err != nil {
+		logger.Error("Error settle message", slog.String("action", action.String()), slog.Any("error", err))
+	} else {
+		metrics.MessageSettled(base.queueName, base.getRole(), action)
+		base.logMessage(logger, "Message settled", slog.String("action", action.String()))
+	}
 }
 
 func (base *QueueSetup) openConnection() error {
-	for {
-		loggingMessage("Trying to open rabbitmq connection, please wait...", nil)
-		time.Sleep(5 * time.Second)
-
-		connUrl := fmt.Sprintf("amqp://%s:%s@%s:%s/",
-			os.Getenv("RABBIT_USER"),
-			os.Getenv("RABBIT_PASSWORD"),
-			os.Getenv("RABBIT_HOST"),
-			os.Getenv("RABBIT_PORT"))
-
-		connection, err := amqp.DialConfig(connUrl, amqp.Config{
-			// SASL:            nil,
-			// Vhost:           "",
-			// ChannelMax:      0,
-			// FrameSize:       0,
-			Heartbeat: 10 * time.Second, // default value
-			// TLSClientConfig: nil,
-			// Properties:      nil,
-			// Locale:          "en_US",
-			// Dial:            nil,
-		})
+	if base.manager != nil {
+		return base.openSharedConnection()
+	}
 
-		if err != nil {
-			loggingMessage("Error get config connection to RabbitMq", err.Error())
-			continue
-		}
+	logger := base.getLogger()
+	logger.Info("Opening rabbitmq connection")
+	connection, err := base.connectionConfig.dial(base.ctx, &base.nextNode, logger)
+	if err != nil {
+		return err
+	}
 
-		base.connection = connection
-		base.errorConnection = make(chan *amqp.Error)
-		base.connection.NotifyClose(base.errorConnection)
+	base.setConnection(connection)
+	base.errorConnection = newCloseNotify()
+	connection.NotifyClose(base.errorConnection)
 
-		err = base.openChannel()
-		if err != nil {
-			loggingMessage("Error open channel", err.Error())
-			continue
-		}
+	err = base.openChannel()
+	if err != nil {
+		_ = connection.Close()
+		return err
+	}
+
+	base.setConnectionState(ConnectionStateConnected)
+	logger.Info("Rabbitmq connection established")
+	return nil
+}
+
+// openSharedConnection open new channel on manager connection,
+// channel closed when the connection is closed, so only need to watch the channel
+func (base *QueueSetup) openSharedConnection() error {
+	connection, err := base.manager.getConnection(base.ctx, base.connectionIndex)
+	if err != nil {
+		return err
+	}
 
-		loggingMessage("Connection RabbitMq Established!!", nil)
-		break
+	base.setConnection(connection)
+	err = base.openChannel()
+	if err != nil {
+		return err
 	}
 
+	base.errorConnection = newCloseNotify()
+	base.channel.NotifyClose(base.errorConnection)
+
+	base.setConnectionState(ConnectionStateConnected)
+	base.getLogger().Info("Rabbitmq channel on shared connection established", slog.Int("connection_index", base.connectionIndex))
 	return nil
 }
 
+// newCloseNotify buffered, so amqp close never wait for reader. queue without reconnect (ex: not using AddPublisher
+// or AddConsumer) or publisher that stopped reconnecting didn't read it, and shared connection is closed
+// only after every channel notified
+func newCloseNotify() chan *amqp.Error {
+	return make(chan *amqp.Error, 1)
+}
+
+// ensureConnection only open connection if queue didn't have open channel yet,
+// publisher set up their channel if the channel is opened before AddPublisher
+func (base *QueueSetup) ensureConnection() error {
+	if channel := base.getChannel(); channel != nil && !channel.IsClosed() {
+		if base.isPublisher {
+			return base.setupPublisherChannel(channel)
+		}
+
+		return nil
+	}
+
+	return base.openConnection()
+}
+
+// reopenConnection keep dialing until connected or queue closed, every dial is bounded by DialPolicy,
+// wait using DialPolicy backoff before dial again, so error returned immediately (ex: invalid uri) didn't spin
+func (base *QueueSetup) reopenConnection() bool {
+	for attempt := 1; ; attempt++ {
+		err := base.openConnection()
+		if err == nil {
+			return true
+		}
+
+		base.getLogger().Error("Error reopen rabbitmq connection", slog.Any("error", err), slog.Int("attempt", attempt))
+		select {
+		case <-base.ctx.Done():
+			return false
+		case <-time.After(base.connectionConfig.DialPolicy.reopenBackoff(attempt)):
+		}
+	}
+}
+
+// openChannel publisher confirm mode and notify listener is per channel,
+// so publisher channel and confirm is replaced together after confirm is set up
 func (base *QueueSetup) openChannel() error {
-	channel, err := base.connection.Channel()
+	channel, err := base.getConnection().Channel()
 	if err != nil {
 		return err
 	}
 
+	var confirm *publisherConfirm
+	if base.isPublisher {
+		confirm, err = base.newPublisherConfirm(channel)
+		if err != nil {
+			_ = channel.Close()
+			return err
+		}
+	}
+
+	base.channelMutex.Lock()
 	base.channel = channel
+	base.publisherChannel = channel
+	base.publisherConfirm = confirm
+	base.channelMutex.Unlock()
 	return nil
 }
 
+func (base *QueueSetup) setConnection(connection *amqp.Connection) {
+	base.channelMutex.Lock()
+	base.connection = connection
+	base.channelMutex.Unlock()
+}
+
+// getConnection connection is replaced on reconnect, read it using channelMutex
+func (base *QueueSetup) getConnection() *amqp.Connection {
+	base.channelMutex.RLock()
+	defer base.channelMutex.RUnlock()
+	return base.connection
+}
+
+// newChannel open other channel on queue connection, return amqp.ErrClosed if connection is not open
+func (base *QueueSetup) newChannel() (*amqp.Channel, error) {
+	connection := base.getConnection()
+	if connection == nil || connection.IsClosed() {
+		return nil, amqp.ErrClosed
+	}
+
+	return connection.Channel()
+}
+
+// getChannel channel is replaced on reconnect, read it using channelMutex
+func (base *QueueSetup) getChannel() *amqp.Channel {
+	base.channelMutex.RLock()
+	defer base.channelMutex.RUnlock()
+	return base.channel
+}
+
 func (base *QueueSetup) WaitForSignalAndShutdown() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
-	loggingMessage("Received shutdown signal", nil)
+	base.getLogger().Info("Received shutdown signal")
 	base.Close()
 }
 
-func (base *QueueSetup) handleRetry(delivery amqp.Delivery, isAutoAck bool) {
+// handleRetry use retry queues if configured (see SetupRetry),
+// default retry republish message with x-retry header immediately and ignore the delay
+func (base *QueueSetup) handleRetry(delivery amqp.Delivery, isAutoAck bool, delay time.Duration) {
 	if base.customRetry != nil {
 		base.customRetry(delivery)
+		base.getMetrics().MessageSettled(base.queueName, base.getRole(), ActionRetry)
+		return
+	}
+
+	logger := base.getDeliveryLogger(delivery)
+	channel := base.getChannel()
+	if channel == nil || channel.IsClosed() {
+		logger.Error("Channel already closed, can't retry message")
 		return
 	}
 
-	if base.channel == nil || base.channel.IsClosed() {
-		loggingMessage("Channel already closed, can't retry", nil)
+	if base.retryConfig != nil {
+		base.retryWithQueues(delivery, isAutoAck, delay)
 		return
 	}
 
 	const maxRetry = 3
 
-	retryCount := 0
-	if val, ok := delivery.Headers["x-retry"]; ok {
-		switch v := val.(type) {
-		case int32:
-			retryCount = int(v)
-		case int64:
-			retryCount = int(v)
-		case int:
-			retryCount = v
-		case float64:
-			retryCount = int(v)
-		}
-	}
+	retryCount := getRetryCount(delivery.Headers)
 	retryCount++
 
 	if retryCount <= maxRetry {
-		loggingMessage(fmt.Sprintf("Retrying message (attempt %d)", retryCount), nil)
-
-		headers := delivery.Headers
-		if headers == nil {
-			headers = amqp.Table{}
-		}
-		headers["x-retry"] = retryCount
+		base.logMessage(logger, "Retrying message", slog.Int("retry", retryCount))
 
-		err := base.channel.Publish(
+		headers := getRetryHeaders(delivery.Headers, retryCount)
+		err := channel.Publish(
 			"", // default exchange (same queue)
 			delivery.RoutingKey,
 			false,
 			false,
-			amqp.Publishing{
-				Headers:      headers,
-				ContentType:  delivery.ContentType,
-				Body:         delivery.Body,
-				DeliveryMode: delivery.DeliveryMode,
-				Timestamp:    time.Now(),
-			},
+			deliveryToPublishing(delivery, headers),
 		)
 
 		if err != nil {
-			loggingMessage("Failed to republish message", err.Error())
+			logger.Error("Failed to republish message", slog.Any("error", err))
 		}
 
-		if !isAutoAck {
-			_ = delivery.Reject(false) // drop the original (we requeued manually)
+		if isAutoAck {
+			if err == nil {
+				base.getMetrics().MessageSettled(base.queueName, base.getRole(), ActionRetry)
+			}
+
+			return
+		}
+
+		if err != nil {
+			_ = delivery.Nack(false, true) // keep the message, redelivered immediately
+			base.getMetrics().MessageSettled(base.queueName, base.getRole(), ActionRequeue)
+			return
 		}
 
+		_ = delivery.Ack(false) // drop the original (we requeued manually), reject will send it to DLX
+		base.getMetrics().MessageSettled(base.queueName, base.getRole(), ActionRetry)
 	} else {
-		loggingMessage(fmt.Sprintf("Exceeded max retries (%d). Sending to DLX", maxRetry), nil)
+		logger.Warn("Exceeded max retries, sending to dead letter exchange", slog.Int("max_retry", maxRetry))
+		base.getMetrics().MessageSettled(base.queueName, base.getRole(), ActionDeadLetter)
 
 		if !isAutoAck {
 			_ = delivery.Reject(false) // This sends to DLX if configured
 		}
 	}
 }
-
-func loggingMessage(message string, data interface{}) {
-	if data != nil {
-		dataMarshal, _ := json.Marshal(data)
-		message += fmt.Sprintf(", Data := %s", string(dataMarshal))
-	}
-
-	log.Println(message)
-}
@@ -0,0 +1,37 @@
+package rabbitmq
+
+import "context"
+
+/*
+MessageBroker publish and consume surface of QueueSetup, depend on this interface
+so the test can use queue from NewMemoryBroker instead of live rabbitmq
+
+	Example
+	type OrderService struct {
+		queue rabbitmq.MessageBroker
+	}
+
+	// production
+	service := OrderService{queue: NewBaseQueue("", "order-created").AddPublisher(nil, nil)}
+
+	// test
+	broker := NewMemoryBroker()
+	service := OrderService{queue: broker.Queue("", "order-created")}
+*/
+type MessageBroker interface {
+	Publish(message string) error
+	PublishWithContext(ctx context.Context, message string) error
+	PublishWithOptions(ctx context.Context, message string, options *PublishOptions) error
+	BatchPublish(messages []string) []error
+	BatchPublishWithResults(ctx context.Context, messages []string) []PublishResult
+	BatchPublishWithOptions(ctx context.Context, messages []string, options *PublishOptions) []PublishResult
+	Consume(consumer ConsumerHandler)
+	ConsumeWithError(consumer MessageHandler)
+	ConsumeDelivery(consumer DeliveryHandler)
+	Close()
+}
+
+var (
+	_ MessageBroker = (*QueueSetup)(nil)
+	_ MessageBroker = (*MemoryQueue)(nil)
+)
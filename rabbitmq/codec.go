@@ -0,0 +1,62 @@
+package rabbitmq
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+const (
+	ContentTypeJSON = "application/json"
+	ContentTypeGob  = "application/x-gob"
+)
+
+// Codec encode and decode message body, content type is set on published message
+type Codec interface {
+	ContentType() string
+	Encode(value interface{}) ([]byte, error)
+	Decode(data []byte, value interface{}) error
+}
+
+type jsonCodec struct{}
+
+func NewJSONCodec() Codec {
+	return jsonCodec{}
+}
+
+func (codec jsonCodec) ContentType() string {
+	return ContentTypeJSON
+}
+
+func (codec jsonCodec) Encode(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (codec jsonCodec) Decode(data []byte, value interface{}) error {
+	return json.Unmarshal(data, value)
+}
+
+// gobCodec binary encoding, publisher and consumer need to use the same Go type
+type gobCodec struct{}
+
+func NewGobCodec() Codec {
+	return gobCodec{}
+}
+
+func (codec gobCodec) ContentType() string {
+	return ContentTypeGob
+}
+
+func (codec gobCodec) Encode(value interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := gob.NewEncoder(&buffer).Encode(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func (codec gobCodec) Decode(data []byte, value interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(value)
+}
@@ -0,0 +1,173 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var ErrConnectionManagerClosed = errors.New("rabbitmq connection manager already closed")
+
+/*
+ConnectionManager share one or a few connections between many publishers and consumers,
+every QueueSetup created by the manager use their own channel on the shared connection.
+When connection lost, the manager dial once and every queue reopen their channel, declaration and consumer
+
+	Example
+	manager := NewConnectionManager(nil, 2) // 2 connections, queue distributed on round-robin
+	defer manager.Close()
+
+	orderPublisher := manager.NewQueue("", "order-created").
+		AddPublisher(nil, nil)
+
+	paymentConsumer := manager.NewQueue("", "payment-paid").
+		SetupQueue(nil, nil).
+		AddConsumer(false)
+	paymentConsumer.Consume(handler)
+*/
+type ConnectionManager struct {
+	connectionConfig *ConnectionConfig
+
+	mutex       sync.Mutex
+	dialMutexes []sync.Mutex // per connection, so dial didn't block queues on other connection
+	connections []*amqp.Connection
+	nextNode    int // next cluster node to dial
+	totalQueue  int
+	queues      []*QueueSetup
+	closed      bool
+
+	logger  *slog.Logger
+	metrics Metrics
+}
+
+// NewConnectionManager nil connection config use DefaultConnectionConfig, connection is opened when first queue is created
+func NewConnectionManager(connectionConfig *ConnectionConfig, totalConnection int) *ConnectionManager {
+	if connectionConfig == nil {
+		connectionConfig = DefaultConnectionConfig()
+	}
+
+	if totalConnection <= 0 {
+		totalConnection = 1
+	}
+
+	return &ConnectionManager{
+		connectionConfig: connectionConfig,
+		dialMutexes:      make([]sync.Mutex, totalConnection),
+		connections:      make([]*amqp.Connection, totalConnection),
+	}
+}
+
+// SetLogger nil logger use slog.Default, logger is also used by queue created after this
+func (manager *ConnectionManager) SetLogger(logger *slog.Logger) *ConnectionManager {
+	manager.logger = logger
+	return manager
+}
+
+func (manager *ConnectionManager) getLogger() *slog.Logger {
+	if manager.logger == nil {
+		return slog.Default()
+	}
+
+	return manager.logger
+}
+
+// SetMetrics metrics is also used by queue created after this, see QueueSetup.SetMetrics
+func (manager *ConnectionManager) SetMetrics(metrics Metrics) *ConnectionManager {
+	manager.metrics = metrics
+	return manager
+}
+
+// NewQueue same as NewBaseQueue, but using shared connection
+func (manager *ConnectionManager) NewQueue(exchangeName, queueName string) *QueueSetup {
+	queueSetup, _ := manager.NewQueueE(exchangeName, queueName)
+	return queueSetup
+}
+
+// NewQueueE same as NewQueue, but return error if channel can't be opened
+func (manager *ConnectionManager) NewQueueE(exchangeName, queueName string) (*QueueSetup, error) {
+	manager.mutex.Lock()
+	connectionIndex := manager.totalQueue % len(manager.connections)
+	manager.totalQueue++
+	manager.mutex.Unlock()
+
+	queueSetup := newQueueSetup(exchangeName, queueName, manager.connectionConfig)
+	queueSetup.manager = manager
+	queueSetup.connectionIndex = connectionIndex
+	queueSetup.logger = manager.logger
+	queueSetup.metrics = manager.metrics
+
+	manager.mutex.Lock()
+	manager.queues = append(manager.queues, queueSetup)
+	manager.mutex.Unlock()
+
+	return queueSetup.setQueueUtil()
+}
+
+// getConnection return opened connection, or dial new connection if closed,
+// queues waiting for the same connection get the new connection after dial is done,
+// dial is stopped when ctx of the queue dialing is done
+func (manager *ConnectionManager) getConnection(ctx context.Context, connectionIndex int) (*amqp.Connection, error) {
+	dialMutex := &manager.dialMutexes[connectionIndex]
+	dialMutex.Lock()
+	defer dialMutex.Unlock()
+
+	manager.mutex.Lock()
+	closed := manager.closed
+	connection := manager.connections[connectionIndex]
+	nextNode := manager.nextNode
+	manager.mutex.Unlock()
+
+	if closed {
+		return nil, ErrConnectionManagerClosed
+	}
+
+	if connection != nil && !connection.IsClosed() {
+		return connection, nil
+	}
+
+	connection, err := manager.connectionConfig.dial(ctx, &nextNode, manager.getLogger())
+
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	manager.nextNode = nextNode
+	if err != nil {
+		return nil, err
+	}
+
+	if manager.closed { // closed while dialing
+		_ = connection.Close()
+		return nil, ErrConnectionManagerClosed
+	}
+
+	manager.connections[connectionIndex] = connection
+	return connection, nil
+}
+
+// Close close every queue created by the manager, then close the shared connections
+func (manager *ConnectionManager) Close() {
+	manager.mutex.Lock()
+	queues := manager.queues
+	manager.queues = nil
+	manager.mutex.Unlock()
+
+	for _, queue := range queues {
+		queue.Close()
+	}
+
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	manager.closed = true
+	for _, connection := range manager.connections {
+		if connection != nil && !connection.IsClosed() {
+			err := connection.Close()
+			if err != nil {
+				manager.getLogger().Error("Error closing shared connection", slog.Any("error", err))
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConnectionManagerDistributeQueue(t *testing.T) {
+	connectionConfig := &ConnectionConfig{
+		Hosts:      []string{"127.0.0.1:1"},
+		DialPolicy: DialPolicy{MaxAttempts: 1, InitialBackoff: time.Millisecond},
+	}
+
+	manager := NewConnectionManager(connectionConfig, 2)
+
+	for i := 0; i < 3; i++ {
+		manager.NewQueue("", "test-queue") // channel not opened, rabbitmq unavailable
+	}
+
+	var connectionIndexes []int
+	for _, queue := range manager.queues {
+		connectionIndexes = append(connectionIndexes, queue.connectionIndex)
+	}
+
+	if len(connectionIndexes) != 3 || connectionIndexes[0] != 0 || connectionIndexes[1] != 1 || connectionIndexes[2] != 0 {
+		t.Fail()
+		t.Logf("expected queue distributed on round-robin, got %v", connectionIndexes)
+		return
+	}
+
+	manager.Close()
+	_, err := manager.getConnection(context.Background(), 0)
+	if !errors.Is(err, ErrConnectionManagerClosed) {
+		t.Fail()
+		t.Logf("expected closed manager error, got %v", err)
+		return
+	}
+
+	t.Log("success distribute queue on shared connections")
+	return
+}
+
+func TestConnectionManagerDialNotBlockOtherConnection(t *testing.T) {
+	connectionConfig := &ConnectionConfig{
+		Hosts:      []string{"127.0.0.1:1"},
+		DialPolicy: DialPolicy{MaxAttempts: 1, InitialBackoff: time.Millisecond},
+	}
+
+	manager := NewConnectionManager(connectionConfig, 2)
+	manager.dialMutexes[0].Lock() // connection 0 still dialing
+	defer manager.dialMutexes[0].Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := manager.getConnection(context.Background(), 1)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fail()
+			t.Log("expected error dial unavailable rabbitmq")
+			return
+		}
+	case <-time.After(time.Second):
+		t.Fail()
+		t.Log("expected dial connection 1 not waiting for connection 0")
+		return
+	}
+
+	t.Log("success dial connection without blocking other connection")
+	return
+}
@@ -0,0 +1,75 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+)
+
+type HealthStatus struct {
+	Queue            string `json:"queue"`
+	Exchange         string `json:"exchange"`
+	State            string `json:"state"`
+	Healthy          bool   `json:"healthy"` // connected and channel is open
+	Reconnects       int64  `json:"reconnects"`
+	BufferedMessages int    `json:"buffered_messages"` // message waiting on publish buffer, see PublishBufferConfig
+}
+
+// Health current connection state of the queue, safe to call from other goroutine
+func (base *QueueSetup) Health() HealthStatus {
+	state := base.getConnectionState()
+	status := HealthStatus{
+		Queue:      base.queueName,
+		Exchange:   base.exchangeName,
+		State:      state.String(),
+		Reconnects: atomic.LoadInt64(&base.totalReconnect),
+	}
+
+	base.channelMutex.RLock()
+	isChannelOpen := base.channel != nil && !base.channel.IsClosed()
+	base.channelMutex.RUnlock()
+
+	status.Healthy = state == ConnectionStateConnected && isChannelOpen
+	if base.publishBuffer != nil {
+		status.BufferedMessages = base.publishBuffer.size()
+	}
+
+	return status
+}
+
+/*
+HealthHandler readiness probe handler, response 200 if every queue is healthy, otherwise 503.
+response body is json array of HealthStatus
+
+	Example
+	http.Handle("/ready", HealthHandler(orderPublisher, paymentConsumer))
+*/
+func HealthHandler(queues ...*QueueSetup) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		statusCode := http.StatusOK
+		statuses := make([]HealthStatus, 0, len(queues))
+		for _, queue := range queues {
+			status := queue.Health()
+			if !status.Healthy {
+				statusCode = http.StatusServiceUnavailable
+			}
+
+			statuses = append(statuses, status)
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+		writer.WriteHeader(statusCode)
+		_ = json.NewEncoder(writer).Encode(statuses)
+	})
+}
+
+func (base *QueueSetup) getConnectionState() ConnectionState {
+	return ConnectionState(atomic.LoadInt32(&base.connectionState))
+}
+
+func (base *QueueSetup) setConnectionState(state ConnectionState) {
+	previous := atomic.SwapInt32(&base.connectionState, int32(state))
+	if ConnectionState(previous) != state {
+		base.reportConnectionState()
+	}
+}
@@ -0,0 +1,51 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestQueueSetupHealth(t *testing.T) {
+	metrics := NewMetricsCollector(nil)
+	queueSetup := getTestConsumerQueue(nil).SetMetrics(metrics)
+
+	status := queueSetup.Health()
+	if status.Healthy || status.State != ConnectionStateConnecting.String() {
+		t.Fail()
+		t.Logf("expected unhealthy connecting queue, got %+v", status)
+		return
+	}
+
+	queueSetup.Close()
+	if state := queueSetup.Health().State; state != ConnectionStateClosed.String() {
+		t.Fail()
+		t.Logf("expected closed state, got [%s]", state)
+		return
+	}
+
+	if state := metrics.Snapshot()["test-queue/consumer"].ConnectionState; state != ConnectionStateClosed.String() {
+		t.Fail()
+		t.Logf("expected closed state reported to metrics, got [%s]", state)
+		return
+	}
+
+	recorder := httptest.NewRecorder()
+	HealthHandler(queueSetup).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fail()
+		t.Logf("expected status code %d, got %d", http.StatusServiceUnavailable, recorder.Code)
+		return
+	}
+
+	var statuses []HealthStatus
+	if err := json.Unmarshal(recorder.Body.Bytes(), &statuses); err != nil || len(statuses) != 1 || statuses[0].Queue != "test-queue" {
+		t.Fail()
+		t.Logf("expected health status of test-queue, got [%s]", recorder.Body.String())
+		return
+	}
+
+	t.Log("success report queue health")
+	return
+}
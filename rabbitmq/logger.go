@@ -0,0 +1,87 @@
+package rabbitmq
+
+import (
+	"context"
+	"log/slog"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const contextKeyLogger contextKey = "rabbitmq-logger"
+
+/*
+SetLogger nil logger use slog.Default, queue and exchange name added on every log.
+log for every published and handled message use debug level, see SetMessageLog
+
+	Example
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	queue := NewBaseQueue("", "invoice-paid").
+		SetLogger(logger).
+		SetupQueue(nil, nil).
+		AddConsumer(false)
+*/
+func (base *QueueSetup) SetLogger(logger *slog.Logger) *QueueSetup {
+	base.logger = logger
+	return base
+}
+
+// SetMessageLog If false, log for every published and handled message is not written even on debug level, default true
+func (base *QueueSetup) SetMessageLog(enabled bool) *QueueSetup {
+	base.silenceMessageLog = !enabled
+	return base
+}
+
+func (base *QueueSetup) getLogger() *slog.Logger {
+	logger := base.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return logger.With(slog.String("queue", base.queueName), slog.String("exchange", base.exchangeName))
+}
+
+func (base *QueueSetup) getConsumerLogger() *slog.Logger {
+	logger := base.getLogger()
+	if base.queueConfig != nil && base.queueConfig.QueueConsumerConfig != nil {
+		logger = logger.With(slog.String("consumer_tag", base.queueConfig.QueueConsumerConfig.Consumer))
+	}
+
+	return logger
+}
+
+// getDeliveryLogger attempt is total retry before this delivery, 0 for first delivery
+func (base *QueueSetup) getDeliveryLogger(delivery amqp.Delivery) *slog.Logger {
+	return base.getConsumerLogger().With(
+		slog.Uint64("delivery_tag", delivery.DeliveryTag),
+		slog.String("message_id", delivery.MessageId),
+		slog.String("routing_key", delivery.RoutingKey),
+		slog.Int("attempt", getRetryCount(delivery.Headers)),
+	)
+}
+
+// logMessage debug log for every message, silenced using SetMessageLog
+func (base *QueueSetup) logMessage(logger *slog.Logger, message string, args ...interface{}) {
+	if base.silenceMessageLog {
+		return
+	}
+
+	logger.Debug(message, args...)
+}
+
+func withLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return context.WithValue(ctx, contextKeyLogger, logger)
+}
+
+// LoggerFromContext logger on consumer handler context have queue, exchange, consumer tag, delivery tag,
+// message id and attempt field, return slog.Default if not called from consumer handler
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKeyLogger).(*slog.Logger); ok {
+		return logger
+	}
+
+	return slog.Default()
+}
@@ -0,0 +1,77 @@
+package rabbitmq
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestLoggerFromConsumerContext(t *testing.T) {
+	var output bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&output, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	queueSetup := getTestConsumerQueue(&ConsumerConfig{Consumer: "consumer-1"}).SetLogger(logger)
+
+	acknowledger := &testAcknowledger{}
+	delivery := getTestDelivery(acknowledger, 1, "order-created")
+	delivery.MessageId = "message-1"
+
+	queueSetup.handleDelivery(func(ctx context.Context, delivery amqp.Delivery) error {
+		LoggerFromContext(ctx).Info("Handling order")
+		return nil
+	}, delivery, false)
+
+	var handlerLog string
+	for _, line := range strings.Split(output.String(), "\n") {
+		if strings.Contains(line, "Handling order") {
+			handlerLog = line
+		}
+	}
+
+	expectedFields := []string{"queue=test-queue", "consumer_tag=consumer-1", "delivery_tag=1", "message_id=message-1", "attempt=0"}
+	for _, field := range expectedFields {
+		if !strings.Contains(handlerLog, field) {
+			t.Fail()
+			t.Logf("expected field [%s] on handler log, got [%s]", field, handlerLog)
+			return
+		}
+	}
+
+	if !strings.Contains(output.String(), "Message received") {
+		t.Fail()
+		t.Log("expected debug log for received message")
+		return
+	}
+
+	t.Log("success log with consumer context fields")
+	return
+}
+
+func TestLoggerSilenceMessageLog(t *testing.T) {
+	var output bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&output, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	queueSetup := getTestConsumerQueue(nil).SetLogger(logger).SetMessageLog(false)
+
+	acknowledger := &testAcknowledger{}
+	queueSetup.handleDelivery(func(ctx context.Context, delivery amqp.Delivery) error {
+		return nil
+	}, getTestDelivery(acknowledger, 1, "order-created"), false)
+
+	if output.Len() != 0 {
+		t.Fail()
+		t.Logf("expected message log silenced, got [%s]", output.String())
+		return
+	}
+
+	if len(acknowledger.acked) != 1 {
+		t.Fail()
+		t.Log("expected message acked")
+		return
+	}
+
+	t.Log("success silence message log")
+	return
+}
@@ -0,0 +1,593 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type memoryBinding struct {
+	queue      string
+	routingKey string
+	args       amqp.Table
+}
+
+type memoryMessage struct {
+	exchange    string
+	routingKey  string
+	msg         amqp.Publishing
+	redelivered bool
+}
+
+type memoryQueueState struct {
+	name    string
+	args    amqp.Table
+	ready   []memoryMessage
+	unacked map[uint64]memoryMessage
+	notify  chan struct{}
+}
+
+/*
+MemoryBroker rabbitmq replacement for unit test, support direct, fanout, topic and headers exchange,
+ack, nack, reject with requeue (redelivered) and dead letter exchange using x-dead-letter-exchange queue args.
+message is not persisted and delivered to consumer without prefetch limit
+
+	Example
+	broker := NewMemoryBroker()
+	_ = broker.DeclareExchange("order", amqp.ExchangeTopic)
+	_ = broker.DeclareQueue("invoice-order-created", nil)
+	_ = broker.BindQueue("invoice-order-created", "order.*.created", "order", nil)
+
+	broker.Queue("", "invoice-order-created").ConsumeWithError(handler)
+	_ = broker.Publish(ctx, "order", "order.retail.created", amqp.Publishing{Body: body})
+*/
+type MemoryBroker struct {
+	mutex       sync.Mutex
+	exchanges   map[string]string // exchange name to kind
+	bindings    map[string][]memoryBinding
+	queues      map[string]*memoryQueueState
+	deliveryTag uint64
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		exchanges: make(map[string]string),
+		bindings:  make(map[string][]memoryBinding),
+		queues:    make(map[string]*memoryQueueState),
+	}
+}
+
+// DeclareExchange redeclare with different kind return error, same as rabbitmq
+func (broker *MemoryBroker) DeclareExchange(name, kind string) error {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	switch kind {
+	case amqp.ExchangeDirect, amqp.ExchangeFanout, amqp.ExchangeTopic, amqp.ExchangeHeaders:
+	default:
+		return fmt.Errorf("exchange kind [%s] is not supported", kind)
+	}
+
+	if declaredKind, ok := broker.exchanges[name]; ok && declaredKind != kind {
+		return fmt.Errorf("exchange [%s] already declared with kind [%s]", name, declaredKind)
+	}
+
+	broker.exchanges[name] = kind
+	return nil
+}
+
+// DeclareQueue args only used for x-dead-letter-exchange and x-dead-letter-routing-key
+func (broker *MemoryBroker) DeclareQueue(name string, args amqp.Table) error {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	broker.declareQueue(name, args)
+	return nil
+}
+
+func (broker *MemoryBroker) declareQueue(name string, args amqp.Table) *memoryQueueState {
+	if queue, ok := broker.queues[name]; ok {
+		return queue
+	}
+
+	queue := &memoryQueueState{
+		name:    name,
+		args:    args,
+		unacked: make(map[uint64]memoryMessage),
+		notify:  make(chan struct{}, 1),
+	}
+
+	broker.queues[name] = queue
+	return queue
+}
+
+func (broker *MemoryBroker) BindQueue(queue, routingKey, exchange string, args amqp.Table) error {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	if _, ok := broker.exchanges[exchange]; !ok {
+		return fmt.Errorf("exchange [%s] not found", exchange)
+	}
+
+	if _, ok := broker.queues[queue]; !ok {
+		return fmt.Errorf("queue [%s] not found", queue)
+	}
+
+	broker.bindings[exchange] = append(broker.bindings[exchange], memoryBinding{queue: queue, routingKey: routingKey, args: args})
+	return nil
+}
+
+// Publish empty exchange route message to queue with the same name as routing key,
+// unroutable message is dropped same as rabbitmq without mandatory
+func (broker *MemoryBroker) Publish(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) error {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	return broker.publish(exchange, routingKey, msg)
+}
+
+func (broker *MemoryBroker) publish(exchange, routingKey string, msg amqp.Publishing) error {
+	queueNames, err := broker.route(exchange, routingKey, msg.Headers)
+	if err != nil {
+		return err
+	}
+
+	for _, queueName := range queueNames {
+		broker.enqueue(broker.queues[queueName], memoryMessage{exchange: exchange, routingKey: routingKey, msg: msg}, false)
+	}
+
+	return nil
+}
+
+func (broker *MemoryBroker) route(exchange, routingKey string, headers amqp.Table) ([]string, error) {
+	if exchange == "" {
+		if _, ok := broker.queues[routingKey]; !ok {
+			return nil, nil
+		}
+
+		return []string{routingKey}, nil
+	}
+
+	kind, ok := broker.exchanges[exchange]
+	if !ok {
+		return nil, fmt.Errorf("exchange [%s] not found", exchange)
+	}
+
+	var queueNames []string
+	routed := make(map[string]bool)
+	for _, binding := range broker.bindings[exchange] {
+		if routed[binding.queue] || !isBindingMatch(kind, binding, routingKey, headers) {
+			continue
+		}
+
+		routed[binding.queue] = true
+		queueNames = append(queueNames, binding.queue)
+	}
+
+	return queueNames, nil
+}
+
+func isBindingMatch(kind string, binding memoryBinding, routingKey string, headers amqp.Table) bool {
+	switch kind {
+	case amqp.ExchangeFanout:
+		return true
+	case amqp.ExchangeTopic:
+		return isTopicMatch(strings.Split(binding.routingKey, "."), strings.Split(routingKey, "."))
+	case amqp.ExchangeHeaders:
+		return isHeadersMatch(binding.args, headers)
+	default:
+		return binding.routingKey == routingKey
+	}
+}
+
+// isTopicMatch "*" match exactly one word, "#" match zero or more words
+func isTopicMatch(pattern, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+
+	if pattern[0] == "#" {
+		for idx := 0; idx <= len(words); idx++ {
+			if isTopicMatch(pattern[1:], words[idx:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(words) == 0 || (pattern[0] != "*" && pattern[0] != words[0]) {
+		return false
+	}
+
+	return isTopicMatch(pattern[1:], words[1:])
+}
+
+// isHeadersMatch x-match "all" (default) or "any", argument starting with "x-" is ignored
+func isHeadersMatch(args, headers amqp.Table) bool {
+	matchAny := fmt.Sprint(args["x-match"]) == "any"
+
+	total, matched := 0, 0
+	for key, value := range args {
+		if strings.HasPrefix(key, "x-") {
+			continue
+		}
+
+		total++
+		headerValue, ok := headers[key]
+		if ok && (value == nil || fmt.Sprint(value) == fmt.Sprint(headerValue)) {
+			matched++
+		}
+	}
+
+	if matchAny {
+		return matched > 0
+	}
+
+	return matched == total
+}
+
+func (broker *MemoryBroker) enqueue(queue *memoryQueueState, message memoryMessage, isFront bool) {
+	if isFront {
+		queue.ready = append([]memoryMessage{message}, queue.ready...)
+	} else {
+		queue.ready = append(queue.ready, message)
+	}
+
+	select {
+	case queue.notify <- struct{}{}:
+	default:
+	}
+}
+
+// next take ready message and keep it as unacked until acked, return false if queue is empty
+func (broker *MemoryBroker) next(queueName string) (amqp.Delivery, bool) {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	queue := broker.queues[queueName]
+	if len(queue.ready) == 0 {
+		return amqp.Delivery{}, false
+	}
+
+	message := queue.ready[0]
+	queue.ready = queue.ready[1:]
+	if len(queue.ready) > 0 { // wake other consumer
+		select {
+		case queue.notify <- struct{}{}:
+		default:
+		}
+	}
+
+	broker.deliveryTag++
+	queue.unacked[broker.deliveryTag] = message
+
+	// every delivery have their own headers, same message can be routed to multiple queues
+	var headers amqp.Table
+	if message.msg.Headers != nil {
+		headers = amqp.Table{}
+		for key, value := range message.msg.Headers {
+			headers[key] = value
+		}
+	}
+
+	msg := message.msg
+	return amqp.Delivery{
+		Acknowledger:    &memoryAcknowledger{broker: broker, queue: queueName},
+		Headers:         headers,
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    msg.DeliveryMode,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationId,
+		ReplyTo:         msg.ReplyTo,
+		Expiration:      msg.Expiration,
+		MessageId:       msg.MessageId,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		UserId:          msg.UserId,
+		AppId:           msg.AppId,
+		DeliveryTag:     broker.deliveryTag,
+		Redelivered:     message.redelivered,
+		Exchange:        message.exchange,
+		RoutingKey:      message.routingKey,
+		Body:            msg.Body,
+	}, true
+}
+
+// settle ack, requeue or dead-letter unacked messages, multiple settle every unacked tag up to deliveryTag
+func (broker *MemoryBroker) settle(queueName string, deliveryTag uint64, multiple, requeue, isAck bool) error {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	queue := broker.queues[queueName]
+
+	var tags []uint64
+	if multiple {
+		for tag := range queue.unacked {
+			if tag <= deliveryTag {
+				tags = append(tags, tag)
+			}
+		}
+	} else if _, ok := queue.unacked[deliveryTag]; ok {
+		tags = append(tags, deliveryTag)
+	}
+
+	if len(tags) == 0 {
+		return fmt.Errorf("unknown delivery tag [%d] on queue [%s]", deliveryTag, queueName)
+	}
+
+	for _, tag := range tags {
+		message := queue.unacked[tag]
+		delete(queue.unacked, tag)
+
+		switch {
+		case isAck:
+		case requeue:
+			message.redelivered = true
+			broker.enqueue(queue, message, true)
+		default:
+			broker.deadLetter(queue, message)
+		}
+	}
+
+	return nil
+}
+
+// deadLetter route rejected message using queue x-dead-letter-exchange, dropped if not configured
+func (broker *MemoryBroker) deadLetter(queue *memoryQueueState, message memoryMessage) {
+	exchange, ok := queue.args["x-dead-letter-exchange"].(string)
+	if !ok {
+		return
+	}
+
+	routingKey := message.routingKey
+	if deadLetterRoutingKey, ok := queue.args["x-dead-letter-routing-key"].(string); ok {
+		routingKey = deadLetterRoutingKey
+	}
+
+	headers := amqp.Table{}
+	for key, value := range message.msg.Headers {
+		headers[key] = value
+	}
+
+	headers[HeaderDeath] = []interface{}{amqp.Table{
+		"queue":        queue.name,
+		"reason":       "rejected",
+		"count":        int64(1),
+		"exchange":     message.exchange,
+		"routing-keys": []interface{}{message.routingKey},
+		"time":         time.Now(),
+	}}
+
+	msg := message.msg
+	msg.Headers = headers
+	if err := broker.publish(exchange, routingKey, msg); err != nil {
+		slog.Error("Error dead-letter message on memory broker", slog.String("queue", queue.name), slog.Any("error", err))
+	}
+}
+
+// MessageCount ready message on queue, not including unacked message
+func (broker *MemoryBroker) MessageCount(queueName string) int {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	queue, ok := broker.queues[queueName]
+	if !ok {
+		return 0
+	}
+
+	return len(queue.ready)
+}
+
+// UnackedCount message delivered to consumer but not acked yet
+func (broker *MemoryBroker) UnackedCount(queueName string) int {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	queue, ok := broker.queues[queueName]
+	if !ok {
+		return 0
+	}
+
+	return len(queue.unacked)
+}
+
+type memoryAcknowledger struct {
+	broker *MemoryBroker
+	queue  string
+}
+
+func (ack *memoryAcknowledger) Ack(tag uint64, multiple bool) error {
+	return ack.broker.settle(ack.queue, tag, multiple, false, true)
+}
+
+func (ack *memoryAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	return ack.broker.settle(ack.queue, tag, multiple, requeue, false)
+}
+
+func (ack *memoryAcknowledger) Reject(tag uint64, requeue bool) error {
+	return ack.broker.settle(ack.queue, tag, false, requeue, false)
+}
+
+/*
+MemoryQueue implement MessageBroker using MemoryBroker, publish and consume behave like QueueSetup:
+publish to exchange name using queue name as routing key, returned error by handler decide
+ack, requeue, retry (republished immediately, max 3 attempts) or dead-letter, see MessageHandler
+*/
+type MemoryQueue struct {
+	broker       *MemoryBroker
+	exchangeName string
+	queueName    string
+	publishMsg   amqp.Publishing
+	middlewares  []Middleware
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	waitGroup sync.WaitGroup
+}
+
+// Queue declare the queue if not declared yet, exchange need to be declared using DeclareExchange
+func (broker *MemoryBroker) Queue(exchangeName, queueName string) *MemoryQueue {
+	broker.mutex.Lock()
+	broker.declareQueue(queueName, nil)
+	broker.mutex.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &MemoryQueue{
+		broker:       broker,
+		exchangeName: exchangeName,
+		queueName:    queueName,
+		publishMsg:   amqp.Publishing{ContentType: ContentTypeJSON, DeliveryMode: amqp.Transient},
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+}
+
+// Use add middleware for consumer handler, call before Consume
+func (queue *MemoryQueue) Use(middlewares ...Middleware) *MemoryQueue {
+	queue.middlewares = append(queue.middlewares, middlewares...)
+	return queue
+}
+
+func (queue *MemoryQueue) Publish(message string) error {
+	return queue.PublishWithContext(queue.ctx, message)
+}
+
+func (queue *MemoryQueue) PublishWithContext(ctx context.Context, message string) error {
+	return queue.PublishWithOptions(ctx, message, nil)
+}
+
+func (queue *MemoryQueue) PublishWithOptions(ctx context.Context, message string, options *PublishOptions) error {
+	return queue.BatchPublishWithOptions(ctx, []string{message}, options)[0].Err
+}
+
+func (queue *MemoryQueue) BatchPublish(messages []string) []error {
+	var listErr []error
+	for _, result := range queue.BatchPublishWithResults(queue.ctx, messages) {
+		if result.Err != nil {
+			listErr = append(listErr, result.Err)
+		}
+	}
+
+	return listErr
+}
+
+func (queue *MemoryQueue) BatchPublishWithResults(ctx context.Context, messages []string) []PublishResult {
+	return queue.BatchPublishWithOptions(ctx, messages, nil)
+}
+
+func (queue *MemoryQueue) BatchPublishWithOptions(ctx context.Context, messages []string, options *PublishOptions) []PublishResult {
+	msgs := make([]amqp.Publishing, len(messages))
+	for idx, message := range messages {
+		msgs[idx] = queue.publishMsg
+		msgs[idx].Timestamp = time.Now()
+		msgs[idx].Body = []byte(message)
+		options.apply(&msgs[idx])
+		if len(messages) > 1 {
+			msgs[idx].MessageId = "" // every message need their own id
+		}
+	}
+	assignMessageID(msgs)
+
+	routingKey := options.getRoutingKey(queue.queueName)
+	results := make([]PublishResult, len(msgs))
+	for idx, msg := range msgs {
+		err := queue.broker.Publish(ctx, queue.exchangeName, routingKey, msg)
+		results[idx] = PublishResult{Index: idx, MessageID: msg.MessageId, Err: err}
+	}
+
+	return results
+}
+
+func (queue *MemoryQueue) Consume(consumer ConsumerHandler) {
+	queue.ConsumeWithError(AdaptConsumerHandler(consumer))
+}
+
+func (queue *MemoryQueue) ConsumeWithError(consumer MessageHandler) {
+	queue.ConsumeDelivery(newDeliveryHandler(consumer))
+}
+
+// ConsumeDelivery every call add one consumer goroutine
+func (queue *MemoryQueue) ConsumeDelivery(consumer DeliveryHandler) {
+	consumer = chainMiddlewares(consumer, queue.middlewares)
+
+	queue.waitGroup.Add(1)
+	go func() {
+		defer queue.waitGroup.Done()
+
+		queue.broker.mutex.Lock()
+		notify := queue.broker.queues[queue.queueName].notify
+		queue.broker.mutex.Unlock()
+
+		for {
+			delivery, ok := queue.broker.next(queue.queueName)
+			if ok {
+				queue.handleDelivery(consumer, delivery)
+				continue
+			}
+
+			select {
+			case <-notify:
+			case <-queue.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (queue *MemoryQueue) handleDelivery(consumer DeliveryHandler, delivery amqp.Delivery) {
+	var handlerErr error
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				handlerErr = fmt.Errorf("panic during message handling: %v", r)
+			}
+		}()
+
+		handlerErr = consumer(queue.ctx, delivery)
+	}()
+
+	action, _ := getHandlerAction(handlerErr)
+	switch action {
+	case ActionAck, ActionDrop:
+		_ = delivery.Ack(false)
+	case ActionRequeue:
+		_ = delivery.Nack(false, true)
+	case ActionDeadLetter:
+		_ = delivery.Reject(false)
+	case ActionRetry:
+		const maxRetry = 3
+
+		retryCount := getRetryCount(delivery.Headers) + 1
+		if retryCount > maxRetry {
+			_ = delivery.Reject(false)
+			return
+		}
+
+		headers := amqp.Table{}
+		for key, value := range delivery.Headers {
+			headers[key] = value
+		}
+		headers[HeaderRetry] = retryCount
+
+		err := queue.broker.Publish(queue.ctx, "", queue.queueName, deliveryToPublishing(delivery, headers))
+		if err != nil {
+			_ = delivery.Nack(false, true)
+			return
+		}
+
+		_ = delivery.Ack(false)
+	}
+}
+
+// Close stop consumers, message on queue is kept
+func (queue *MemoryQueue) Close() {
+	queue.cancel()
+	queue.waitGroup.Wait()
+}
@@ -0,0 +1,187 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func waitMemoryCondition(condition func() bool) bool {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	return false
+}
+
+func TestMemoryBrokerRouting(t *testing.T) {
+	ctx := context.Background()
+	broker := NewMemoryBroker()
+
+	_ = broker.DeclareExchange("order-direct", amqp.ExchangeDirect)
+	_ = broker.DeclareExchange("order-fanout", amqp.ExchangeFanout)
+	_ = broker.DeclareExchange("order-topic", amqp.ExchangeTopic)
+	_ = broker.DeclareExchange("order-headers", amqp.ExchangeHeaders)
+	for _, queueName := range []string{"direct", "fanout-1", "fanout-2", "topic-star", "topic-hash", "headers-all", "headers-any"} {
+		_ = broker.DeclareQueue(queueName, nil)
+	}
+
+	_ = broker.BindQueue("direct", "order.created", "order-direct", nil)
+	_ = broker.BindQueue("fanout-1", "", "order-fanout", nil)
+	_ = broker.BindQueue("fanout-2", "", "order-fanout", nil)
+	_ = broker.BindQueue("topic-star", "order.*.created", "order-topic", nil)
+	_ = broker.BindQueue("topic-hash", "order.#", "order-topic", nil)
+	_ = broker.BindQueue("headers-all", "", "order-headers", amqp.Table{"x-match": "all", "event_type": "order-created", "region": "id"})
+	_ = broker.BindQueue("headers-any", "", "order-headers", amqp.Table{"x-match": "any", "event_type": "order-created", "region": "id"})
+
+	_ = broker.Publish(ctx, "order-direct", "order.created", amqp.Publishing{})
+	_ = broker.Publish(ctx, "order-direct", "order.paid", amqp.Publishing{})
+	_ = broker.Publish(ctx, "order-fanout", "anything", amqp.Publishing{})
+	_ = broker.Publish(ctx, "order-topic", "order.retail.created", amqp.Publishing{})
+	_ = broker.Publish(ctx, "order-topic", "order.retail.bulk.created", amqp.Publishing{})
+	_ = broker.Publish(ctx, "order-headers", "", amqp.Publishing{Headers: amqp.Table{"event_type": "order-created", "region": "id"}})
+	_ = broker.Publish(ctx, "order-headers", "", amqp.Publishing{Headers: amqp.Table{"event_type": "order-created", "region": "sg"}})
+
+	expected := map[string]int{
+		"direct":      1,
+		"fanout-1":    1,
+		"fanout-2":    1,
+		"topic-star":  1,
+		"topic-hash":  2,
+		"headers-all": 1,
+		"headers-any": 2,
+	}
+
+	for queueName, total := range expected {
+		if broker.MessageCount(queueName) != total {
+			t.Fail()
+			t.Logf("expected %d message on [%s], got %d", total, queueName, broker.MessageCount(queueName))
+			return
+		}
+	}
+
+	if err := broker.Publish(ctx, "not-declared", "order.created", amqp.Publishing{}); err == nil {
+		t.Fail()
+		t.Log("expected error publish to undeclared exchange")
+		return
+	}
+
+	t.Log("success route message using every exchange kind")
+	return
+}
+
+func TestMemoryQueueConsume(t *testing.T) {
+	broker := NewMemoryBroker()
+	_ = broker.DeclareExchange("order.dlx", amqp.ExchangeFanout)
+	_ = broker.DeclareQueue("order.dlq", nil)
+	_ = broker.BindQueue("order.dlq", "", "order.dlx", nil)
+	_ = broker.DeclareQueue("order", amqp.Table{"x-dead-letter-exchange": "order.dlx"})
+
+	var queue MessageBroker = broker.Queue("", "order")
+	defer queue.Close()
+
+	var mutex sync.Mutex
+	calls := make(map[string][]bool) // event type to redelivered flag for every call
+	queue.ConsumeDelivery(func(ctx context.Context, delivery amqp.Delivery) error {
+		handlerData := ConsumerHandlerData{}
+		_ = NewJSONCodec().Decode(delivery.Body, &handlerData)
+
+		mutex.Lock()
+		calls[handlerData.EventType] = append(calls[handlerData.EventType], delivery.Redelivered)
+		totalCall := len(calls[handlerData.EventType])
+		mutex.Unlock()
+
+		switch handlerData.EventType {
+		case "order-requeued":
+			if totalCall == 1 {
+				return Requeue(errors.New("stock service unavailable"))
+			}
+		case "order-retried":
+			return errors.New("payment service unavailable")
+		case "order-invalid":
+			return DeadLetter(errors.New("invalid order"))
+		}
+
+		return nil
+	})
+
+	for _, eventType := range []string{"order-created", "order-requeued", "order-retried", "order-invalid"} {
+		body, _ := NewJSONCodec().Encode(ConsumerHandlerData{EventType: eventType})
+		if err := queue.Publish(string(body)); err != nil {
+			t.Fail()
+			t.Log(err.Error())
+			return
+		}
+	}
+
+	isDone := waitMemoryCondition(func() bool {
+		return broker.MessageCount("order.dlq") == 2 && broker.MessageCount("order") == 0 && broker.UnackedCount("order") == 0
+	})
+	if !isDone {
+		t.Fail()
+		t.Logf("expected 2 dead-lettered message, got %d", broker.MessageCount("order.dlq"))
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if len(calls["order-requeued"]) != 2 || calls["order-requeued"][0] || !calls["order-requeued"][1] {
+		t.Fail()
+		t.Logf("expected requeued message redelivered once, got %v", calls["order-requeued"])
+		return
+	}
+
+	// first attempt and 3 retries before dead-lettered
+	if len(calls["order-retried"]) != 4 || len(calls["order-created"]) != 1 || len(calls["order-invalid"]) != 1 {
+		t.Fail()
+		t.Logf("unexpected handler calls %v", calls)
+		return
+	}
+
+	deadLetters, _ := broker.next("order.dlq")
+	if _, ok := deadLetters.Headers[HeaderDeath]; !ok {
+		t.Fail()
+		t.Log("expected dead-lettered message have x-death header")
+		return
+	}
+
+	t.Log("success consume message using memory broker")
+	return
+}
+
+func TestIsTopicMatch(t *testing.T) {
+	cases := []struct {
+		pattern    string
+		routingKey string
+		expected   bool
+	}{
+		{"order.*", "order.created", true},
+		{"order.*", "order.retail.created", false},
+		{"order.#", "order", true},
+		{"#.created", "order.retail.created", true},
+		{"order.#.created", "order.created", true},
+		{"*.created", "created", false},
+	}
+
+	for _, testCase := range cases {
+		if isTopicMatch(strings.Split(testCase.pattern, "."), strings.Split(testCase.routingKey, ".")) != testCase.expected {
+			t.Fail()
+			t.Logf("expected [%s] match [%s] %t", testCase.pattern, testCase.routingKey, testCase.expected)
+			return
+		}
+	}
+
+	t.Log("success match topic routing key")
+	return
+}
@@ -0,0 +1,319 @@
+package rabbitmq
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type ConnectionState int32
+
+const (
+	ConnectionStateConnecting   ConnectionState = iota // connection not opened yet
+	ConnectionStateConnected                           // channel opened and ready
+	ConnectionStateReconnecting                        // connection lost, reconnect goroutine is dialing
+	ConnectionStateClosed                              // closed by Close or reconnect stopped
+)
+
+func (state ConnectionState) String() string {
+	switch state {
+	case ConnectionStateConnecting:
+		return "connecting"
+	case ConnectionStateConnected:
+		return "connected"
+	case ConnectionStateReconnecting:
+		return "reconnecting"
+	case ConnectionStateClosed:
+		return "closed"
+	default:
+		return fmt.Sprintf("unknown state [%d]", state)
+	}
+}
+
+const (
+	RolePublisher = "publisher"
+	RoleConsumer  = "consumer"
+)
+
+// Metrics called by consumer and connection of every queue, implementation must be safe for concurrent use.
+// role is RolePublisher or RoleConsumer, so publisher and consumer on the same queue didn't share the metrics.
+// see NewMetricsCollector for in-memory implementation, or implement it using your metrics client
+type Metrics interface {
+	MessageConsumed(queue, role string)
+	MessageSettled(queue, role string, action HandlerAction) // ack, drop, requeue, retry and dead-letter (including parking lot)
+	HandlerDuration(queue, role string, duration time.Duration)
+	Reconnected(queue, role string) // called on every reconnect attempt
+	ConnectionStateChanged(queue, role string, state ConnectionState)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) MessageConsumed(queue, role string)                               {}
+func (noopMetrics) MessageSettled(queue, role string, action HandlerAction)          {}
+func (noopMetrics) HandlerDuration(queue, role string, duration time.Duration)       {}
+func (noopMetrics) Reconnected(queue, role string)                                   {}
+func (noopMetrics) ConnectionStateChanged(queue, role string, state ConnectionState) {}
+
+// DefaultLatencyBuckets handler duration histogram buckets in seconds
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// QueueMetrics snapshot of one queue metrics, Latency.Counts is cumulative for every bucket
+type QueueMetrics struct {
+	Queue           string           `json:"queue"`
+	Role            string           `json:"role"`
+	Consumed        uint64           `json:"consumed"`
+	Acked           uint64           `json:"acked"` // including dropped message
+	Nacked          uint64           `json:"nacked"`
+	Retried         uint64           `json:"retried"`
+	DeadLettered    uint64           `json:"dead_lettered"`
+	Reconnects      uint64           `json:"reconnects"`
+	ConnectionState string           `json:"connection_state"`
+	Latency         LatencyHistogram `json:"latency"`
+}
+
+type LatencyHistogram struct {
+	Buckets []float64 `json:"buckets"`
+	Counts  []uint64  `json:"counts"`
+	Count   uint64    `json:"count"`
+	Sum     float64   `json:"sum"` // in seconds
+}
+
+func (histogram *LatencyHistogram) observe(seconds float64) {
+	for idx, bucket := range histogram.Buckets {
+		if seconds <= bucket {
+			histogram.Counts[idx]++
+		}
+	}
+
+	histogram.Count++
+	histogram.Sum += seconds
+}
+
+/*
+MetricsCollector in-memory Metrics, exported as prometheus text format (see ServeHTTP) or expvar (see PublishExpvar)
+
+	Example
+	metrics := NewMetricsCollector(nil)
+	metrics.PublishExpvar("rabbitmq") // available on /debug/vars
+	http.Handle("/metrics", metrics)
+
+	queue := NewBaseQueue("", "invoice-paid").
+		SetMetrics(metrics).
+		SetupQueue(nil, nil).
+		AddConsumer(false)
+*/
+type MetricsCollector struct {
+	buckets []float64
+
+	mutex  sync.Mutex
+	queues map[string]*QueueMetrics // key "<queue>/<role>"
+}
+
+// NewMetricsCollector nil buckets use DefaultLatencyBuckets
+func NewMetricsCollector(buckets []float64) *MetricsCollector {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &MetricsCollector{
+		buckets: buckets,
+		queues:  make(map[string]*QueueMetrics),
+	}
+}
+
+// getQueue must be called with mutex locked
+func (collector *MetricsCollector) getQueue(queue, role string) *QueueMetrics {
+	key := queue + "/" + role
+	queueMetrics, ok := collector.queues[key]
+	if !ok {
+		queueMetrics = &QueueMetrics{
+			Queue:           queue,
+			Role:            role,
+			ConnectionState: ConnectionStateConnecting.String(),
+			Latency: LatencyHistogram{
+				Buckets: collector.buckets,
+				Counts:  make([]uint64, len(collector.buckets)),
+			},
+		}
+		collector.queues[key] = queueMetrics
+	}
+
+	return queueMetrics
+}
+
+func (collector *MetricsCollector) MessageConsumed(queue, role string) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	collector.getQueue(queue, role).Consumed++
+}
+
+func (collector *MetricsCollector) MessageSettled(queue, role string, action HandlerAction) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	queueMetrics := collector.getQueue(queue, role)
+	switch action {
+	case ActionAck, ActionDrop:
+		queueMetrics.Acked++
+	case ActionRequeue:
+		queueMetrics.Nacked++
+	case ActionRetry:
+		queueMetrics.Retried++
+	case ActionDeadLetter:
+		queueMetrics.DeadLettered++
+	}
+}
+
+func (collector *MetricsCollector) HandlerDuration(queue, role string, duration time.Duration) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	collector.getQueue(queue, role).Latency.observe(duration.Seconds())
+}
+
+func (collector *MetricsCollector) Reconnected(queue, role string) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	collector.getQueue(queue, role).Reconnects++
+}
+
+func (collector *MetricsCollector) ConnectionStateChanged(queue, role string, state ConnectionState) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	collector.getQueue(queue, role).ConnectionState = state.String()
+}
+
+// Snapshot copy metrics of every queue, key is "<queue>/<role>", ex: "order-created/publisher"
+func (collector *MetricsCollector) Snapshot() map[string]QueueMetrics {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	snapshot := make(map[string]QueueMetrics, len(collector.queues))
+	for key, queueMetrics := range collector.queues {
+		queueSnapshot := *queueMetrics
+		queueSnapshot.Latency.Counts = append([]uint64(nil), queueMetrics.Latency.Counts...)
+		snapshot[key] = queueSnapshot
+	}
+
+	return snapshot
+}
+
+// PublishExpvar publish snapshot as expvar, panic if the name already published (same as expvar.Publish)
+func (collector *MetricsCollector) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return collector.Snapshot()
+	}))
+}
+
+// WritePrometheus write metrics using prometheus text exposition format
+func (collector *MetricsCollector) WritePrometheus(writer io.Writer) error {
+	snapshot := collector.Snapshot()
+
+	keys := make([]string, 0, len(snapshot))
+	for key := range snapshot {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var builder strings.Builder
+	counters := []struct {
+		name  string
+		help  string
+		value func(queueMetrics QueueMetrics) uint64
+	}{
+		{"rabbitmq_messages_consumed_total", "Total messages received by consumer.", func(queueMetrics QueueMetrics) uint64 { return queueMetrics.Consumed }},
+		{"rabbitmq_messages_acked_total", "Total messages acked, including dropped messages.", func(queueMetrics QueueMetrics) uint64 { return queueMetrics.Acked }},
+		{"rabbitmq_messages_nacked_total", "Total messages nacked and requeued.", func(queueMetrics QueueMetrics) uint64 { return queueMetrics.Nacked }},
+		{"rabbitmq_messages_retried_total", "Total messages retried.", func(queueMetrics QueueMetrics) uint64 { return queueMetrics.Retried }},
+		{"rabbitmq_messages_dead_lettered_total", "Total messages dead-lettered or sent to parking lot queue.", func(queueMetrics QueueMetrics) uint64 { return queueMetrics.DeadLettered }},
+		{"rabbitmq_reconnects_total", "Total reconnect attempts.", func(queueMetrics QueueMetrics) uint64 { return queueMetrics.Reconnects }},
+	}
+
+	for _, counter := range counters {
+		fmt.Fprintf(&builder, "# HELP %s %s\n# TYPE %s counter\n", counter.name, counter.help, counter.name)
+		for _, key := range keys {
+			fmt.Fprintf(&builder, "%s{%s} %d\n", counter.name, snapshot[key].labels(), counter.value(snapshot[key]))
+		}
+	}
+
+	builder.WriteString("# HELP rabbitmq_connection_state Current connection state, 1 for the active state.\n# TYPE rabbitmq_connection_state gauge\n")
+	states := []ConnectionState{ConnectionStateConnecting, ConnectionStateConnected, ConnectionStateReconnecting, ConnectionStateClosed}
+	for _, key := range keys {
+		for _, state := range states {
+			value := 0
+			if snapshot[key].ConnectionState == state.String() {
+				value = 1
+			}
+
+			fmt.Fprintf(&builder, "rabbitmq_connection_state{%s,state=%q} %d\n", snapshot[key].labels(), state.String(), value)
+		}
+	}
+
+	builder.WriteString("# HELP rabbitmq_handler_duration_seconds Consumer handler duration.\n# TYPE rabbitmq_handler_duration_seconds histogram\n")
+	for _, key := range keys {
+		labels := snapshot[key].labels()
+		latency := snapshot[key].Latency
+		for idx, bucket := range latency.Buckets {
+			fmt.Fprintf(&builder, "rabbitmq_handler_duration_seconds_bucket{%s,le=\"%g\"} %d\n", labels, bucket, latency.Counts[idx])
+		}
+
+		fmt.Fprintf(&builder, "rabbitmq_handler_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, latency.Count)
+		fmt.Fprintf(&builder, "rabbitmq_handler_duration_seconds_sum{%s} %g\n", labels, latency.Sum)
+		fmt.Fprintf(&builder, "rabbitmq_handler_duration_seconds_count{%s} %d\n", labels, latency.Count)
+	}
+
+	_, err := io.WriteString(writer, builder.String())
+	return err
+}
+
+func (queueMetrics QueueMetrics) labels() string {
+	return fmt.Sprintf("queue=%q,role=%q", queueMetrics.Queue, queueMetrics.Role)
+}
+
+// ServeHTTP serve prometheus text format, so the collector can be used as /metrics handler
+func (collector *MetricsCollector) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = collector.WritePrometheus(writer)
+}
+
+// SetMetrics nil metrics disable metrics, current connection state is reported immediately if role is known
+func (base *QueueSetup) SetMetrics(metrics Metrics) *QueueSetup {
+	base.metrics = metrics
+	base.reportConnectionState()
+	return base
+}
+
+// getRole RolePublisher after AddPublisher, RoleConsumer after SetupQueue, empty before that
+func (base *QueueSetup) getRole() string {
+	switch {
+	case base.isPublisher:
+		return RolePublisher
+	case base.queueConfig != nil && base.queueConfig.QueueConsumerConfig != nil:
+		return RoleConsumer
+	default:
+		return ""
+	}
+}
+
+// reportConnectionState connection state is only reported after role is known,
+// so queue that become publisher is not reported as other role
+func (base *QueueSetup) reportConnectionState() {
+	if role := base.getRole(); role != "" {
+		base.getMetrics().ConnectionStateChanged(base.queueName, role, base.getConnectionState())
+	}
+}
+
+func (base *QueueSetup) getMetrics() Metrics {
+	if base.metrics == nil {
+		return noopMetrics{}
+	}
+
+	return base.metrics
+}
@@ -0,0 +1,107 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestMetricsCollectorHandleDelivery(t *testing.T) {
+	metrics := NewMetricsCollector([]float64{0.001, 1})
+	queueSetup := getTestConsumerQueue(nil).SetMetrics(metrics)
+
+	handler := func(ctx context.Context, delivery amqp.Delivery) error {
+		switch delivery.DeliveryTag {
+		case 2:
+			return Requeue(errors.New("requeue"))
+		case 3:
+			return DeadLetter(errors.New("dead-letter"))
+		case 4:
+			return Drop(errors.New("drop"))
+		}
+
+		return nil
+	}
+
+	acknowledger := &testAcknowledger{}
+	for deliveryTag := uint64(1); deliveryTag <= 4; deliveryTag++ {
+		queueSetup.handleDelivery(handler, getTestDelivery(acknowledger, deliveryTag, "order-created"), false)
+	}
+
+	queueMetrics := metrics.Snapshot()["test-queue/consumer"]
+	expected := QueueMetrics{Consumed: 4, Acked: 2, Nacked: 1, DeadLettered: 1}
+	if queueMetrics.Consumed != expected.Consumed || queueMetrics.Acked != expected.Acked ||
+		queueMetrics.Nacked != expected.Nacked || queueMetrics.DeadLettered != expected.DeadLettered {
+		t.Fail()
+		t.Logf("expected metrics %+v, got %+v", expected, queueMetrics)
+		return
+	}
+
+	if queueMetrics.Latency.Count != 4 || queueMetrics.Latency.Counts[1] != 4 {
+		t.Fail()
+		t.Logf("expected 4 handler duration observed, got %+v", queueMetrics.Latency)
+		return
+	}
+
+	// publisher on the same queue didn't overwrite consumer connection state
+	publisher := getTestPublisherQueue(nil)
+	publisher.queueName = "test-queue"
+	publisher.isPublisher = true
+	publisher.SetMetrics(metrics).setConnectionState(ConnectionStateReconnecting)
+	consumerState := metrics.Snapshot()["test-queue/consumer"].ConnectionState
+	publisherState := metrics.Snapshot()["test-queue/publisher"].ConnectionState
+	if consumerState != ConnectionStateConnecting.String() || publisherState != ConnectionStateReconnecting.String() {
+		t.Fail()
+		t.Logf("expected connection state per role, got consumer [%s] publisher [%s]", consumerState, publisherState)
+		return
+	}
+
+	t.Log("success collect consumer metrics")
+	return
+}
+
+func TestMetricsCollectorWritePrometheus(t *testing.T) {
+	metrics := NewMetricsCollector([]float64{0.1, 1})
+	metrics.MessageConsumed("order-created", RoleConsumer)
+	metrics.MessageSettled("order-created", RoleConsumer, ActionRetry)
+	metrics.HandlerDuration("order-created", RoleConsumer, 500*time.Millisecond)
+	metrics.Reconnected("order-created", RoleConsumer)
+	metrics.ConnectionStateChanged("order-created", RoleConsumer, ConnectionStateReconnecting)
+	metrics.ConnectionStateChanged("order-created", RolePublisher, ConnectionStateConnected)
+
+	var output strings.Builder
+	if err := metrics.WritePrometheus(&output); err != nil {
+		t.Fail()
+		t.Log(err.Error())
+		return
+	}
+
+	expectedLines := []string{
+		`rabbitmq_messages_consumed_total{queue="order-created",role="consumer"} 1`,
+		`rabbitmq_messages_retried_total{queue="order-created",role="consumer"} 1`,
+		`rabbitmq_reconnects_total{queue="order-created",role="consumer"} 1`,
+		`rabbitmq_reconnects_total{queue="order-created",role="publisher"} 0`,
+		`rabbitmq_connection_state{queue="order-created",role="consumer",state="reconnecting"} 1`,
+		`rabbitmq_connection_state{queue="order-created",role="consumer",state="connected"} 0`,
+		`rabbitmq_connection_state{queue="order-created",role="publisher",state="connected"} 1`,
+		`rabbitmq_handler_duration_seconds_bucket{queue="order-created",role="consumer",le="0.1"} 0`,
+		`rabbitmq_handler_duration_seconds_bucket{queue="order-created",role="consumer",le="1"} 1`,
+		`rabbitmq_handler_duration_seconds_bucket{queue="order-created",role="consumer",le="+Inf"} 1`,
+		`rabbitmq_handler_duration_seconds_sum{queue="order-created",role="consumer"} 0.5`,
+	}
+
+	for _, line := range expectedLines {
+		if !strings.Contains(output.String(), line+"\n") {
+			t.Fail()
+			t.Logf("expected line [%s] on output:\n%s", line, output.String())
+			return
+		}
+	}
+
+	t.Log("success write prometheus text format")
+	return
+}
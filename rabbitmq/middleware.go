@@ -0,0 +1,291 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const HeaderTraceParent = "traceparent" // w3c trace context
+
+type contextKey string
+
+const (
+	contextKeyTraceParent   contextKey = "rabbitmq-trace-parent"
+	contextKeyCorrelationID contextKey = "rabbitmq-correlation-id"
+)
+
+// Middleware wrap consumer handler, first middleware is the outermost
+type Middleware func(next DeliveryHandler) DeliveryHandler
+
+// PublishInterceptor called for every message before published, returned error cancel publish for the message
+type PublishInterceptor func(ctx context.Context, msg *amqp.Publishing) error
+
+// Use add middleware for consumer handler, call before Consume
+func (base *QueueSetup) Use(middlewares ...Middleware) *QueueSetup {
+	base.middlewares = append(base.middlewares, middlewares...)
+	return base
+}
+
+// AddPublishInterceptor call before publish
+func (base *QueueSetup) AddPublishInterceptor(interceptors ...PublishInterceptor) *QueueSetup {
+	base.publishInterceptors = append(base.publishInterceptors, interceptors...)
+	return base
+}
+
+func chainMiddlewares(handler DeliveryHandler, middlewares []Middleware) DeliveryHandler {
+	for idx := len(middlewares) - 1; idx >= 0; idx-- {
+		handler = middlewares[idx](handler)
+	}
+
+	return handler
+}
+
+func WithTraceParent(ctx context.Context, traceParent string) context.Context {
+	return context.WithValue(ctx, contextKeyTraceParent, traceParent)
+}
+
+func GetTraceParent(ctx context.Context) string {
+	traceParent, _ := ctx.Value(contextKeyTraceParent).(string)
+	return traceParent
+}
+
+func WithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, contextKeyCorrelationID, correlationID)
+}
+
+func GetCorrelationID(ctx context.Context) string {
+	correlationID, _ := ctx.Value(contextKeyCorrelationID).(string)
+	return correlationID
+}
+
+// LoggingMiddleware log every message handled with the result
+func LoggingMiddleware() Middleware {
+	return func(next DeliveryHandler) DeliveryHandler {
+		return func(ctx context.Context, delivery amqp.Delivery) error {
+			startTime := time.Now()
+			err := next(ctx, delivery)
+
+			// logger from consumer context already have message id, delivery tag and routing key
+			logger := LoggerFromContext(ctx).With(
+				slog.Bool("redelivered", delivery.Redelivered),
+				slog.Int64("duration_ms", time.Since(startTime).Milliseconds()),
+			)
+
+			if err != nil {
+				logger.Warn("Message handled with error", slog.Any("error", err))
+				return err
+			}
+
+			logger.Info("Message handled")
+			return nil
+		}
+	}
+}
+
+// RecoveryMiddleware change panic on handler to error, so the message is retried
+func RecoveryMiddleware() Middleware {
+	return func(next DeliveryHandler) DeliveryHandler {
+		return func(ctx context.Context, delivery amqp.Delivery) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("panic during message handling: %v", r)
+				}
+			}()
+
+			return next(ctx, delivery)
+		}
+	}
+}
+
+// TimingMiddleware observe handler duration, ex: for latency histogram
+func TimingMiddleware(observe func(delivery amqp.Delivery, duration time.Duration, err error)) Middleware {
+	return func(next DeliveryHandler) DeliveryHandler {
+		return func(ctx context.Context, delivery amqp.Delivery) error {
+			startTime := time.Now()
+			err := next(ctx, delivery)
+			observe(delivery, time.Since(startTime), err)
+			return err
+		}
+	}
+}
+
+// TracingMiddleware put traceparent header and correlation id on handler context, see TracingPublishInterceptor
+func TracingMiddleware() Middleware {
+	return func(next DeliveryHandler) DeliveryHandler {
+		return func(ctx context.Context, delivery amqp.Delivery) error {
+			if traceParent, ok := delivery.Headers[HeaderTraceParent].(string); ok && traceParent != "" {
+				ctx = WithTraceParent(ctx, traceParent)
+			}
+
+			if delivery.CorrelationId != "" {
+				ctx = WithCorrelationID(ctx, delivery.CorrelationId)
+			}
+
+			return next(ctx, delivery)
+		}
+	}
+}
+
+// ErrTooManyTimedOutHandlers handler is not called, too many timed out handler still running, see TimeoutMiddlewareWithLimit
+var ErrTooManyTimedOutHandlers = errors.New("too many timed out message handler still running")
+
+const defaultMaxAbandonedHandlers = 20
+
+const (
+	handlerRunning int32 = iota
+	handlerFinished
+	handlerAbandoned
+)
+
+// TimeoutMiddleware return error when handler didn't finish before timeout, so the message is retried.
+// handler is not stopped, it need to return when context is done, otherwise it keep running on background
+// and the retried message can be handled at the same time (use IdempotencyMiddleware after this middleware to skip it).
+// at most 20 timed out handler keep running, see TimeoutMiddlewareWithLimit
+func TimeoutMiddleware(timeout time.Duration) Middleware {
+	return TimeoutMiddlewareWithLimit(timeout, defaultMaxAbandonedHandlers)
+}
+
+// TimeoutMiddlewareWithLimit maxAbandoned timed out handler still running on background before new message
+// is retried later without calling the handler, 0 for unlimited
+func TimeoutMiddlewareWithLimit(timeout time.Duration, maxAbandoned int) Middleware {
+	var abandoned int32 // shared by every worker using the middleware
+
+	return func(next DeliveryHandler) DeliveryHandler {
+		return func(ctx context.Context, delivery amqp.Delivery) error {
+			if maxAbandoned > 0 && int(atomic.LoadInt32(&abandoned)) >= maxAbandoned {
+				return RetryLater(ErrTooManyTimedOutHandlers, timeout)
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			var state int32 // handlerRunning, handlerFinished or handlerAbandoned
+			result := make(chan error, 1)
+			go func() {
+				defer func() {
+					if r := recover(); r != nil {
+						result <- fmt.Errorf("panic during message handling: %v", r)
+					}
+
+					if !atomic.CompareAndSwapInt32(&state, handlerRunning, handlerFinished) {
+						atomic.AddInt32(&abandoned, -1)
+					}
+				}()
+
+				result <- next(ctx, delivery)
+			}()
+
+			select {
+			case err := <-result:
+				return err
+			case <-ctx.Done():
+				if !atomic.CompareAndSwapInt32(&state, handlerRunning, handlerAbandoned) {
+					return <-result // finished at the same time
+				}
+
+				atomic.AddInt32(&abandoned, 1)
+				return fmt.Errorf("message handling timeout after %s: %w", timeout.String(), ctx.Err())
+			}
+		}
+	}
+}
+
+// ErrMessageInProgress message with the same message id is still handled by other worker
+var ErrMessageInProgress = errors.New("message is still handled by other worker")
+
+// ClaimResult result of IdempotencyStore.Claim
+type ClaimResult int
+
+const (
+	ClaimAcquired   ClaimResult = iota // key claimed, message can be handled
+	ClaimInProgress                    // key claimed by other worker and not yet processed
+	ClaimProcessed                     // message already handled
+)
+
+// IdempotencyStore keep processed message id, see NewLRUIdempotencyStore for single process
+// and NewRedisIdempotencyStore for many consumer process
+type IdempotencyStore interface {
+	Claim(ctx context.Context, key string) (ClaimResult, error) // atomic, only one caller get ClaimAcquired
+	MarkProcessed(ctx context.Context, key string) error        // keep the key for store ttl after handled
+	Release(ctx context.Context, key string) error              // handler failed, so the key can be claimed again
+}
+
+// IdempotencyMiddleware claim message id before calling handler, so the same message handled by other worker is skipped.
+// message with processed message id is acked without calling handler. message that is still handled by other worker
+// (ex: redelivered after connection lost) is requeued, so it's not lost if the other worker failed and released the claim.
+// message without message id is always handled
+func IdempotencyMiddleware(store IdempotencyStore) Middleware {
+	return func(next DeliveryHandler) DeliveryHandler {
+		return func(ctx context.Context, delivery amqp.Delivery) error {
+			if delivery.MessageId == "" {
+				return next(ctx, delivery)
+			}
+
+			result, err := store.Claim(ctx, delivery.MessageId)
+			if err != nil {
+				return err
+			}
+
+			switch result {
+			case ClaimProcessed:
+				LoggerFromContext(ctx).Debug("Skip duplicate message", slog.String("message_id", delivery.MessageId))
+				return nil
+			case ClaimInProgress:
+				return Requeue(ErrMessageInProgress)
+			}
+
+			releaseClaim := func() {
+				if errRelease := store.Release(ctx, delivery.MessageId); errRelease != nil {
+					LoggerFromContext(ctx).Error("Error release message claim", slog.String("message_id", delivery.MessageId), slog.Any("error", errRelease))
+				}
+			}
+
+			defer func() {
+				if r := recover(); r != nil {
+					releaseClaim()
+					panic(r) // handled by consumer loop
+				}
+			}()
+
+			err = next(ctx, delivery)
+			if err != nil {
+				releaseClaim()
+				return err
+			}
+
+			// message already handled, error only logged so it's not retried
+			if errMark := store.MarkProcessed(ctx, delivery.MessageId); errMark != nil {
+				LoggerFromContext(ctx).Error("Error mark message as processed", slog.String("message_id", delivery.MessageId), slog.Any("error", errMark))
+			}
+
+			return nil
+		}
+	}
+}
+
+// TracingPublishInterceptor set traceparent header and correlation id from context, see WithTraceParent and WithCorrelationID
+func TracingPublishInterceptor() PublishInterceptor {
+	return func(ctx context.Context, msg *amqp.Publishing) error {
+		if traceParent := GetTraceParent(ctx); traceParent != "" {
+			headers := amqp.Table{}
+			for key, value := range msg.Headers {
+				headers[key] = value
+			}
+
+			headers[HeaderTraceParent] = traceParent
+			msg.Headers = headers
+		}
+
+		if correlationID := GetCorrelationID(ctx); correlationID != "" && msg.CorrelationId == "" {
+			msg.CorrelationId = correlationID
+		}
+
+		return nil
+	}
+}
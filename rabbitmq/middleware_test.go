@@ -0,0 +1,189 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestMiddlewareChainOrder(t *testing.T) {
+	var calls []string
+	newMiddleware := func(name string) Middleware {
+		return func(next DeliveryHandler) DeliveryHandler {
+			return func(ctx context.Context, delivery amqp.Delivery) error {
+				calls = append(calls, name)
+				return next(ctx, delivery)
+			}
+		}
+	}
+
+	handler := chainMiddlewares(func(ctx context.Context, delivery amqp.Delivery) error {
+		calls = append(calls, "handler")
+		return nil
+	}, []Middleware{newMiddleware("first"), newMiddleware("second")})
+
+	_ = handler(context.Background(), amqp.Delivery{})
+	if len(calls) != 3 || calls[0] != "first" || calls[1] != "second" || calls[2] != "handler" {
+		t.Fail()
+		t.Logf("unexpected middleware order %v", calls)
+		return
+	}
+
+	t.Log("success chain middleware")
+	return
+}
+
+func TestTimeoutAndRecoveryMiddleware(t *testing.T) {
+	handler := chainMiddlewares(func(ctx context.Context, delivery amqp.Delivery) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, []Middleware{TimeoutMiddleware(10 * time.Millisecond)})
+
+	err := handler(context.Background(), amqp.Delivery{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fail()
+		t.Logf("expected timeout error, got %v", err)
+		return
+	}
+
+	handler = chainMiddlewares(func(ctx context.Context, delivery amqp.Delivery) error {
+		panic("handler panic")
+	}, []Middleware{RecoveryMiddleware()})
+
+	err = handler(context.Background(), amqp.Delivery{})
+	if err == nil {
+		t.Fail()
+		t.Log("expected panic changed to error")
+		return
+	}
+
+	t.Log("success timeout and recover handler")
+	return
+}
+
+func TestTimeoutMiddlewareMaxAbandoned(t *testing.T) {
+	release := make(chan struct{})
+	var totalCall int32
+	handler := chainMiddlewares(func(ctx context.Context, delivery amqp.Delivery) error {
+		atomic.AddInt32(&totalCall, 1)
+		if delivery.MessageId == "slow" {
+			<-release // handler didn't stop when context done
+		}
+
+		return nil
+	}, []Middleware{TimeoutMiddlewareWithLimit(10*time.Millisecond, 1)})
+
+	if err := handler(context.Background(), amqp.Delivery{MessageId: "slow"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fail()
+		t.Logf("expected timeout error, got %v", err)
+		return
+	}
+
+	err := handler(context.Background(), amqp.Delivery{MessageId: "fast"})
+	if action, _ := getHandlerAction(err); !errors.Is(err, ErrTooManyTimedOutHandlers) || action != ActionRetry {
+		t.Fail()
+		t.Logf("expected message retried later while timed out handler still running, got %v", err)
+		return
+	}
+
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for handler(context.Background(), amqp.Delivery{MessageId: "fast"}) != nil {
+		if time.Now().After(deadline) {
+			t.Fail()
+			t.Log("expected message handled after timed out handler finished")
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	if atomic.LoadInt32(&totalCall) != 2 {
+		t.Fail()
+		t.Logf("expected handler called 2 times, got %d", totalCall)
+		return
+	}
+
+	t.Log("success limit timed out handler running on background")
+	return
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	store := NewLRUIdempotencyStore(0, 0)
+
+	var totalCall int
+	failMessage := true
+	handler := chainMiddlewares(func(ctx context.Context, delivery amqp.Delivery) error {
+		totalCall++
+		if delivery.MessageId == "message-3" && failMessage {
+			return errors.New("payment gateway unavailable")
+		}
+
+		return nil
+	}, []Middleware{IdempotencyMiddleware(store)})
+
+	_ = handler(context.Background(), amqp.Delivery{MessageId: "message-1"})
+	_ = handler(context.Background(), amqp.Delivery{MessageId: "message-1"})
+	_ = handler(context.Background(), amqp.Delivery{MessageId: "message-2"})
+
+	if totalCall != 2 {
+		t.Fail()
+		t.Logf("expected duplicate message skipped, handler called %d times", totalCall)
+		return
+	}
+
+	// failed message release the claim, so the retried message is handled again
+	if err := handler(context.Background(), amqp.Delivery{MessageId: "message-3"}); err == nil {
+		t.Fail()
+		t.Log("expected handler error returned")
+		return
+	}
+
+	failMessage = false
+	_ = handler(context.Background(), amqp.Delivery{MessageId: "message-3"})
+	if totalCall != 4 {
+		t.Fail()
+		t.Logf("expected failed message handled again, handler called %d times", totalCall)
+		return
+	}
+
+	// message still handled by other worker is requeued instead of acked
+	_, _ = store.Claim(context.Background(), "message-4")
+	err := handler(context.Background(), amqp.Delivery{MessageId: "message-4"})
+	if action, _ := getHandlerAction(err); action != ActionRequeue || !errors.Is(err, ErrMessageInProgress) || totalCall != 4 {
+		t.Fail()
+		t.Logf("expected in progress message requeued without calling handler, got %v", err)
+		return
+	}
+
+	t.Log("success skip duplicate message")
+	return
+}
+
+func TestTracingPropagation(t *testing.T) {
+	const traceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	ctx := WithCorrelationID(WithTraceParent(context.Background(), traceParent), "correlation-1")
+	msg := amqp.Publishing{}
+	_ = TracingPublishInterceptor()(ctx, &msg)
+
+	var receivedCtx context.Context
+	handler := chainMiddlewares(func(ctx context.Context, delivery amqp.Delivery) error {
+		receivedCtx = ctx
+		return nil
+	}, []Middleware{TracingMiddleware()})
+
+	_ = handler(context.Background(), amqp.Delivery{Headers: msg.Headers, CorrelationId: msg.CorrelationId})
+	if GetTraceParent(receivedCtx) != traceParent || GetCorrelationID(receivedCtx) != "correlation-1" {
+		t.Fail()
+		t.Log("trace parent and correlation id should be propagated to consumer context")
+		return
+	}
+
+	t.Log("success propagate tracing context")
+	return
+}
@@ -0,0 +1,368 @@
+package rabbitmq
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const HeaderAggregateKey = "x-aggregate-key"
+
+var ErrOutboxConfirmRequired = errors.New("outbox relay need publisher with ConfirmMode")
+
+// OutboxEvents event waiting to be published, ID is used as message id so consumer can skip duplicate message
+type OutboxEvents struct {
+	ID           string
+	AggregateKey string // events with the same key published on the same order as saved, ex: order id
+	EventType    string
+	ContentType  string
+	Headers      map[string]interface{}
+	Body         []byte
+	Attempts     int // failed publish attempts
+	LastError    string
+	CreatedAt    time.Time
+}
+
+// NewOutboxEvent wrap data using ConsumerHandlerData format, so it can be consumed using Consume
+func NewOutboxEvent(aggregateKey, eventType string, data interface{}) (OutboxEvents, error) {
+	createdAt := time.Now().UTC()
+	body, err := NewJSONCodec().Encode(ConsumerHandlerData{
+		EventType: eventType,
+		Date:      createdAt.Format(time.RFC3339Nano),
+		Data:      data,
+	})
+	if err != nil {
+		return OutboxEvents{}, fmt.Errorf("encode outbox event: %w", err)
+	}
+
+	return OutboxEvents{
+		ID:           uuid.New().String(),
+		AggregateKey: aggregateKey,
+		EventType:    eventType,
+		ContentType:  ContentTypeJSON,
+		Body:         body,
+		CreatedAt:    createdAt,
+	}, nil
+}
+
+// OutboxTx implemented by *sql.Tx, so event is saved on the same transaction as the business data
+type OutboxTx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// OutboxStore keep pending events until published by OutboxRelay
+type OutboxStore interface {
+	Save(ctx context.Context, tx OutboxTx, events ...OutboxEvents) error
+	FetchPending(ctx context.Context, limit int) ([]OutboxEvents, error) // oldest event first, dead event is skipped
+	MarkSent(ctx context.Context, id string) error
+	MarkFailed(ctx context.Context, id string, errPublish error) error
+	MarkDead(ctx context.Context, id string, errPublish error) error // failed after max attempts, not fetched again until requeued
+	RequeueDead(ctx context.Context, id string) error                // dead event fetched again with attempts reset
+}
+
+// memoryOutboxStore for testing or single process app, tx is ignored
+type memoryOutboxStore struct {
+	mutex   sync.Mutex
+	pending []OutboxEvents
+	dead    map[string]bool // dead event is kept on pending, so requeued event keep their order
+	sent    map[string]time.Time
+}
+
+func NewMemoryOutboxStore() OutboxStore {
+	return &memoryOutboxStore{
+		dead: make(map[string]bool),
+		sent: make(map[string]time.Time),
+	}
+}
+
+func (store *memoryOutboxStore) Save(ctx context.Context, tx OutboxTx, events ...OutboxEvents) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for _, event := range events {
+		if event.ID == "" {
+			event.ID = uuid.New().String()
+		}
+
+		if event.CreatedAt.IsZero() {
+			event.CreatedAt = time.Now().UTC()
+		}
+
+		store.pending = append(store.pending, event)
+	}
+
+	return nil
+}
+
+func (store *memoryOutboxStore) FetchPending(ctx context.Context, limit int) ([]OutboxEvents, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	events := make([]OutboxEvents, 0)
+	for _, event := range store.pending {
+		if limit > 0 && len(events) == limit {
+			break
+		}
+
+		if !store.dead[event.ID] {
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
+
+func (store *memoryOutboxStore) MarkSent(ctx context.Context, id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for idx, event := range store.pending {
+		if event.ID == id {
+			store.pending = append(store.pending[:idx], store.pending[idx+1:]...)
+			store.sent[id] = time.Now().UTC()
+			return nil
+		}
+	}
+
+	return fmt.Errorf("outbox event [%s] not found", id)
+}
+
+func (store *memoryOutboxStore) MarkFailed(ctx context.Context, id string, errPublish error) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for idx := range store.pending {
+		if store.pending[idx].ID == id {
+			store.pending[idx].Attempts++
+			store.pending[idx].LastError = errPublish.Error()
+			return nil
+		}
+	}
+
+	return fmt.Errorf("outbox event [%s] not found", id)
+}
+
+func (store *memoryOutboxStore) MarkDead(ctx context.Context, id string, errPublish error) error {
+	err := store.MarkFailed(ctx, id, errPublish)
+	if err != nil {
+		return err
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.dead[id] = true
+	return nil
+}
+
+func (store *memoryOutboxStore) RequeueDead(ctx context.Context, id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if !store.dead[id] {
+		return fmt.Errorf("dead outbox event [%s] not found", id)
+	}
+
+	for idx := range store.pending {
+		if store.pending[idx].ID == id {
+			store.pending[idx].Attempts = 0
+			break
+		}
+	}
+
+	delete(store.dead, id)
+	return nil
+}
+
+type OutboxRelayConfig struct {
+	PollInterval time.Duration // default 1 second
+	BatchSize    int           // pending events fetched every poll, default 100
+	MaxAttempts  int           // failed publish before event marked dead, default 10
+}
+
+/*
+OutboxRelay publish pending outbox events using queue publisher and mark it sent after confirmed by broker.
+events with the same aggregate key published one by one, next event wait until previous event is confirmed,
+failed event stop the rest of the aggregate events until next poll.
+event failed MaxAttempts times is marked dead and skipped, so the rest of the aggregate events is published again,
+fix the cause then call OutboxStore.RequeueDead to publish it again (published after the aggregate events sent while it was dead).
+only run one relay for the same store, otherwise event can be published twice (message id is kept, see IdempotencyMiddleware)
+
+	Example
+	queue := NewBaseQueue("", "order-events").AddPublisher(nil, &PublisherConfig{ConfirmMode: true, Msg: amqp.Publishing{DeliveryMode: amqp.Persistent}})
+	store := NewSQLOutboxStore(db, nil)
+
+	tx, _ := db.BeginTx(ctx, nil)
+	_, _ = tx.ExecContext(ctx, "UPDATE orders SET status = 'paid' WHERE id = ?", orderID)
+	event, _ := NewOutboxEvent(orderID, "order-paid", order)
+	_ = store.Save(ctx, tx, event)
+	_ = tx.Commit()
+
+	relay, err := NewOutboxRelay(store, queue, nil)
+	go relay.Run(ctx)
+*/
+type OutboxRelay struct {
+	store   OutboxStore
+	queue   *QueueSetup
+	config  OutboxRelayConfig
+	publish func(ctx context.Context, msgs []amqp.Publishing) []PublishResult
+}
+
+func NewOutboxRelay(store OutboxStore, queue *QueueSetup, config *OutboxRelayConfig) (*OutboxRelay, error) {
+	if queue.queueConfig == nil || queue.queueConfig.QueuePublisherConfig == nil || !queue.queueConfig.QueuePublisherConfig.ConfirmMode {
+		return nil, ErrOutboxConfirmRequired
+	}
+
+	if config == nil {
+		config = &OutboxRelayConfig{}
+	}
+
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 10
+	}
+
+	return &OutboxRelay{
+		store:  store,
+		queue:  queue,
+		config: *config,
+		publish: func(ctx context.Context, msgs []amqp.Publishing) []PublishResult {
+			return queue.publishMessages(ctx, queue.queueName, msgs)
+		},
+	}, nil
+}
+
+// Run relay pending events every poll interval until context done
+func (relay *OutboxRelay) Run(ctx context.Context) {
+	ticker := time.NewTicker(relay.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		total, err := relay.RelayPending(ctx)
+		if err != nil {
+			relay.queue.getLogger().Error("Error relay outbox events", slog.Any("error", err))
+		}
+
+		if total == relay.config.BatchSize {
+			continue // still have pending events, didn't wait for next poll
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayPending publish one batch of pending events, return total events sent
+func (relay *OutboxRelay) RelayPending(ctx context.Context) (int, error) {
+	events, err := relay.store.FetchPending(ctx, relay.config.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("fetch pending outbox events: %w", err)
+	}
+
+	var aggregateKeys []string
+	aggregates := make(map[string][]OutboxEvents)
+	for _, event := range events {
+		if _, ok := aggregates[event.AggregateKey]; !ok {
+			aggregateKeys = append(aggregateKeys, event.AggregateKey)
+		}
+
+		aggregates[event.AggregateKey] = append(aggregates[event.AggregateKey], event)
+	}
+	sort.Strings(aggregateKeys)
+
+	var mutex sync.Mutex
+	var waitGroup sync.WaitGroup
+	totalSent := 0
+	for _, aggregateKey := range aggregateKeys {
+		waitGroup.Add(1)
+		go func(aggregateEvents []OutboxEvents) {
+			defer waitGroup.Done()
+
+			sent := relay.relayAggregate(ctx, aggregateEvents)
+
+			mutex.Lock()
+			totalSent += sent
+			mutex.Unlock()
+		}(aggregates[aggregateKey])
+	}
+
+	waitGroup.Wait()
+	return totalSent, nil
+}
+
+// relayAggregate publish events in order, stop on the first failed event so the order is kept,
+// event reached max attempts is marked dead and the next events is published
+func (relay *OutboxRelay) relayAggregate(ctx context.Context, events []OutboxEvents) int {
+	sent := 0
+	for _, event := range events {
+		logger := relay.queue.getLogger().With(slog.String("event_id", event.ID), slog.String("aggregate_key", event.AggregateKey))
+		results := relay.publish(ctx, []amqp.Publishing{relay.newPublishing(event)})
+		if err := results[0].Err; err != nil {
+			logger.Error("Error publish outbox event", slog.Any("error", err), slog.Int("attempt", event.Attempts+1))
+			if event.Attempts+1 >= relay.config.MaxAttempts {
+				errMark := relay.store.MarkDead(ctx, event.ID, err)
+				if errMark != nil {
+					logger.Error("Error mark outbox event as dead", slog.Any("error", errMark))
+					return sent
+				}
+
+				logger.Error("Outbox event marked dead after max attempts, skipped until requeued", slog.Int("max_attempts", relay.config.MaxAttempts))
+				continue
+			}
+
+			if errMark := relay.store.MarkFailed(ctx, event.ID, err); errMark != nil {
+				logger.Error("Error mark outbox event as failed", slog.Any("error", errMark))
+			}
+
+			return sent
+		}
+
+		// event already published, if mark sent failed the event published again on next poll
+		if err := relay.store.MarkSent(ctx, event.ID); err != nil {
+			logger.Error("Error mark outbox event as sent", slog.Any("error", err))
+			return sent
+		}
+
+		sent++
+	}
+
+	return sent
+}
+
+func (relay *OutboxRelay) newPublishing(event OutboxEvents) amqp.Publishing {
+	msg := relay.queue.newPublishing(event.Body)
+	if msg.Headers == nil {
+		msg.Headers = amqp.Table{}
+	}
+
+	for key, value := range event.Headers {
+		msg.Headers[key] = value
+	}
+	msg.Headers[HeaderAggregateKey] = event.AggregateKey
+
+	msg.MessageId = event.ID
+	msg.Type = event.EventType
+	msg.Timestamp = event.CreatedAt
+	if event.ContentType != "" {
+		msg.ContentType = event.ContentType
+	}
+
+	return msg
+}
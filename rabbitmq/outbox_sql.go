@@ -0,0 +1,185 @@
+package rabbitmq
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+/*
+SQLOutboxConfig table used by sql outbox store, table need to be created first
+
+	MySQL Example
+	CREATE TABLE outbox_events (
+		id            BIGINT AUTO_INCREMENT PRIMARY KEY,
+		event_id      VARCHAR(36)  NOT NULL UNIQUE,
+		aggregate_key VARCHAR(255) NOT NULL,
+		event_type    VARCHAR(255) NOT NULL,
+		content_type  VARCHAR(100) NOT NULL,
+		headers       TEXT         NULL,
+		body          BLOB         NOT NULL,
+		attempts      INT          NOT NULL DEFAULT 0,
+		last_error    TEXT         NULL,
+		created_at    DATETIME(6)  NOT NULL,
+		sent_at       DATETIME(6)  NULL,
+		dead_at       DATETIME(6)  NULL,
+		INDEX idx_outbox_events_pending (sent_at, dead_at, id)
+	);
+
+	PostgreSQL use BIGSERIAL for id, BYTEA for body and TIMESTAMPTZ for created_at, sent_at and dead_at
+
+	Existing Table Example
+	ALTER TABLE outbox_events ADD COLUMN dead_at DATETIME(6) NULL;
+*/
+type SQLOutboxConfig struct {
+	TableName            string // default outbox_events
+	UseDollarPlaceholder bool   // If true, query using $1 placeholder (postgres), default ? placeholder (mysql)
+}
+
+type sqlOutboxStore struct {
+	db     *sql.DB
+	config SQLOutboxConfig
+}
+
+func NewSQLOutboxStore(db *sql.DB, config *SQLOutboxConfig) OutboxStore {
+	if config == nil {
+		config = &SQLOutboxConfig{}
+	}
+
+	if config.TableName == "" {
+		config.TableName = "outbox_events"
+	}
+
+	return &sqlOutboxStore{
+		db:     db,
+		config: *config,
+	}
+}
+
+// query change ? placeholder to $n placeholder
+func (store *sqlOutboxStore) query(query string) string {
+	if !store.config.UseDollarPlaceholder {
+		return query
+	}
+
+	var builder strings.Builder
+	idx := 0
+	for _, char := range query {
+		if char == '?' {
+			idx++
+			builder.WriteString(fmt.Sprintf("$%d", idx))
+			continue
+		}
+
+		builder.WriteRune(char)
+	}
+
+	return builder.String()
+}
+
+// Save nil tx save without transaction
+func (store *sqlOutboxStore) Save(ctx context.Context, tx OutboxTx, events ...OutboxEvents) error {
+	if tx == nil {
+		tx = store.db
+	}
+
+	query := store.query(fmt.Sprintf("INSERT INTO %s (event_id, aggregate_key, event_type, content_type, headers, body, attempts, created_at) "+
+		"VALUES (?, ?, ?, ?, ?, ?, 0, ?)", store.config.TableName))
+
+	for _, event := range events {
+		if event.ID == "" {
+			event.ID = uuid.New().String()
+		}
+
+		if event.CreatedAt.IsZero() {
+			event.CreatedAt = time.Now().UTC()
+		}
+
+		var headers sql.NullString
+		if len(event.Headers) > 0 {
+			headersMarshal, err := json.Marshal(event.Headers)
+			if err != nil {
+				return fmt.Errorf("encode outbox event [%s] headers: %w", event.ID, err)
+			}
+
+			headers = sql.NullString{String: string(headersMarshal), Valid: true}
+		}
+
+		_, err := tx.ExecContext(ctx, query, event.ID, event.AggregateKey, event.EventType, event.ContentType, headers, event.Body, event.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("save outbox event [%s]: %w", event.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func (store *sqlOutboxStore) FetchPending(ctx context.Context, limit int) ([]OutboxEvents, error) {
+	query := store.query(fmt.Sprintf("SELECT event_id, aggregate_key, event_type, content_type, headers, body, attempts, last_error, created_at "+
+		"FROM %s WHERE sent_at IS NULL AND dead_at IS NULL ORDER BY id LIMIT ?", store.config.TableName))
+
+	rows, err := store.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []OutboxEvents
+	for rows.Next() {
+		var event OutboxEvents
+		var headers, lastError sql.NullString
+		err = rows.Scan(&event.ID, &event.AggregateKey, &event.EventType, &event.ContentType, &headers, &event.Body, &event.Attempts, &lastError, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if headers.Valid && headers.String != "" {
+			err = json.Unmarshal([]byte(headers.String), &event.Headers)
+			if err != nil {
+				return nil, fmt.Errorf("decode outbox event [%s] headers: %w", event.ID, err)
+			}
+		}
+
+		event.LastError = lastError.String
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+func (store *sqlOutboxStore) MarkSent(ctx context.Context, id string) error {
+	query := store.query(fmt.Sprintf("UPDATE %s SET sent_at = ? WHERE event_id = ?", store.config.TableName))
+	_, err := store.db.ExecContext(ctx, query, time.Now().UTC(), id)
+	return err
+}
+
+func (store *sqlOutboxStore) MarkFailed(ctx context.Context, id string, errPublish error) error {
+	query := store.query(fmt.Sprintf("UPDATE %s SET attempts = attempts + 1, last_error = ? WHERE event_id = ?", store.config.TableName))
+	_, err := store.db.ExecContext(ctx, query, errPublish.Error(), id)
+	return err
+}
+
+func (store *sqlOutboxStore) MarkDead(ctx context.Context, id string, errPublish error) error {
+	query := store.query(fmt.Sprintf("UPDATE %s SET attempts = attempts + 1, last_error = ?, dead_at = ? WHERE event_id = ?", store.config.TableName))
+	_, err := store.db.ExecContext(ctx, query, errPublish.Error(), time.Now().UTC(), id)
+	return err
+}
+
+func (store *sqlOutboxStore) RequeueDead(ctx context.Context, id string) error {
+	query := store.query(fmt.Sprintf("UPDATE %s SET attempts = 0, dead_at = NULL WHERE event_id = ? AND dead_at IS NOT NULL", store.config.TableName))
+	result, err := store.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	if total, err := result.RowsAffected(); err == nil && total == 0 {
+		return fmt.Errorf("dead outbox event [%s] not found", id)
+	}
+
+	return nil
+}
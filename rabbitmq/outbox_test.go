@@ -0,0 +1,192 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestOutboxRelay(t *testing.T) {
+	queueSetup := &QueueSetup{
+		queueName:   "order-events",
+		queueConfig: &QueueConfig{QueuePublisherConfig: &PublisherConfig{ConfirmMode: true}},
+	}
+
+	store := NewMemoryOutboxStore()
+	relay, err := NewOutboxRelay(store, queueSetup, nil)
+	if err != nil {
+		t.Fail()
+		t.Log(err.Error())
+		return
+	}
+
+	ctx := context.Background()
+	for _, eventType := range []string{"order-created", "order-paid", "order-shipped"} {
+		for _, aggregateKey := range []string{"order-1", "order-2"} {
+			event, err := NewOutboxEvent(aggregateKey, eventType, map[string]string{"order_id": aggregateKey})
+			if err != nil {
+				t.Fail()
+				t.Log(err.Error())
+				return
+			}
+
+			_ = store.Save(ctx, nil, event)
+		}
+	}
+
+	var mutex sync.Mutex
+	published := make(map[string][]string)
+	failPaid := true
+	relay.publish = func(ctx context.Context, msgs []amqp.Publishing) []PublishResult {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		aggregateKey := msgs[0].Headers[HeaderAggregateKey].(string)
+		if aggregateKey == "order-2" && msgs[0].Type == "order-paid" && failPaid {
+			return []PublishResult{{MessageID: msgs[0].MessageId, Err: ErrPublishNacked}}
+		}
+
+		published[aggregateKey] = append(published[aggregateKey], msgs[0].Type)
+		return []PublishResult{{MessageID: msgs[0].MessageId}}
+	}
+
+	total, err := relay.RelayPending(ctx)
+	if err != nil || total != 4 {
+		t.Fail()
+		t.Logf("expected 4 events sent on first relay, got %d, err %v", total, err)
+		return
+	}
+
+	// order-2 stopped on failed event, so order-shipped is not published before order-paid
+	if len(published["order-2"]) != 1 || published["order-2"][0] != "order-created" {
+		t.Fail()
+		t.Logf("unexpected order-2 published events %v", published["order-2"])
+		return
+	}
+
+	pending, _ := store.FetchPending(ctx, 0)
+	if len(pending) != 2 || pending[0].EventType != "order-paid" || pending[0].Attempts != 1 || pending[0].LastError == "" {
+		t.Fail()
+		t.Logf("unexpected pending events after failed publish %+v", pending)
+		return
+	}
+
+	failPaid = false
+	total, err = relay.RelayPending(ctx)
+	if err != nil || total != 2 {
+		t.Fail()
+		t.Logf("expected 2 events sent on second relay, got %d, err %v", total, err)
+		return
+	}
+
+	expected := []string{"order-created", "order-paid", "order-shipped"}
+	for _, aggregateKey := range []string{"order-1", "order-2"} {
+		for idx, eventType := range expected {
+			if len(published[aggregateKey]) != len(expected) || published[aggregateKey][idx] != eventType {
+				t.Fail()
+				t.Logf("unexpected [%s] published order %v", aggregateKey, published[aggregateKey])
+				return
+			}
+		}
+	}
+
+	pending, _ = store.FetchPending(ctx, 0)
+	if len(pending) != 0 {
+		t.Fail()
+		t.Logf("expected no pending events, got %d", len(pending))
+		return
+	}
+
+	t.Log("success relay outbox events")
+	return
+}
+
+func TestOutboxRelayMaxAttempts(t *testing.T) {
+	queueSetup := &QueueSetup{
+		queueName:   "order-events",
+		queueConfig: &QueueConfig{QueuePublisherConfig: &PublisherConfig{ConfirmMode: true}},
+	}
+
+	store := NewMemoryOutboxStore()
+	relay, _ := NewOutboxRelay(store, queueSetup, &OutboxRelayConfig{MaxAttempts: 2})
+
+	ctx := context.Background()
+	for _, eventType := range []string{"order-created", "order-paid"} {
+		event, _ := NewOutboxEvent("order-1", eventType, nil)
+		_ = store.Save(ctx, nil, event)
+	}
+
+	var published []string
+	poison := true
+	relay.publish = func(ctx context.Context, msgs []amqp.Publishing) []PublishResult {
+		if msgs[0].Type == "order-created" && poison {
+			return []PublishResult{{MessageID: msgs[0].MessageId, Err: errors.New("message too large")}}
+		}
+
+		published = append(published, msgs[0].Type)
+		return []PublishResult{{MessageID: msgs[0].MessageId}}
+	}
+
+	if total, _ := relay.RelayPending(ctx); total != 0 {
+		t.Fail()
+		t.Logf("expected aggregate blocked on first failed attempt, got %d sent", total)
+		return
+	}
+
+	// second attempt reach max attempts, event marked dead and the rest of aggregate published
+	if total, _ := relay.RelayPending(ctx); total != 1 || len(published) != 1 || published[0] != "order-paid" {
+		t.Fail()
+		t.Logf("expected aggregate unblocked after dead event, got %d sent %v", total, published)
+		return
+	}
+
+	pending, _ := store.FetchPending(ctx, 0)
+	if len(pending) != 0 {
+		t.Fail()
+		t.Logf("expected dead event skipped, got %+v", pending)
+		return
+	}
+
+	deadEventID := store.(*memoryOutboxStore).pending[0].ID
+	if err := store.RequeueDead(ctx, deadEventID); err != nil {
+		t.Fail()
+		t.Log(err.Error())
+		return
+	}
+
+	poison = false
+	if total, _ := relay.RelayPending(ctx); total != 1 || published[1] != "order-created" {
+		t.Fail()
+		t.Logf("expected requeued event published, got %d sent %v", total, published)
+		return
+	}
+
+	if err := store.RequeueDead(ctx, deadEventID); err == nil {
+		t.Fail()
+		t.Log("expected error requeue event that is not dead")
+		return
+	}
+
+	t.Log("success mark outbox event dead after max attempts")
+	return
+}
+
+func TestOutboxRelayConfirmRequired(t *testing.T) {
+	queueSetup := &QueueSetup{
+		queueName:   "order-events",
+		queueConfig: &QueueConfig{QueuePublisherConfig: &PublisherConfig{}},
+	}
+
+	_, err := NewOutboxRelay(NewMemoryOutboxStore(), queueSetup, nil)
+	if !errors.Is(err, ErrOutboxConfirmRequired) {
+		t.Fail()
+		t.Logf("expected confirm required error, got %v", err)
+		return
+	}
+
+	t.Log("success reject relay without confirm mode")
+	return
+}
@@ -1,19 +1,103 @@
 package rabbitmq
 
 import (
+	"context"
+	"log/slog"
 	"os"
+	"strconv"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+// PublishOptions override message property for one publish, empty value keep the publisher config
+type PublishOptions struct {
+	RoutingKey    string        // default queue name, ex: "order.retail.created" for topic exchange
+	Headers       amqp.Table    // merged with publisher config headers, ex: matched by headers exchange
+	Priority      uint8         // queue need x-max-priority args
+	Expiration    time.Duration // message ttl, 0 for no expiration
+	MessageID     string        // default generated uuid
+	CorrelationID string
+}
+
+func (options *PublishOptions) getRoutingKey(defaultRoutingKey string) string {
+	if options == nil || options.RoutingKey == "" {
+		return defaultRoutingKey
+	}
+
+	return options.RoutingKey
+}
+
+func (options *PublishOptions) apply(msg *amqp.Publishing) {
+	if options == nil {
+		return
+	}
+
+	if len(options.Headers) > 0 {
+		headers := amqp.Table{}
+		for key, value := range msg.Headers {
+			headers[key] = value
+		}
+
+		for key, value := range options.Headers {
+			headers[key] = value
+		}
+
+		msg.Headers = headers
+	}
+
+	if options.Priority > 0 {
+		msg.Priority = options.Priority
+	}
+
+	if options.Expiration > 0 {
+		msg.Expiration = strconv.FormatInt(options.Expiration.Milliseconds(), 10)
+	}
+
+	if options.MessageID != "" {
+		msg.MessageId = options.MessageID
+	}
+
+	if options.CorrelationID != "" {
+		msg.CorrelationId = options.CorrelationID
+	}
+}
+
+// publishChannel publish method of amqp.Channel
+type publishChannel interface {
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	GetNextPublishSeqNo() uint64
+}
+
+func (base *QueueSetup) getPublishChannel() (publishChannel, *publisherConfirm) {
+	base.channelMutex.RLock()
+	defer base.channelMutex.RUnlock()
+	return base.publisherChannel, base.publisherConfirm
+}
+
 type PublisherConfig struct {
-	Mandatory bool            `json:"mandatory"`
+	Mandatory bool            `json:"mandatory"` // If true, unroutable message returned by broker, see ReturnedError
 	Immediate bool            `json:"immediate"`
 	Msg       amqp.Publishing `json:"msg"`
+
+	ConfirmMode    bool          `json:"confirm_mode"`    // If true, publish wait until broker ack/nack the message
+	ConfirmTimeout time.Duration `json:"confirm_timeout"` // used when context didn't have deadline, default 5 second
+
+	Buffer *PublishBufferConfig `json:"buffer"` // If not nil, message is buffered while reconnecting and publisher keep reconnecting
 }
 
+// AddPublisher panic if connection can't be opened or declaration failed, use AddPublisherE to get the error
 func (base *QueueSetup) AddPublisher(queueDeclare *QueueDeclareConfig, publisherConfig *PublisherConfig) *QueueSetup {
+	queueSetup, err := base.AddPublisherE(queueDeclare, publisherConfig)
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return queueSetup
+}
+
+// AddPublisherE same as AddPublisher, but return error instead of panic, reconnect is only started if no error
+func (base *QueueSetup) AddPublisherE(queueDeclare *QueueDeclareConfig, publisherConfig *PublisherConfig) (*QueueSetup, error) {
 	if queueDeclare == nil { // set default configuration queue declare
 		queueDeclare = &QueueDeclareConfig{
 			Durable:    false,
@@ -38,7 +122,7 @@ func (base *QueueSetup) AddPublisher(queueDeclare *QueueDeclareConfig, publisher
 				// ReplyTo:         "",
 				// Expiration:      "",
 				// MessageId:       "",
-				Timestamp: time.Now(),
+				// Timestamp:       set on every publish
 				// Type:            "",
 				// UserId:          "",
 				AppId: os.Getenv("APP_NAME"),
@@ -54,55 +138,199 @@ func (base *QueueSetup) AddPublisher(queueDeclare *QueueDeclareConfig, publisher
 
 	base.isPublisher = true
 	base.maxReconnectAttempt = 3 // default reconnect attempt
+	base.reportConnectionState()
+	if publisherConfig.Buffer != nil {
+		base.publishBuffer = newPublishBuffer(publisherConfig.Buffer)
+	}
 
-	err := base.declareQueue()
+	err := base.ensureConnection()
 	if err != nil {
-		loggingMessage("error declare queue after open connection", err.Error())
-		panic(err.Error())
+		base.getLogger().Error("Error open new connection", slog.Any("error", err))
+		return base, err
 	}
 
-	go base.reconnect()
+	err = base.declareQueue()
+	if err != nil {
+		base.getLogger().Error("Error declare queue after open connection", slog.Any("error", err))
+		return base, err
+	}
+
+	base.startReconnect()
 
-	return base
+	return base, nil
 }
 
 func (base *QueueSetup) Publish(message string) error {
-	publishConfig := base.queueConfig.QueuePublisherConfig
-	publishConfig.Msg.Body = []byte(message)
+	return base.PublishWithContext(base.ctx, message)
+}
+
+// PublishWithContext on ConfirmMode, return error if message nacked, returned (see ReturnedError)
+// or context done before broker confirm the message
+func (base *QueueSetup) PublishWithContext(ctx context.Context, message string) error {
+	return base.PublishWithOptions(ctx, message, nil)
+}
 
-	loggingMessage("Publishing Message...", nil)
-	err := base.channel.PublishWithContext(
-		base.ctx,
-		base.exchangeName,
-		base.queueName,
-		publishConfig.Mandatory,
-		publishConfig.Immediate,
-		publishConfig.Msg,
-	)
+/*
+PublishWithOptions publish message using custom routing key and properties, nil options same as PublishWithContext
 
-	return err
+	Topic Exchange Example
+	err := queue.PublishWithOptions(ctx, message, &PublishOptions{
+		RoutingKey: "order.retail.created",
+		Priority:   5,
+		Expiration: time.Minute,
+	})
+
+	Headers Exchange Example
+	err := queue.PublishWithOptions(ctx, message, &PublishOptions{
+		Headers: amqp.Table{"event_type": "order-created"},
+	})
+*/
+func (base *QueueSetup) PublishWithOptions(ctx context.Context, message string, options *PublishOptions) error {
+	msg := base.newPublishing([]byte(message))
+	options.apply(&msg)
+
+	routingKey := options.getRoutingKey(base.queueName)
+	base.logMessage(base.getLogger(), "Publishing message", slog.String("routing_key", routingKey))
+	results := base.publishMessages(ctx, routingKey, []amqp.Publishing{msg})
+	return results[0].Err
 }
 
 func (base *QueueSetup) BatchPublish(messages []string) []error {
+	var listErr []error
+	for _, result := range base.BatchPublishWithResults(base.ctx, messages) {
+		if result.Err != nil {
+			listErr = append(listErr, result.Err)
+		}
+	}
+
+	return listErr
+}
+
+// BatchPublishWithResults result for every message on the same order as messages,
+// on ConfirmMode all messages published first before waiting the confirmation
+func (base *QueueSetup) BatchPublishWithResults(ctx context.Context, messages []string) []PublishResult {
+	return base.BatchPublishWithOptions(ctx, messages, nil)
+}
+
+// BatchPublishWithOptions options used for every message, except MessageID (every message have their own id)
+func (base *QueueSetup) BatchPublishWithOptions(ctx context.Context, messages []string, options *PublishOptions) []PublishResult {
+	msgs := make([]amqp.Publishing, len(messages))
+	for idx, message := range messages {
+		msgs[idx] = base.newPublishing([]byte(message))
+		options.apply(&msgs[idx])
+		if len(messages) > 1 {
+			msgs[idx].MessageId = "" // every message need their own id, assigned on publish
+		}
+	}
+
+	routingKey := options.getRoutingKey(base.queueName)
+	base.logMessage(base.getLogger(), "Publishing batch message", slog.String("routing_key", routingKey), slog.Int("total", len(messages)))
+	return base.publishMessages(ctx, routingKey, msgs)
+}
+
+// newPublishing message from publisher config, headers is copied and timestamp set for every message
+func (base *QueueSetup) newPublishing(body []byte) amqp.Publishing {
+	msg := base.queueConfig.QueuePublisherConfig.Msg
+	if msg.Headers != nil {
+		headers := amqp.Table{}
+		for key, value := range msg.Headers {
+			headers[key] = value
+		}
+
+		msg.Headers = headers
+	}
+
+	msg.Timestamp = time.Now()
+	msg.Body = body
+	return msg
+}
+
+func (base *QueueSetup) publishMessages(ctx context.Context, routingKey string, msgs []amqp.Publishing) []PublishResult {
+	assignMessageID(msgs)
+	if len(base.publishInterceptors) == 0 {
+		return base.publish(ctx, routingKey, msgs)
+	}
+
+	results := make([]PublishResult, len(msgs))
+
+	var interceptedMsgs []amqp.Publishing
+	var msgIndexes []int
+	for idx, msg := range msgs {
+		err := base.intercept(ctx, &msg)
+		if err != nil {
+			results[idx] = PublishResult{Index: idx, MessageID: msg.MessageId, Err: err}
+			continue
+		}
+
+		interceptedMsgs = append(interceptedMsgs, msg)
+		msgIndexes = append(msgIndexes, idx)
+	}
+
+	for _, result := range base.publish(ctx, routingKey, interceptedMsgs) {
+		result.Index = msgIndexes[result.Index]
+		results[result.Index] = result
+	}
+
+	return results
+}
+
+func (base *QueueSetup) intercept(ctx context.Context, msg *amqp.Publishing) error {
+	for _, interceptor := range base.publishInterceptors {
+		err := interceptor(ctx, msg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// publish buffer message while reconnecting if buffer is configured, see PublishBufferConfig
+func (base *QueueSetup) publish(ctx context.Context, routingKey string, msgs []amqp.Publishing) []PublishResult {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	if base.publishBuffer == nil {
+		return base.send(ctx, routingKey, msgs)
+	}
+
+	return base.publishOrBuffer(ctx, routingKey, msgs)
+}
+
+// send safe to be called from multiple goroutine, publish on channel is serialized
+func (base *QueueSetup) send(ctx context.Context, routingKey string, msgs []amqp.Publishing) []PublishResult {
 	publishConfig := base.queueConfig.QueuePublisherConfig
+	channel, confirm := base.getPublishChannel()
+	if channel == nil || (publishConfig.ConfirmMode && confirm == nil) {
+		results := make([]PublishResult, len(msgs))
+		for idx, msg := range msgs {
+			results[idx] = PublishResult{Index: idx, MessageID: msg.MessageId, Err: amqp.ErrClosed}
+		}
 
-	var listErr []error
-	for _, message := range messages {
-		publishConfig.Msg.Body = []byte(message)
+		return results
+	}
 
-		loggingMessage("Publishing Message...", nil)
-		err := base.channel.Publish(
+	if publishConfig.ConfirmMode {
+		return base.publishWithConfirm(ctx, channel, confirm, routingKey, msgs)
+	}
+
+	base.publishMutex.Lock()
+	defer base.publishMutex.Unlock()
+
+	results := make([]PublishResult, len(msgs))
+	for idx, msg := range msgs {
+		err := channel.PublishWithContext(
+			ctx,
 			base.exchangeName,
-			base.queueName,
+			routingKey,
 			publishConfig.Mandatory,
 			publishConfig.Immediate,
-			publishConfig.Msg,
+			msg,
 		)
 
-		if err != nil {
-			listErr = append(listErr, err)
-		}
+		results[idx] = PublishResult{Index: idx, MessageID: msg.MessageId, Err: err}
 	}
 
-	return listErr
+	return results
 }
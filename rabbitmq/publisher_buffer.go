@@ -0,0 +1,284 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrPublishBufferFull buffer reached max size with OverflowReject policy
+var ErrPublishBufferFull = errors.New("publish buffer is full")
+
+type OverflowPolicy int
+
+const (
+	OverflowBlock      OverflowPolicy = iota // publish wait until buffer have space or context done
+	OverflowReject                           // new message rejected with ErrPublishBufferFull
+	OverflowDropOldest                       // oldest buffered message dropped to keep new message
+)
+
+func (policy OverflowPolicy) String() string {
+	switch policy {
+	case OverflowBlock:
+		return "block"
+	case OverflowReject:
+		return "reject"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	default:
+		return "unknown"
+	}
+}
+
+/*
+PublishBufferConfig keep message in memory while publisher is reconnecting, buffered message is flushed
+in order after reconnected and before new message is published. buffered message is lost if the app stopped.
+publish return nil error for buffered message, see PublishResult.Buffered
+
+	Example
+	queue := NewBaseQueue("", "order-created").AddPublisher(nil, &PublisherConfig{
+		Msg:    amqp.Publishing{ContentType: "application/json"},
+		Buffer: &PublishBufferConfig{Size: 5000, OverflowPolicy: OverflowBlock},
+	})
+*/
+type PublishBufferConfig struct {
+	Size           int            // max buffered message, default 1000
+	OverflowPolicy OverflowPolicy // default OverflowBlock
+	FlushBatchSize int            // message published on every flush batch, default 100
+}
+
+type bufferedMessage struct {
+	sequence   uint64 // assigned when buffered, message id can be reused by caller (see PublishOptions.MessageID)
+	routingKey string
+	msg        amqp.Publishing
+}
+
+type publishBuffer struct {
+	config PublishBufferConfig
+
+	mutex    sync.Mutex
+	active   bool // publisher is reconnecting or still flushing
+	messages []bufferedMessage
+	sequence uint64        // last assigned message sequence
+	released chan struct{} // closed when buffered message removed
+	flush    chan struct{}
+}
+
+func newPublishBuffer(config *PublishBufferConfig) *publishBuffer {
+	if config.Size <= 0 {
+		config.Size = 1000
+	}
+
+	if config.FlushBatchSize <= 0 {
+		config.FlushBatchSize = 100
+	}
+
+	return &publishBuffer{
+		config:   *config,
+		released: make(chan struct{}),
+		flush:    make(chan struct{}, 1),
+	}
+}
+
+func (buffer *publishBuffer) signalFlush() {
+	select {
+	case buffer.flush <- struct{}{}:
+	default:
+	}
+}
+
+func (buffer *publishBuffer) activate() {
+	buffer.mutex.Lock()
+	buffer.active = true
+	buffer.mutex.Unlock()
+}
+
+func (buffer *publishBuffer) isActive() bool {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	return buffer.active
+}
+
+func (buffer *publishBuffer) size() int {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	return len(buffer.messages)
+}
+
+// push add message to the end of buffer, return false if buffer is not active anymore (flush already finished),
+// dropped is not nil if oldest message dropped by OverflowDropOldest
+func (buffer *publishBuffer) push(ctx context.Context, message bufferedMessage, force bool) (isBuffered bool, dropped *bufferedMessage, err error) {
+	for {
+		buffer.mutex.Lock()
+		if !buffer.active && !force {
+			buffer.mutex.Unlock()
+			return false, nil, nil
+		}
+
+		buffer.active = true
+		if len(buffer.messages) < buffer.config.Size {
+			buffer.sequence++
+			message.sequence = buffer.sequence
+			buffer.messages = append(buffer.messages, message)
+			buffer.mutex.Unlock()
+			return true, nil, nil
+		}
+
+		switch buffer.config.OverflowPolicy {
+		case OverflowReject:
+			buffer.mutex.Unlock()
+			return true, nil, ErrPublishBufferFull
+		case OverflowDropOldest:
+			oldest := buffer.messages[0]
+			buffer.sequence++
+			message.sequence = buffer.sequence
+			buffer.messages = append(buffer.messages[1:], message)
+			buffer.mutex.Unlock()
+			return true, &oldest, nil
+		}
+
+		released := buffer.released
+		buffer.mutex.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return true, nil, fmt.Errorf("waiting publish buffer: %w", ctx.Err())
+		}
+	}
+}
+
+// peek first messages on buffer, buffer is deactivated when empty so new message published directly
+func (buffer *publishBuffer) peek(limit int) []bufferedMessage {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+
+	if len(buffer.messages) == 0 {
+		buffer.active = false
+		return nil
+	}
+
+	if limit > len(buffer.messages) {
+		limit = len(buffer.messages)
+	}
+
+	return append([]bufferedMessage(nil), buffer.messages[:limit]...)
+}
+
+// remove flushed messages from the start of buffer, flushed message can be already dropped by OverflowDropOldest.
+// flushed messages is taken from the start of buffer, so every message with sequence up to the last flushed is removed
+func (buffer *publishBuffer) remove(flushed []bufferedMessage) {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+
+	if len(flushed) == 0 {
+		return
+	}
+
+	lastSequence := flushed[len(flushed)-1].sequence
+
+	total := 0
+	for total < len(buffer.messages) && buffer.messages[total].sequence <= lastSequence {
+		total++
+	}
+
+	buffer.messages = buffer.messages[total:]
+	close(buffer.released)
+	buffer.released = make(chan struct{})
+}
+
+// publishOrBuffer buffer message while buffer is active, message failed because of closed channel
+// is also buffered and flushed by reconnect goroutine, see reconnect
+func (base *QueueSetup) publishOrBuffer(ctx context.Context, routingKey string, msgs []amqp.Publishing) []PublishResult {
+	buffer := base.publishBuffer
+	results := make([]PublishResult, len(msgs))
+
+	var bufferIndexes []int
+	isActive := buffer.isActive()
+	if isActive {
+		for idx := range msgs {
+			bufferIndexes = append(bufferIndexes, idx)
+		}
+	} else {
+		for idx, result := range base.send(ctx, routingKey, msgs) {
+			results[idx] = result
+			if errors.Is(result.Err, amqp.ErrClosed) {
+				bufferIndexes = append(bufferIndexes, idx)
+			}
+		}
+	}
+
+	for _, idx := range bufferIndexes {
+		isBuffered, dropped, err := buffer.push(ctx, bufferedMessage{routingKey: routingKey, msg: msgs[idx]}, !isActive)
+		if dropped != nil {
+			base.getLogger().Warn("Publish buffer is full, oldest message dropped", slog.String("message_id", dropped.msg.MessageId))
+		}
+
+		if !isBuffered { // flush finished before message buffered
+			results[idx] = base.send(ctx, routingKey, msgs[idx:idx+1])[0]
+			results[idx].Index = idx
+			continue
+		}
+
+		results[idx] = PublishResult{Index: idx, MessageID: msgs[idx].MessageId, Err: err, Buffered: err == nil}
+	}
+
+	if !isActive && len(bufferIndexes) > 0 {
+		buffer.signalFlush() // channel can be already replaced before the message failed
+	}
+
+	return results
+}
+
+// flushPublishBuffer publish buffered message in order, stop when channel closed again and continue on next reconnect.
+// message that is nacked or returned by broker is dropped
+func (base *QueueSetup) flushPublishBuffer() {
+	buffer := base.publishBuffer
+	if buffer == nil {
+		return
+	}
+
+	logger := base.getLogger()
+	logger.Info("Flushing publish buffer", slog.Int("total", buffer.size()))
+	for {
+		messages := buffer.peek(buffer.config.FlushBatchSize)
+		if len(messages) == 0 {
+			return
+		}
+
+		var flushed []bufferedMessage
+		for start := 0; start < len(messages); {
+			end := start + 1
+			for end < len(messages) && messages[end].routingKey == messages[start].routingKey {
+				end++
+			}
+
+			msgs := make([]amqp.Publishing, 0, end-start)
+			for _, message := range messages[start:end] {
+				msgs = append(msgs, message.msg)
+			}
+
+			for idx, result := range base.send(base.ctx, messages[start].routingKey, msgs) {
+				if errors.Is(result.Err, amqp.ErrClosed) {
+					buffer.remove(flushed)
+					logger.Warn("Channel closed while flushing publish buffer", slog.Int("remaining", buffer.size()))
+					return
+				}
+
+				if result.Err != nil {
+					logger.Error("Buffered message dropped", slog.String("message_id", result.MessageID), slog.Any("error", result.Err))
+				}
+
+				flushed = append(flushed, messages[start+idx])
+			}
+
+			start = end
+		}
+
+		buffer.remove(flushed)
+	}
+}
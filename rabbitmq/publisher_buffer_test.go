@@ -0,0 +1,188 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func getTestBufferedPublisherQueue(bufferConfig *PublishBufferConfig) (*QueueSetup, *testPublishChannel) {
+	queueSetup := getTestPublisherQueue(&PublisherConfig{Buffer: bufferConfig})
+	queueSetup.publishBuffer = newPublishBuffer(bufferConfig)
+
+	channel := newTestPublishChannel(nil)
+	atomic.StoreInt32(&channel.closed, 1)
+	queueSetup.publisherChannel = channel
+	return queueSetup, channel
+}
+
+func getPublishedBodies(channel *testPublishChannel) []string {
+	var bodies []string
+	for _, msg := range channel.getPublished() {
+		bodies = append(bodies, string(msg.Body))
+	}
+
+	return bodies
+}
+
+func TestPublishBufferFlushInOrder(t *testing.T) {
+	queueSetup, _ := getTestBufferedPublisherQueue(&PublishBufferConfig{Size: 3, OverflowPolicy: OverflowReject})
+
+	ctx := context.Background()
+	for idx := 1; idx <= 3; idx++ {
+		results := queueSetup.BatchPublishWithResults(ctx, []string{fmt.Sprintf("message-%d", idx)})
+		if results[0].Err != nil || !results[0].Buffered {
+			t.Fail()
+			t.Logf("expected message-%d buffered, got %+v", idx, results[0])
+			return
+		}
+	}
+
+	if err := queueSetup.PublishWithContext(ctx, "message-4"); !errors.Is(err, ErrPublishBufferFull) {
+		t.Fail()
+		t.Logf("expected buffer full error, got %v", err)
+		return
+	}
+
+	// reconnected
+	channel := newTestPublishChannel(nil)
+	queueSetup.publisherChannel = channel
+	queueSetup.flushPublishBuffer()
+
+	if err := queueSetup.PublishWithContext(ctx, "message-5"); err != nil {
+		t.Fail()
+		t.Log(err.Error())
+		return
+	}
+
+	expected := []string{"message-1", "message-2", "message-3", "message-5"}
+	if fmt.Sprint(getPublishedBodies(channel)) != fmt.Sprint(expected) {
+		t.Fail()
+		t.Logf("expected published %v, got %v", expected, getPublishedBodies(channel))
+		return
+	}
+
+	if queueSetup.publishBuffer.isActive() {
+		t.Fail()
+		t.Log("expected buffer inactive after flushed")
+		return
+	}
+
+	t.Log("success flush buffered message in order")
+	return
+}
+
+func TestPublishBufferDropOldest(t *testing.T) {
+	queueSetup, _ := getTestBufferedPublisherQueue(&PublishBufferConfig{Size: 2, OverflowPolicy: OverflowDropOldest})
+
+	for idx := 1; idx <= 3; idx++ {
+		if err := queueSetup.PublishWithContext(context.Background(), fmt.Sprintf("message-%d", idx)); err != nil {
+			t.Fail()
+			t.Log(err.Error())
+			return
+		}
+	}
+
+	channel := newTestPublishChannel(nil)
+	queueSetup.publisherChannel = channel
+	queueSetup.flushPublishBuffer()
+
+	if fmt.Sprint(getPublishedBodies(channel)) != fmt.Sprint([]string{"message-2", "message-3"}) {
+		t.Fail()
+		t.Logf("expected oldest message dropped, got %v", getPublishedBodies(channel))
+		return
+	}
+
+	t.Log("success drop oldest buffered message")
+	return
+}
+
+func TestPublishBufferRemoveReusedMessageID(t *testing.T) {
+	buffer := newPublishBuffer(&PublishBufferConfig{Size: 3})
+	for idx := 1; idx <= 3; idx++ {
+		msg := amqp.Publishing{MessageId: "order-1", Body: []byte(fmt.Sprintf("message-%d", idx))} // caller reuse message id
+		_, _, _ = buffer.push(context.Background(), bufferedMessage{routingKey: "orders", msg: msg}, true)
+	}
+
+	buffer.remove(buffer.peek(1))
+	messages := buffer.peek(3)
+	if len(messages) != 2 || string(messages[0].msg.Body) != "message-2" {
+		t.Fail()
+		t.Logf("expected only flushed message removed, got %d remaining", len(messages))
+		return
+	}
+
+	t.Log("success remove flushed message with reused message id")
+	return
+}
+
+func TestPublishBufferBlock(t *testing.T) {
+	queueSetup, _ := getTestBufferedPublisherQueue(&PublishBufferConfig{Size: 1, OverflowPolicy: OverflowBlock})
+
+	ctx := context.Background()
+	_ = queueSetup.PublishWithContext(ctx, "message-1")
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := queueSetup.PublishWithContext(timeoutCtx, "message-timeout"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fail()
+		t.Logf("expected publish blocked until context done, got %v", err)
+		return
+	}
+
+	published := make(chan error, 1)
+	go func() {
+		published <- queueSetup.PublishWithContext(ctx, "message-2")
+	}()
+
+	time.Sleep(20 * time.Millisecond) // message-2 waiting for buffer space
+	channel := newTestPublishChannel(nil)
+	queueSetup.channelMutex.Lock()
+	queueSetup.publisherChannel = channel
+	queueSetup.channelMutex.Unlock()
+	queueSetup.flushPublishBuffer()
+
+	select {
+	case err := <-published:
+		if err != nil {
+			t.Fail()
+			t.Log(err.Error())
+			return
+		}
+	case <-time.After(time.Second):
+		t.Fail()
+		t.Log("expected blocked publish released after flush")
+		return
+	}
+
+	queueSetup.flushPublishBuffer() // message-2 can be buffered after first flush finished
+	if fmt.Sprint(getPublishedBodies(channel)) != fmt.Sprint([]string{"message-1", "message-2"}) {
+		t.Fail()
+		t.Logf("unexpected published message %v", getPublishedBodies(channel))
+		return
+	}
+
+	t.Log("success block publish until buffer have space")
+	return
+}
+
+func TestPublishBufferFlushStoppedOnClosedChannel(t *testing.T) {
+	queueSetup, closedChannel := getTestBufferedPublisherQueue(&PublishBufferConfig{})
+
+	_ = queueSetup.BatchPublishWithResults(context.Background(), []string{"message-1", "message-2"})
+	queueSetup.flushPublishBuffer() // still closed
+
+	if queueSetup.publishBuffer.size() != 2 || !queueSetup.publishBuffer.isActive() || len(closedChannel.getPublished()) != 0 {
+		t.Fail()
+		t.Logf("expected message kept on buffer, got %d", queueSetup.publishBuffer.size())
+		return
+	}
+
+	t.Log("success keep buffered message while channel closed")
+	return
+}
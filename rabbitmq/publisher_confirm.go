@@ -0,0 +1,252 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const defaultConfirmTimeout = 5 * time.Second
+
+// ErrPublishNacked broker can't handle the message, ex: queue length limit reached with reject-publish overflow
+var ErrPublishNacked = errors.New("message nacked by broker")
+
+// ReturnedError message published with Mandatory true, but didn't routed to any queue
+type ReturnedError struct {
+	Return amqp.Return
+}
+
+func (err *ReturnedError) Error() string {
+	return fmt.Sprintf("message returned by broker [%d] %s, exchange [%s] routing key [%s]",
+		err.Return.ReplyCode, err.Return.ReplyText, err.Return.Exchange, err.Return.RoutingKey)
+}
+
+type PublishResult struct {
+	Index     int // index message on batch
+	MessageID string
+	Err       error
+	Buffered  bool // If true, message is published after reconnected, see PublishBufferConfig
+}
+
+type pendingConfirm struct {
+	messageID string
+	result    chan error
+}
+
+// publisherConfirm track broker ack/nack for every delivery tag on confirm mode channel,
+// returned message is matched using message id, broker always send basic.return before basic.ack
+type publisherConfirm struct {
+	mutex    sync.Mutex
+	pending  map[uint64]pendingConfirm
+	returned map[string]amqp.Return
+}
+
+// newPublisherConfirm set up confirm mode on the channel, nil confirm if publisher is not using ConfirmMode
+func (base *QueueSetup) newPublisherConfirm(channel *amqp.Channel) (*publisherConfirm, error) {
+	publishConfig := base.queueConfig.QueuePublisherConfig
+	if !publishConfig.ConfirmMode {
+		if publishConfig.Mandatory {
+			// no confirm to wait, only able to log returned message
+			go listenReturnedMessage(base.getLogger(), channel.NotifyReturn(make(chan amqp.Return, 1)))
+		}
+
+		return nil, nil
+	}
+
+	err := channel.Confirm(false)
+	if err != nil {
+		return nil, err
+	}
+
+	confirm := &publisherConfirm{
+		pending:  make(map[uint64]pendingConfirm),
+		returned: make(map[string]amqp.Return),
+	}
+
+	// unbuffered, so return and confirm received on the same order broker send it
+	confirms := channel.NotifyPublish(make(chan amqp.Confirmation))
+	returns := channel.NotifyReturn(make(chan amqp.Return))
+	go confirm.listen(confirms, returns)
+
+	return confirm, nil
+}
+
+// setupPublisherChannel replace publisher channel and confirm together,
+// so publish never pair the channel with confirm listener of other channel
+func (base *QueueSetup) setupPublisherChannel(channel *amqp.Channel) error {
+	confirm, err := base.newPublisherConfirm(channel)
+	if err != nil {
+		return err
+	}
+
+	base.channelMutex.Lock()
+	base.publisherChannel = channel
+	base.publisherConfirm = confirm
+	base.channelMutex.Unlock()
+	return nil
+}
+
+func listenReturnedMessage(logger *slog.Logger, returns <-chan amqp.Return) {
+	for returned := range returns {
+		logger.Warn("Message returned by broker",
+			slog.Int("reply_code", int(returned.ReplyCode)),
+			slog.String("reply_text", returned.ReplyText),
+			slog.String("routing_key", returned.RoutingKey),
+			slog.String("message_id", returned.MessageId),
+		)
+	}
+}
+
+func (confirm *publisherConfirm) listen(confirms <-chan amqp.Confirmation, returns <-chan amqp.Return) {
+	for confirms != nil || returns != nil {
+		select {
+		case returned, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+
+			confirm.mutex.Lock()
+			confirm.returned[returned.MessageId] = returned
+			confirm.mutex.Unlock()
+		case confirmation, ok := <-confirms:
+			if !ok {
+				confirms = nil
+				continue
+			}
+
+			confirm.resolve(confirmation)
+		}
+	}
+
+	// channel closed, message without confirmation is unknown state
+	confirm.mutex.Lock()
+	defer confirm.mutex.Unlock()
+	for deliveryTag, pending := range confirm.pending {
+		pending.result <- amqp.ErrClosed
+		delete(confirm.pending, deliveryTag)
+	}
+}
+
+func (confirm *publisherConfirm) resolve(confirmation amqp.Confirmation) {
+	confirm.mutex.Lock()
+	defer confirm.mutex.Unlock()
+
+	pending, ok := confirm.pending[confirmation.DeliveryTag]
+	if !ok {
+		return // publisher already gave up waiting
+	}
+	delete(confirm.pending, confirmation.DeliveryTag)
+
+	returned, isReturned := confirm.returned[pending.messageID]
+	delete(confirm.returned, pending.messageID)
+
+	switch {
+	case isReturned:
+		pending.result <- &ReturnedError{Return: returned}
+	case !confirmation.Ack:
+		pending.result <- ErrPublishNacked
+	default:
+		pending.result <- nil
+	}
+}
+
+func (confirm *publisherConfirm) register(deliveryTag uint64, messageID string) chan error {
+	result := make(chan error, 1)
+
+	confirm.mutex.Lock()
+	confirm.pending[deliveryTag] = pendingConfirm{messageID: messageID, result: result}
+	confirm.mutex.Unlock()
+
+	return result
+}
+
+func (confirm *publisherConfirm) unregister(deliveryTag uint64) {
+	confirm.mutex.Lock()
+	defer confirm.mutex.Unlock()
+
+	if pending, ok := confirm.pending[deliveryTag]; ok {
+		delete(confirm.returned, pending.messageID)
+		delete(confirm.pending, deliveryTag)
+	}
+}
+
+// publishWithConfirm publish all messages first, then wait confirmation for every message
+func (base *QueueSetup) publishWithConfirm(ctx context.Context, channel publishChannel, confirm *publisherConfirm, routingKey string, msgs []amqp.Publishing) []PublishResult {
+	publishConfig := base.queueConfig.QueuePublisherConfig
+
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+		confirmTimeout := publishConfig.ConfirmTimeout
+		if confirmTimeout <= 0 {
+			confirmTimeout = defaultConfirmTimeout
+		}
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, confirmTimeout)
+		defer cancel()
+	}
+
+	results := make([]PublishResult, len(msgs))
+	deliveryTags := make([]uint64, len(msgs))
+	waiters := make([]chan error, len(msgs))
+
+	base.publishMutex.Lock() // sequence number only valid if publish is serialized
+	for idx, msg := range msgs {
+		if msg.MessageId == "" {
+			msg.MessageId = uuid.New().String() // needed to match returned message
+		}
+
+		results[idx] = PublishResult{Index: idx, MessageID: msg.MessageId}
+
+		deliveryTag := channel.GetNextPublishSeqNo()
+		waiter := confirm.register(deliveryTag, msg.MessageId)
+
+		err := channel.PublishWithContext(
+			ctx,
+			base.exchangeName,
+			routingKey,
+			publishConfig.Mandatory,
+			publishConfig.Immediate,
+			msg,
+		)
+
+		if err != nil {
+			confirm.unregister(deliveryTag)
+			results[idx].Err = err
+			continue
+		}
+
+		deliveryTags[idx] = deliveryTag
+		waiters[idx] = waiter
+	}
+	base.publishMutex.Unlock()
+
+	for idx, waiter := range waiters {
+		if waiter == nil {
+			continue
+		}
+
+		select {
+		case err := <-waiter:
+			results[idx].Err = err
+			continue
+		default:
+		}
+
+		select {
+		case err := <-waiter:
+			results[idx].Err = err
+		case <-ctx.Done():
+			confirm.unregister(deliveryTags[idx])
+			results[idx].Err = fmt.Errorf("waiting publish confirmation: %w", ctx.Err())
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,59 @@
+package rabbitmq
+
+import (
+	"errors"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestPublisherConfirmListen(t *testing.T) {
+	confirm := &publisherConfirm{
+		pending:  make(map[uint64]pendingConfirm),
+		returned: make(map[string]amqp.Return),
+	}
+
+	confirms := make(chan amqp.Confirmation)
+	returns := make(chan amqp.Return)
+	go confirm.listen(confirms, returns)
+
+	ackedWaiter := confirm.register(1, "message-1")
+	returnedWaiter := confirm.register(2, "message-2")
+	nackedWaiter := confirm.register(3, "message-3")
+	closedWaiter := confirm.register(4, "message-4")
+
+	confirms <- amqp.Confirmation{DeliveryTag: 1, Ack: true}
+	returns <- amqp.Return{MessageId: "message-2", ReplyCode: amqp.NoRoute, ReplyText: "NO_ROUTE"}
+	confirms <- amqp.Confirmation{DeliveryTag: 2, Ack: true}
+	confirms <- amqp.Confirmation{DeliveryTag: 3, Ack: false}
+
+	if err := <-ackedWaiter; err != nil {
+		t.Fail()
+		t.Logf("acked message should not return error, got %v", err)
+		return
+	}
+
+	var returnedErr *ReturnedError
+	if err := <-returnedWaiter; !errors.As(err, &returnedErr) || returnedErr.Return.ReplyCode != amqp.NoRoute {
+		t.Fail()
+		t.Logf("expected returned error, got %v", err)
+		return
+	}
+
+	if err := <-nackedWaiter; !errors.Is(err, ErrPublishNacked) {
+		t.Fail()
+		t.Logf("expected nacked error, got %v", err)
+		return
+	}
+
+	close(confirms)
+	close(returns)
+	if err := <-closedWaiter; !errors.Is(err, amqp.ErrClosed) {
+		t.Fail()
+		t.Logf("expected closed error for unconfirmed message, got %v", err)
+		return
+	}
+
+	t.Log("success match publisher confirmation")
+	return
+}
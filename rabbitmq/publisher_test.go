@@ -0,0 +1,322 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestPublishOptions(t *testing.T) {
+	msg := amqp.Publishing{Headers: amqp.Table{"source": "order-service"}, Priority: 1}
+
+	var nilOptions *PublishOptions
+	nilOptions.apply(&msg)
+	if nilOptions.getRoutingKey("order-created") != "order-created" || msg.Priority != 1 {
+		t.Fail()
+		t.Log("nil options should keep default routing key and properties")
+		return
+	}
+
+	options := &PublishOptions{
+		RoutingKey:    "order.retail.created",
+		Headers:       amqp.Table{"event_type": "order-created"},
+		Priority:      5,
+		Expiration:    time.Minute,
+		MessageID:     "message-1",
+		CorrelationID: "correlation-1",
+	}
+
+	publisherHeaders := msg.Headers
+	options.apply(&msg)
+
+	if options.getRoutingKey("order-created") != "order.retail.created" {
+		t.Fail()
+		t.Log("expected routing key from options")
+		return
+	}
+
+	if msg.Headers["source"] != "order-service" || msg.Headers["event_type"] != "order-created" || len(publisherHeaders) != 1 {
+		t.Fail()
+		t.Logf("expected headers merged without changing publisher headers, got %v", msg.Headers)
+		return
+	}
+
+	if msg.Priority != 5 || msg.Expiration != "60000" || msg.MessageId != "message-1" || msg.CorrelationId != "correlation-1" {
+		t.Fail()
+		t.Logf("unexpected message properties %+v", msg)
+		return
+	}
+
+	t.Log("success apply publish options")
+	return
+}
+
+func TestPublishWithOptionsRouting(t *testing.T) {
+	ctx := context.Background()
+	broker := NewMemoryBroker()
+	_ = broker.DeclareExchange("order", amqp.ExchangeTopic)
+	_ = broker.DeclareExchange("order-headers", amqp.ExchangeHeaders)
+	_ = broker.DeclareQueue("retail-order", nil)
+	_ = broker.DeclareQueue("paid-order", nil)
+	_ = broker.BindQueue("retail-order", "order.retail.*", "order", nil)
+	_ = broker.BindQueue("paid-order", "", "order-headers", amqp.Table{"event_type": "order-paid"})
+
+	topicQueue := broker.Queue("order", "order-created")
+	_ = topicQueue.Publish(`{"event_type": "order-created"}`) // default routing key is queue name, not matched
+	_ = topicQueue.PublishWithOptions(ctx, `{"event_type": "order-created"}`, &PublishOptions{RoutingKey: "order.retail.created"})
+
+	headersQueue := broker.Queue("order-headers", "order-paid")
+	_ = headersQueue.PublishWithOptions(ctx, `{"event_type": "order-paid"}`, &PublishOptions{Headers: amqp.Table{"event_type": "order-paid"}})
+	_ = headersQueue.PublishWithOptions(ctx, `{"event_type": "order-created"}`, &PublishOptions{Headers: amqp.Table{"event_type": "order-created"}})
+
+	if broker.MessageCount("retail-order") != 1 || broker.MessageCount("paid-order") != 1 {
+		t.Fail()
+		t.Logf("unexpected routed message retail %d, paid %d", broker.MessageCount("retail-order"), broker.MessageCount("paid-order"))
+		return
+	}
+
+	t.Log("success publish using routing key and headers")
+	return
+}
+
+// testPublishChannel record published message, every publish is acked when confirms is set
+type testPublishChannel struct {
+	mutex      sync.Mutex
+	sequence   uint64
+	published  []amqp.Publishing
+	inFlight   int32
+	concurrent int32
+	closed     int32
+	confirms   chan uint64
+}
+
+func newTestPublishChannel(confirms chan<- amqp.Confirmation) *testPublishChannel {
+	channel := &testPublishChannel{}
+	if confirms != nil {
+		channel.confirms = make(chan uint64, 1024)
+		go func() {
+			for deliveryTag := range channel.confirms {
+				confirms <- amqp.Confirmation{DeliveryTag: deliveryTag, Ack: true}
+			}
+		}()
+	}
+
+	return channel
+}
+
+func (channel *testPublishChannel) GetNextPublishSeqNo() uint64 {
+	channel.mutex.Lock()
+	defer channel.mutex.Unlock()
+	return channel.sequence + 1
+}
+
+func (channel *testPublishChannel) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	if atomic.LoadInt32(&channel.closed) == 1 {
+		return amqp.ErrClosed
+	}
+
+	if atomic.AddInt32(&channel.inFlight, 1) > 1 {
+		atomic.StoreInt32(&channel.concurrent, 1)
+	}
+	defer atomic.AddInt32(&channel.inFlight, -1)
+
+	time.Sleep(10 * time.Microsecond) // widen window for concurrent publish
+
+	channel.mutex.Lock()
+	channel.sequence++
+	channel.published = append(channel.published, msg)
+	deliveryTag := channel.sequence
+	channel.mutex.Unlock()
+
+	if channel.confirms != nil {
+		channel.confirms <- deliveryTag
+	}
+
+	return nil
+}
+
+func (channel *testPublishChannel) getPublished() []amqp.Publishing {
+	channel.mutex.Lock()
+	defer channel.mutex.Unlock()
+	return append([]amqp.Publishing(nil), channel.published...)
+}
+
+func getTestPublisherQueue(publisherConfig *PublisherConfig) *QueueSetup {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &QueueSetup{
+		queueName:   "order-created",
+		ctx:         ctx,
+		cancel:      cancel,
+		queueConfig: &QueueConfig{QueuePublisherConfig: publisherConfig},
+	}
+}
+
+func TestConcurrentPublish(t *testing.T) {
+	const totalGoroutine, totalMessage = 20, 25
+
+	queueSetup := getTestPublisherQueue(&PublisherConfig{
+		Msg: amqp.Publishing{ContentType: ContentTypeJSON, Headers: amqp.Table{"source": "order-service"}},
+	})
+
+	queueSetup.AddPublishInterceptor(func(ctx context.Context, msg *amqp.Publishing) error {
+		msg.Headers["intercepted"] = true // headers is copied for every message
+		return nil
+	})
+
+	channel := newTestPublishChannel(nil)
+	queueSetup.publisherChannel = channel
+
+	var waitGroup sync.WaitGroup
+	var totalErr int32
+	for goroutine := 0; goroutine < totalGoroutine; goroutine++ {
+		waitGroup.Add(1)
+		go func(goroutine int) {
+			defer waitGroup.Done()
+			for idx := 0; idx < totalMessage; idx++ {
+				err := queueSetup.PublishWithOptions(context.Background(), fmt.Sprintf("message-%d-%d", goroutine, idx), &PublishOptions{
+					Headers: amqp.Table{"goroutine": goroutine},
+				})
+				if err != nil {
+					atomic.AddInt32(&totalErr, 1)
+				}
+			}
+		}(goroutine)
+	}
+	waitGroup.Wait()
+
+	published := channel.getPublished()
+	if totalErr > 0 || len(published) != totalGoroutine*totalMessage {
+		t.Fail()
+		t.Logf("expected %d message published, got %d with %d error", totalGoroutine*totalMessage, len(published), totalErr)
+		return
+	}
+
+	if atomic.LoadInt32(&channel.concurrent) == 1 {
+		t.Fail()
+		t.Log("publish on channel should be serialized")
+		return
+	}
+
+	messageIDs := make(map[string]bool)
+	bodies := make(map[string]bool)
+	for _, msg := range published {
+		if msg.Timestamp.IsZero() || msg.Headers["intercepted"] != true || msg.Headers["source"] != "order-service" {
+			t.Fail()
+			t.Logf("unexpected message properties %+v", msg)
+			return
+		}
+
+		messageIDs[msg.MessageId] = true
+		bodies[string(msg.Body)] = true
+	}
+
+	if len(messageIDs) != len(published) || len(bodies) != len(published) {
+		t.Fail()
+		t.Logf("expected unique message id and body, got %d id and %d body", len(messageIDs), len(bodies))
+		return
+	}
+
+	publisherConfig := queueSetup.queueConfig.QueuePublisherConfig
+	if len(publisherConfig.Msg.Headers) != 1 || publisherConfig.Msg.Body != nil || !publisherConfig.Msg.Timestamp.IsZero() {
+		t.Fail()
+		t.Logf("publisher config message should not be changed, got %+v", publisherConfig.Msg)
+		return
+	}
+
+	t.Log("success publish from multiple goroutine")
+	return
+}
+
+func TestConcurrentPublishWithConfirm(t *testing.T) {
+	const totalGoroutine, totalMessage = 10, 10
+
+	queueSetup := getTestPublisherQueue(&PublisherConfig{ConfirmMode: true, ConfirmTimeout: 5 * time.Second})
+
+	confirm := &publisherConfirm{
+		pending:  make(map[uint64]pendingConfirm),
+		returned: make(map[string]amqp.Return),
+	}
+
+	confirms := make(chan amqp.Confirmation)
+	returns := make(chan amqp.Return)
+	go confirm.listen(confirms, returns)
+	defer close(returns)
+
+	channel := newTestPublishChannel(confirms)
+	queueSetup.publisherChannel = channel
+	queueSetup.publisherConfirm = confirm
+
+	var waitGroup sync.WaitGroup
+	var totalErr int32
+	for goroutine := 0; goroutine < totalGoroutine; goroutine++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+
+			messages := make([]string, totalMessage)
+			for idx := range messages {
+				messages[idx] = fmt.Sprintf("message-%d", idx)
+			}
+
+			for _, result := range queueSetup.BatchPublishWithResults(context.Background(), messages) {
+				if result.Err != nil {
+					atomic.AddInt32(&totalErr, 1)
+				}
+			}
+		}()
+	}
+	waitGroup.Wait()
+
+	if totalErr > 0 || len(channel.getPublished()) != totalGoroutine*totalMessage {
+		t.Fail()
+		t.Logf("expected every message confirmed, got %d error", totalErr)
+		return
+	}
+
+	t.Log("success publish with confirm from multiple goroutine")
+	return
+}
+
+func TestPublishOnReplacedChannel(t *testing.T) {
+	queueSetup := getTestPublisherQueue(&PublisherConfig{})
+	queueSetup.publisherChannel = newTestPublishChannel(nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for idx := 0; idx < 20; idx++ {
+			// same as openChannel on reconnect
+			queueSetup.channelMutex.Lock()
+			queueSetup.publisherChannel = newTestPublishChannel(nil)
+			queueSetup.channelMutex.Unlock()
+		}
+	}()
+
+	for idx := 0; idx < 50; idx++ {
+		if err := queueSetup.PublishWithContext(context.Background(), "message"); err != nil {
+			t.Fail()
+			t.Log(err.Error())
+			return
+		}
+	}
+	<-done
+
+	queueSetup.channelMutex.Lock()
+	queueSetup.publisherChannel = nil
+	queueSetup.channelMutex.Unlock()
+
+	if err := queueSetup.PublishWithContext(context.Background(), "message"); !errors.Is(err, amqp.ErrClosed) {
+		t.Fail()
+		t.Logf("expected closed error without channel, got %v", err)
+		return
+	}
+
+	t.Log("success publish while channel replaced")
+	return
+}
@@ -0,0 +1,357 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	HeaderRPCError = "x-rpc-error"
+
+	directReplyTo = "amq.rabbitmq.reply-to"
+)
+
+var ErrRPCClientClosed = errors.New("rpc client already closed")
+
+// RPCError error returned by rpc server handler
+type RPCError struct {
+	Message string
+}
+
+func (err *RPCError) Error() string {
+	return fmt.Sprintf("rpc server error: %s", err.Message)
+}
+
+type RPCClientConfig struct {
+	UseExclusiveQueue bool          // If true, reply received on exclusive queue, default using direct reply-to
+	Timeout           time.Duration // used when context didn't have deadline, default 10 second
+	ContentType       string        // default application/json
+}
+
+/*
+RPCClient send request to rpc server queue and wait for the reply
+
+	Example
+	queue := NewBaseQueue("", "invoice-rpc") // queue used by rpc server
+	client := NewRPCClient(queue, nil)
+	defer client.Close()
+
+	reply, err := client.Call(ctx, []byte(`{"transaction_uuid": "uuid-123"}`))
+*/
+type RPCClient struct {
+	queue  *QueueSetup
+	config RPCClientConfig
+
+	mutex   sync.Mutex
+	channel *amqp.Channel
+	replyTo string
+	pending map[string]chan rpcReply
+	closed  bool
+}
+
+type rpcReply struct {
+	delivery amqp.Delivery
+	err      error // reply channel closed before reply received
+}
+
+// NewRPCClient queue only used for the connection and target exchange and queue name, nil config use direct reply-to
+func NewRPCClient(queue *QueueSetup, config *RPCClientConfig) *RPCClient {
+	if config == nil {
+		config = &RPCClientConfig{}
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	if config.ContentType == "" {
+		config.ContentType = ContentTypeJSON
+	}
+
+	return &RPCClient{
+		queue:   queue,
+		config:  *config,
+		pending: make(map[string]chan rpcReply),
+	}
+}
+
+// openChannel open channel for publish request and consume reply, direct reply-to need both on the same channel.
+// channel and reply consumer is opened again on next call after the channel closed, connection of queue without
+// reconnect goroutine (queue not using AddPublisher or AddConsumer) is also opened again
+func (client *RPCClient) openChannel() (*amqp.Channel, string, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if client.closed {
+		return nil, "", ErrRPCClientClosed
+	}
+
+	if client.channel != nil && !client.channel.IsClosed() {
+		return client.channel, client.replyTo, nil
+	}
+
+	if client.queue.ctx.Err() != nil { // queue already closed
+		return nil, "", amqp.ErrClosed
+	}
+
+	connection := client.queue.getConnection()
+	if (connection == nil || connection.IsClosed()) && !client.queue.isReconnectRunning() {
+		err := client.queue.openConnection()
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	channel, err := client.queue.newChannel()
+	if err != nil {
+		return nil, "", err
+	}
+
+	replyTo := directReplyTo
+	if client.config.UseExclusiveQueue {
+		replyQueue, err := channel.QueueDeclare("", false, true, true, false, nil)
+		if err != nil {
+			_ = channel.Close()
+			return nil, "", err
+		}
+
+		replyTo = replyQueue.Name
+	}
+
+	replies, err := channel.Consume(replyTo, "", true, client.config.UseExclusiveQueue, false, false, nil)
+	if err != nil {
+		_ = channel.Close()
+		return nil, "", err
+	}
+
+	returns := channel.NotifyReturn(make(chan amqp.Return, 1))
+	closes := channel.NotifyClose(newCloseNotify())
+	go client.listen(channel, replies, returns, closes)
+
+	client.channel = channel
+	client.replyTo = replyTo
+	return channel, replyTo, nil
+}
+
+func (client *RPCClient) listen(channel *amqp.Channel, replies <-chan amqp.Delivery, returns <-chan amqp.Return, closes <-chan *amqp.Error) {
+	for replies != nil || returns != nil || closes != nil {
+		select {
+		case reply, ok := <-replies:
+			if !ok {
+				replies = nil
+				continue
+			}
+
+			client.dispatch(reply.CorrelationId, rpcReply{delivery: reply})
+		case returned, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+
+			// request didn't routed to any queue, rpc server is not available
+			client.dispatch(returned.CorrelationId, rpcReply{delivery: amqp.Delivery{
+				CorrelationId: returned.CorrelationId,
+				Headers:       amqp.Table{HeaderRPCError: fmt.Sprintf("request returned by broker [%d] %s", returned.ReplyCode, returned.ReplyText)},
+			}})
+		case <-closes:
+			closes = nil
+			client.failPending(channel)
+		}
+	}
+}
+
+// failPending reply for pending call on closed channel is never received, so the caller get amqp.ErrClosed
+// instead of waiting until timeout
+func (client *RPCClient) failPending(channel *amqp.Channel) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if client.channel == channel {
+		client.channel = nil
+	}
+
+	for correlationID, waiter := range client.pending {
+		waiter <- rpcReply{err: amqp.ErrClosed}
+		delete(client.pending, correlationID)
+	}
+}
+
+func (client *RPCClient) dispatch(correlationID string, reply rpcReply) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	waiter, ok := client.pending[correlationID]
+	if !ok {
+		return // caller already gave up waiting
+	}
+
+	delete(client.pending, correlationID)
+	waiter <- reply
+}
+
+func (client *RPCClient) register(correlationID string) chan rpcReply {
+	waiter := make(chan rpcReply, 1)
+
+	client.mutex.Lock()
+	client.pending[correlationID] = waiter
+	client.mutex.Unlock()
+
+	return waiter
+}
+
+func (client *RPCClient) unregister(correlationID string) {
+	client.mutex.Lock()
+	delete(client.pending, correlationID)
+	client.mutex.Unlock()
+}
+
+// Call publish request and wait for the reply, return RPCError if server handler return error
+func (client *RPCClient) Call(ctx context.Context, request []byte) ([]byte, error) {
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, client.config.Timeout)
+		defer cancel()
+	}
+
+	channel, replyTo, err := client.openChannel()
+	if err != nil {
+		return nil, err
+	}
+
+	correlationID := uuid.New().String()
+	msg := amqp.Publishing{
+		ContentType:   client.config.ContentType,
+		CorrelationId: correlationID,
+		ReplyTo:       replyTo,
+		MessageId:     uuid.New().String(),
+		Timestamp:     time.Now(),
+		Body:          request,
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining := time.Until(deadline).Milliseconds()
+		if remaining <= 0 {
+			return nil, fmt.Errorf("waiting rpc reply: %w", context.DeadlineExceeded)
+		}
+
+		// request is not handled by server after caller gave up waiting
+		msg.Expiration = fmt.Sprintf("%d", remaining)
+	}
+
+	err = client.queue.intercept(ctx, &msg)
+	if err != nil {
+		return nil, err
+	}
+
+	waiter := client.register(correlationID)
+	err = channel.PublishWithContext(ctx, client.queue.exchangeName, client.queue.queueName, true, false, msg)
+	if err != nil {
+		client.unregister(correlationID)
+		return nil, err
+	}
+
+	select {
+	case reply := <-waiter:
+		if reply.err != nil {
+			return nil, fmt.Errorf("waiting rpc reply: %w", reply.err)
+		}
+
+		if errMessage, ok := reply.delivery.Headers[HeaderRPCError].(string); ok {
+			return nil, &RPCError{Message: errMessage}
+		}
+
+		return reply.delivery.Body, nil
+	case <-ctx.Done():
+		client.unregister(correlationID)
+		return nil, fmt.Errorf("waiting rpc reply: %w", ctx.Err())
+	}
+}
+
+func (client *RPCClient) Close() {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.closed = true
+	if client.channel != nil {
+		_ = client.channel.Close()
+	}
+}
+
+// RPCHandler returned reply sent to the caller, returned error sent to the caller as RPCError
+type RPCHandler func(ctx context.Context, delivery amqp.Delivery) ([]byte, error)
+
+/*
+ServeRPC consume request using the consumer loop and reply to the caller, queue need to be set up using AddConsumer.
+request is always acked, error is sent to the caller instead of retried
+
+	Example
+	queue := NewBaseQueue("", "invoice-rpc").
+		SetupQueue(nil, &ConsumerConfig{Workers: 5}).
+		AddConsumer(false)
+
+	queue.ServeRPC(func(ctx context.Context, delivery amqp.Delivery) ([]byte, error) {
+		return json.Marshal(getInvoice(delivery.Body))
+	})
+*/
+func (base *QueueSetup) ServeRPC(handler RPCHandler) {
+	base.consume(base.newRPCDeliveryHandler(handler))
+}
+
+func (base *QueueSetup) newRPCDeliveryHandler(handler RPCHandler) DeliveryHandler {
+	return func(ctx context.Context, delivery amqp.Delivery) error {
+		reply, err := handleRPCRequest(ctx, handler, delivery)
+		if err != nil {
+			LoggerFromContext(ctx).Error("Error handle rpc request", slog.Any("error", err))
+		}
+
+		if delivery.ReplyTo == "" {
+			LoggerFromContext(ctx).Warn("Rpc request without reply to, reply is not sent")
+			return nil
+		}
+
+		msg := amqp.Publishing{
+			ContentType:   delivery.ContentType,
+			CorrelationId: delivery.CorrelationId,
+			Timestamp:     time.Now(),
+			Body:          reply,
+		}
+
+		if err != nil {
+			msg.Headers = amqp.Table{HeaderRPCError: err.Error()}
+			msg.Body = nil
+		}
+
+		channel, _ := base.getPublishChannel()
+		if channel == nil {
+			LoggerFromContext(ctx).Error("Error publish rpc reply", slog.Any("error", ErrChannelNotOpen))
+			return nil
+		}
+
+		errPublish := channel.PublishWithContext(ctx, "", delivery.ReplyTo, false, false, msg)
+		if errPublish != nil {
+			LoggerFromContext(ctx).Error("Error publish rpc reply", slog.Any("error", errPublish))
+		}
+
+		return nil
+	}
+}
+
+// handleRPCRequest panic on handler is sent to the caller as error, so the request is not retried
+func handleRPCRequest(ctx context.Context, handler RPCHandler, delivery amqp.Delivery) (reply []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			reply = nil
+			err = fmt.Errorf("panic during rpc handling: %v", r)
+		}
+	}()
+
+	return handler(ctx, delivery)
+}
@@ -0,0 +1,133 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestRPCClientDispatchReply(t *testing.T) {
+	client := NewRPCClient(&QueueSetup{queueName: "invoice-rpc"}, nil)
+
+	waiter := client.register("correlation-1")
+	client.dispatch("correlation-2", rpcReply{delivery: amqp.Delivery{Body: []byte("other reply")}}) // reply for other caller
+	client.dispatch("correlation-1", rpcReply{delivery: amqp.Delivery{Body: []byte("reply")}})
+
+	select {
+	case reply := <-waiter:
+		if string(reply.delivery.Body) != "reply" {
+			t.Fail()
+			t.Logf("unexpected reply [%s]", string(reply.delivery.Body))
+			return
+		}
+	default:
+		t.Fail()
+		t.Log("reply should be dispatched to caller with the same correlation id")
+		return
+	}
+
+	if len(client.pending) != 0 {
+		t.Fail()
+		t.Log("pending call should be removed after reply received")
+		return
+	}
+
+	// reply channel closed, pending call is not waiting until timeout
+	waiter = client.register("correlation-3")
+	client.failPending(nil)
+
+	select {
+	case reply := <-waiter:
+		if !errors.Is(reply.err, amqp.ErrClosed) {
+			t.Fail()
+			t.Logf("expected amqp.ErrClosed, got %v", reply.err)
+			return
+		}
+	default:
+		t.Fail()
+		t.Log("pending call should be failed when reply channel closed")
+		return
+	}
+
+	client.Close()
+	if _, _, err := client.openChannel(); !errors.Is(err, ErrRPCClientClosed) {
+		t.Fail()
+		t.Logf("expected closed client error, got %v", err)
+		return
+	}
+
+	t.Log("success dispatch rpc reply")
+	return
+}
+
+func TestRPCClientQueueClosed(t *testing.T) {
+	queue := newQueueSetup("", "invoice-rpc", &ConnectionConfig{Hosts: []string{"127.0.0.1:1"}})
+	queue.cancel() // queue closed
+
+	client := NewRPCClient(queue, nil)
+	if _, err := client.Call(context.Background(), []byte(`{}`)); !errors.Is(err, amqp.ErrClosed) {
+		t.Fail()
+		t.Logf("expected amqp.ErrClosed without dialing closed queue, got %v", err)
+		return
+	}
+
+	t.Log("success return error on closed queue")
+	return
+}
+
+func TestServeRPCReplyError(t *testing.T) {
+	channel := newTestPublishChannel(nil)
+	queueSetup := getTestPublisherQueue(nil)
+	queueSetup.publisherChannel = channel
+
+	handlers := []RPCHandler{
+		func(ctx context.Context, delivery amqp.Delivery) ([]byte, error) {
+			return []byte(`{"status": "PAID"}`), nil
+		},
+		func(ctx context.Context, delivery amqp.Delivery) ([]byte, error) {
+			return nil, errors.New("invoice not found")
+		},
+		func(ctx context.Context, delivery amqp.Delivery) ([]byte, error) {
+			panic("nil invoice")
+		},
+	}
+
+	for _, handler := range handlers {
+		delivery := amqp.Delivery{ReplyTo: "reply-queue", CorrelationId: "correlation-1"}
+		if err := queueSetup.newRPCDeliveryHandler(handler)(context.Background(), delivery); err != nil {
+			t.Fail()
+			t.Logf("expected rpc request not retried, got %v", err)
+			return
+		}
+	}
+
+	published := channel.getPublished()
+	if len(published) != 3 {
+		t.Fail()
+		t.Logf("expected 3 reply, got %d", len(published))
+		return
+	}
+
+	if string(published[0].Body) != `{"status": "PAID"}` || published[0].Headers[HeaderRPCError] != nil {
+		t.Fail()
+		t.Logf("expected success reply, got %+v", published[0])
+		return
+	}
+
+	if published[1].Headers[HeaderRPCError] != "invoice not found" || published[1].CorrelationId != "correlation-1" {
+		t.Fail()
+		t.Logf("expected handler error reply, got %+v", published[1])
+		return
+	}
+
+	if published[2].Headers[HeaderRPCError] != "panic during rpc handling: nil invoice" {
+		t.Fail()
+		t.Logf("expected panic error reply, got %+v", published[2])
+		return
+	}
+
+	t.Log("success reply rpc error instead of retry")
+	return
+}
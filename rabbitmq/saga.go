@@ -0,0 +1,538 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const HeaderSagaID = "x-saga-id"
+
+var (
+	ErrSagaNotFound  = errors.New("saga not found")
+	ErrSagaExists    = errors.New("saga already exists")
+	ErrSagaConflict  = errors.New("saga updated by other process") // version changed since loaded, load and handle again
+	ErrSagaIDMissing = errors.New("saga id is not found on message")
+)
+
+type SagaStatus string
+
+const (
+	SagaRunning      SagaStatus = "running"
+	SagaWaiting      SagaStatus = "waiting" // waiting event of the current step
+	SagaCompleted    SagaStatus = "completed"
+	SagaCompensating SagaStatus = "compensating"
+	SagaCompensated  SagaStatus = "compensated"
+	SagaFailed       SagaStatus = "failed" // compensation failed, need manual action
+)
+
+// SagaInstance persisted state of one saga, Data is shared by every step and stored as json
+type SagaInstance struct {
+	ID              string                 `json:"id"`
+	Name            string                 `json:"name"`
+	Status          SagaStatus             `json:"status"`
+	CurrentStep     int                    `json:"current_step"`
+	Data            map[string]interface{} `json:"data"`
+	Error           string                 `json:"error"`            // error caused compensation
+	CompensateSteps int                    `json:"compensate_steps"` // total executed steps to compensate, set when compensation started
+	Deadline        time.Time              `json:"deadline"`         // current step timeout, or when running saga or compensation is resumed by CheckTimeouts
+	Version         int64                  `json:"version"`          // increased on every save, used for optimistic lock
+	CreatedAt       time.Time              `json:"created_at"`
+	UpdatedAt       time.Time              `json:"updated_at"`
+}
+
+// hasDeadline saga kept on store deadline index, see SagaStore.FindExpired
+func (instance *SagaInstance) hasDeadline() bool {
+	switch instance.Status {
+	case SagaRunning, SagaWaiting, SagaCompensating:
+		return !instance.Deadline.IsZero()
+	}
+
+	return false
+}
+
+// PublishOptions publish command with saga id, so event sent back by other service can be correlated to the saga
+func (instance *SagaInstance) PublishOptions() *PublishOptions {
+	return &PublishOptions{
+		CorrelationID: instance.ID,
+		Headers:       map[string]interface{}{HeaderSagaID: instance.ID},
+	}
+}
+
+// SagaStore keep saga state between events, Save return ErrSagaConflict if version is not the same as stored
+type SagaStore interface {
+	Get(ctx context.Context, id string) (SagaInstance, error)
+	Save(ctx context.Context, instance *SagaInstance) error                            // version 0 create new saga, return ErrSagaExists if exists
+	FindExpired(ctx context.Context, now time.Time, limit int) ([]SagaInstance, error) // running, waiting or compensating saga with deadline before now
+}
+
+/*
+SagaStep one step of the saga. Action run when the step started, step with WaitFor wait until the event type is received,
+otherwise next step started after Action is done. Compensate run in reverse order for every step that Action already done
+when the saga failed: Action error, FailOn event received or Timeout reached.
+Action can run again for the same saga if the process stopped before state is saved (running saga is resumed by CheckTimeouts
+after RunTimeout), use saga id as idempotency key.
+Compensate can also run again when compensation is resumed by CheckTimeouts after the process stopped
+*/
+type SagaStep struct {
+	Name       string
+	Action     func(ctx context.Context, saga *SagaInstance) error
+	WaitFor    string                                                                        // event type complete the step, ex: invoice-paid
+	OnEvent    func(ctx context.Context, saga *SagaInstance, data ConsumerHandlerData) error // optional, error start compensation
+	FailOn     []string                                                                      // event types fail the step, ex: invoice-expired
+	Timeout    time.Duration                                                                 // max wait for WaitFor event, 0 wait forever
+	Compensate func(ctx context.Context, saga *SagaInstance) error
+}
+
+/*
+SagaDefinition steps of the saga, event correlated to saga using x-saga-id header, then correlation id (see SagaInstance.PublishOptions)
+
+	Checkout Example
+	definition := SagaDefinition{
+		Name: "checkout",
+		Steps: []SagaStep{
+			{
+				Name:       "create-invoice",
+				Action:     func(ctx context.Context, saga *SagaInstance) error { return createInvoice(ctx, saga.ID, saga.Data) },
+				WaitFor:    "invoice-paid", // published by payment callback handler with x-saga-id header
+				FailOn:     []string{"invoice-expired"},
+				Timeout:    24 * time.Hour,
+				Compensate: func(ctx context.Context, saga *SagaInstance) error { return cancelInvoice(ctx, saga.ID) },
+			},
+			{
+				Name: "fulfill",
+				Action: func(ctx context.Context, saga *SagaInstance) error {
+					return fulfillQueue.PublishWithOptions(ctx, string(command), saga.PublishOptions())
+				},
+				WaitFor:    "order-fulfilled",
+				FailOn:     []string{"order-fulfill-failed"},
+				Compensate: func(ctx context.Context, saga *SagaInstance) error { return refund(ctx, saga.ID) },
+			},
+			{
+				Name:   "notify",
+				Action: func(ctx context.Context, saga *SagaInstance) error { return notifyCustomer(ctx, saga.Data) },
+			},
+		},
+	}
+
+	orchestrator, err := NewSagaOrchestrator(definition, NewRedisSagaStore(redisClient, "", 0))
+	checkoutEvents.ConsumeDelivery(orchestrator.Handler())
+	go orchestrator.Run(ctx, time.Minute) // compensate timeout saga
+
+	saga, err := orchestrator.Start(ctx, orderID, map[string]interface{}{"order_id": orderID, "amount": amount})
+*/
+type SagaDefinition struct {
+	Name  string
+	Steps []SagaStep
+
+	// Correlate optional, get saga id from message, default x-saga-id header then correlation id
+	Correlate func(delivery amqp.Delivery, data ConsumerHandlerData) string
+
+	// RunTimeout started saga not waiting for event or completed after this is resumed by CheckTimeouts, ex: process stopped. default 5 minute
+	RunTimeout time.Duration
+
+	// CompensateTimeout compensating saga not finished after this is resumed by CheckTimeouts, ex: process stopped. default 5 minute
+	CompensateTimeout time.Duration
+}
+
+type SagaOrchestrator struct {
+	definition SagaDefinition
+	store      SagaStore
+}
+
+func NewSagaOrchestrator(definition SagaDefinition, store SagaStore) (*SagaOrchestrator, error) {
+	if definition.Name == "" || len(definition.Steps) == 0 {
+		return nil, errors.New("saga definition need name and at least one step")
+	}
+
+	for idx, step := range definition.Steps {
+		if step.Name == "" {
+			return nil, fmt.Errorf("saga [%s] step [%d] name is empty", definition.Name, idx)
+		}
+
+		if step.WaitFor == "" && (step.OnEvent != nil || len(step.FailOn) > 0 || step.Timeout > 0) {
+			return nil, fmt.Errorf("saga [%s] step [%s] need WaitFor to use OnEvent, FailOn or Timeout", definition.Name, step.Name)
+		}
+	}
+
+	if definition.RunTimeout <= 0 {
+		definition.RunTimeout = 5 * time.Minute
+	}
+
+	if definition.CompensateTimeout <= 0 {
+		definition.CompensateTimeout = 5 * time.Minute
+	}
+
+	return &SagaOrchestrator{
+		definition: definition,
+		store:      store,
+	}, nil
+}
+
+// Start create saga and run steps until waiting for event, check returned saga status for failed saga
+func (orchestrator *SagaOrchestrator) Start(ctx context.Context, id string, data map[string]interface{}) (SagaInstance, error) {
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+
+	now := time.Now().UTC()
+	instance := SagaInstance{
+		ID:        id,
+		Name:      orchestrator.definition.Name,
+		Status:    SagaRunning,
+		Data:      data,
+		Deadline:  now.Add(orchestrator.definition.RunTimeout), // resumed by CheckTimeouts if process stopped before saga is waiting
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := orchestrator.store.Save(ctx, &instance); err != nil {
+		return instance, err
+	}
+
+	err := orchestrator.execute(ctx, &instance)
+	return instance, err
+}
+
+// HandleEvent continue saga waiting for the event type, event for other step or finished saga is ignored
+func (orchestrator *SagaOrchestrator) HandleEvent(ctx context.Context, sagaID string, data ConsumerHandlerData) error {
+	instance, err := orchestrator.store.Get(ctx, sagaID)
+	if err != nil {
+		return err
+	}
+
+	logger := orchestrator.getLogger(ctx, instance)
+	if instance.Name != orchestrator.definition.Name || instance.CurrentStep >= len(orchestrator.definition.Steps) {
+		logger.Warn("Saga is not created by this definition, event ignored", slog.String("event_type", data.EventType))
+		return nil
+	}
+
+	if instance.Status != SagaWaiting {
+		logger.Debug("Saga is not waiting for event, event ignored", slog.String("event_type", data.EventType))
+		return nil
+	}
+
+	step := orchestrator.definition.Steps[instance.CurrentStep]
+	if isSagaFailEvent(step, data.EventType) {
+		return orchestrator.compensate(ctx, &instance, instance.CurrentStep+1, fmt.Errorf("step [%s] failed by event [%s]", step.Name, data.EventType))
+	}
+
+	if data.EventType != step.WaitFor {
+		logger.Debug("Saga is waiting for other event, event ignored", slog.String("event_type", data.EventType), slog.String("wait_for", step.WaitFor))
+		return nil
+	}
+
+	if step.OnEvent != nil {
+		if err := step.OnEvent(ctx, &instance, data); err != nil {
+			return orchestrator.compensate(ctx, &instance, instance.CurrentStep+1, fmt.Errorf("step [%s] handle event [%s]: %w", step.Name, data.EventType, err))
+		}
+	}
+
+	instance.CurrentStep++
+	instance.Status = SagaRunning
+	instance.Deadline = time.Time{}
+	return orchestrator.execute(ctx, &instance)
+}
+
+func isSagaFailEvent(step SagaStep, eventType string) bool {
+	for _, failEvent := range step.FailOn {
+		if failEvent == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+Handler consume saga events, saga changed by other event or timeout at the same time is requeued and handled again.
+event without saga id or unknown saga is dropped
+*/
+func (orchestrator *SagaOrchestrator) Handler() DeliveryHandler {
+	return func(ctx context.Context, delivery amqp.Delivery) error {
+		var data ConsumerHandlerData
+		if err := json.Unmarshal(delivery.Body, &data); err != nil {
+			return DeadLetter(fmt.Errorf("decode saga event: %w", err))
+		}
+
+		sagaID := orchestrator.correlate(delivery, data)
+		if sagaID == "" {
+			return Drop(ErrSagaIDMissing)
+		}
+
+		err := orchestrator.HandleEvent(ctx, sagaID, data)
+		switch {
+		case errors.Is(err, ErrSagaNotFound):
+			return Drop(err)
+		case errors.Is(err, ErrSagaConflict):
+			return Requeue(err)
+		}
+
+		return err
+	}
+}
+
+func (orchestrator *SagaOrchestrator) correlate(delivery amqp.Delivery, data ConsumerHandlerData) string {
+	if orchestrator.definition.Correlate != nil {
+		return orchestrator.definition.Correlate(delivery, data)
+	}
+
+	if sagaID, ok := delivery.Headers[HeaderSagaID].(string); ok && sagaID != "" {
+		return sagaID
+	}
+
+	return delivery.CorrelationId
+}
+
+// CheckTimeouts compensate waiting saga that reached the step timeout, resume saga not waiting or completed before RunTimeout
+// and compensation not finished before CompensateTimeout (ex: process stopped), return total saga handled.
+// saga with step not on the definition (ex: saved by older definition with more steps) is logged and skipped
+func (orchestrator *SagaOrchestrator) CheckTimeouts(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+	instances, err := orchestrator.store.FindExpired(ctx, now, 100)
+	if err != nil {
+		return 0, fmt.Errorf("find expired saga: %w", err)
+	}
+
+	total := 0
+	for _, instance := range instances {
+		if instance.Name != orchestrator.definition.Name || instance.Deadline.IsZero() || instance.Deadline.After(now) {
+			continue
+		}
+
+		if totalSteps := len(orchestrator.definition.Steps); instance.CurrentStep >= totalSteps || instance.CompensateSteps > totalSteps {
+			orchestrator.getLogger(ctx, instance).Error("Saga step is not on the definition, skipped", slog.Int("compensate_steps", instance.CompensateSteps))
+			continue
+		}
+
+		switch instance.Status {
+		case SagaRunning:
+			orchestrator.getLogger(ctx, instance).Warn("Saga is not waiting or completed, resuming")
+			err = orchestrator.resume(ctx, &instance)
+		case SagaWaiting:
+			step := orchestrator.definition.Steps[instance.CurrentStep]
+			err = orchestrator.compensate(ctx, &instance, instance.CurrentStep+1, fmt.Errorf("step [%s] timeout after %s", step.Name, step.Timeout.String()))
+		case SagaCompensating:
+			orchestrator.getLogger(ctx, instance).Warn("Saga compensation is not finished, resuming")
+			err = orchestrator.runCompensate(ctx, &instance)
+		default:
+			continue
+		}
+
+		if errors.Is(err, ErrSagaConflict) {
+			continue // event received at the same time
+		} else if err != nil {
+			return total, err
+		}
+
+		total++
+	}
+
+	return total, nil
+}
+
+// Run check timeout every interval until context done
+func (orchestrator *SagaOrchestrator) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := orchestrator.CheckTimeouts(ctx); err != nil {
+			slog.Default().Error("Error check saga timeout", slog.String("saga", orchestrator.definition.Name), slog.Any("error", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// resume deadline is saved before running the steps again, so other process didn't resume it at the same time
+func (orchestrator *SagaOrchestrator) resume(ctx context.Context, instance *SagaInstance) error {
+	instance.Deadline = time.Now().UTC().Add(orchestrator.definition.RunTimeout)
+	if err := orchestrator.save(ctx, instance); err != nil {
+		return err
+	}
+
+	return orchestrator.execute(ctx, instance)
+}
+
+// execute run steps from current step until waiting for event or all steps done
+func (orchestrator *SagaOrchestrator) execute(ctx context.Context, instance *SagaInstance) error {
+	steps := orchestrator.definition.Steps
+	for instance.CurrentStep < len(steps) {
+		step := steps[instance.CurrentStep]
+		if step.Action != nil {
+			if err := step.Action(ctx, instance); err != nil {
+				return orchestrator.compensate(ctx, instance, instance.CurrentStep, fmt.Errorf("step [%s]: %w", step.Name, err))
+			}
+		}
+
+		if step.WaitFor != "" {
+			instance.Status = SagaWaiting
+			instance.Deadline = time.Time{}
+			if step.Timeout > 0 {
+				instance.Deadline = time.Now().UTC().Add(step.Timeout)
+			}
+
+			return orchestrator.save(ctx, instance)
+		}
+
+		instance.CurrentStep++
+	}
+
+	instance.Status = SagaCompleted
+	instance.Deadline = time.Time{}
+	return orchestrator.save(ctx, instance)
+}
+
+// compensate run Compensate of executed steps in reverse order, failed compensation didn't stop the rest
+func (orchestrator *SagaOrchestrator) compensate(ctx context.Context, instance *SagaInstance, executedSteps int, cause error) error {
+	orchestrator.getLogger(ctx, *instance).Warn("Saga failed, compensating", slog.Any("error", cause))
+
+	instance.Status = SagaCompensating
+	instance.Error = cause.Error()
+	instance.CompensateSteps = executedSteps
+	return orchestrator.runCompensate(ctx, instance)
+}
+
+// runCompensate deadline is saved before compensating, so other process resume it if this process stopped
+func (orchestrator *SagaOrchestrator) runCompensate(ctx context.Context, instance *SagaInstance) error {
+	instance.Deadline = time.Now().UTC().Add(orchestrator.definition.CompensateTimeout)
+	if err := orchestrator.save(ctx, instance); err != nil {
+		return err
+	}
+
+	logger := orchestrator.getLogger(ctx, *instance)
+	cause := errors.New(instance.Error)
+
+	var errCompensate []error
+	for idx := instance.CompensateSteps - 1; idx >= 0; idx-- {
+		step := orchestrator.definition.Steps[idx]
+		if step.Compensate == nil {
+			continue
+		}
+
+		if err := step.Compensate(ctx, instance); err != nil {
+			logger.Error("Error compensate saga step", slog.String("step", step.Name), slog.Any("error", err))
+			errCompensate = append(errCompensate, fmt.Errorf("compensate step [%s]: %w", step.Name, err))
+		}
+	}
+
+	instance.Status = SagaCompensated
+	instance.Deadline = time.Time{}
+	if len(errCompensate) > 0 {
+		instance.Status = SagaFailed
+		instance.Error = errors.Join(append([]error{cause}, errCompensate...)...).Error()
+	}
+
+	return orchestrator.save(ctx, instance)
+}
+
+func (orchestrator *SagaOrchestrator) save(ctx context.Context, instance *SagaInstance) error {
+	instance.UpdatedAt = time.Now().UTC()
+	if err := orchestrator.store.Save(ctx, instance); err != nil {
+		return fmt.Errorf("save saga [%s]: %w", instance.ID, err)
+	}
+
+	return nil
+}
+
+func (orchestrator *SagaOrchestrator) getLogger(ctx context.Context, instance SagaInstance) *slog.Logger {
+	return LoggerFromContext(ctx).With(slog.String("saga", instance.Name), slog.String("saga_id", instance.ID), slog.Int("step", instance.CurrentStep))
+}
+
+// memorySagaStore for testing or single process app, saga stored as json so data is the same as persisted store
+type memorySagaStore struct {
+	mutex  sync.Mutex
+	sagas  map[string][]byte
+	expiry map[string]time.Time
+}
+
+func NewMemorySagaStore() SagaStore {
+	return &memorySagaStore{
+		sagas:  make(map[string][]byte),
+		expiry: make(map[string]time.Time),
+	}
+}
+
+func (store *memorySagaStore) Get(ctx context.Context, id string) (SagaInstance, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	data, ok := store.sagas[id]
+	if !ok {
+		return SagaInstance{}, ErrSagaNotFound
+	}
+
+	var instance SagaInstance
+	err := json.Unmarshal(data, &instance)
+	return instance, err
+}
+
+func (store *memorySagaStore) Save(ctx context.Context, instance *SagaInstance) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	data, exists := store.sagas[instance.ID]
+	if instance.Version == 0 && exists {
+		return ErrSagaExists
+	}
+
+	if instance.Version > 0 {
+		var stored SagaInstance
+		if !exists || json.Unmarshal(data, &stored) != nil || stored.Version != instance.Version {
+			return ErrSagaConflict
+		}
+	}
+
+	instance.Version++
+	data, err := json.Marshal(instance)
+	if err != nil {
+		instance.Version--
+		return err
+	}
+
+	store.sagas[instance.ID] = data
+	delete(store.expiry, instance.ID)
+	if instance.hasDeadline() {
+		store.expiry[instance.ID] = instance.Deadline
+	}
+
+	return nil
+}
+
+func (store *memorySagaStore) FindExpired(ctx context.Context, now time.Time, limit int) ([]SagaInstance, error) {
+	store.mutex.Lock()
+	var ids []string
+	for id, deadline := range store.expiry {
+		if !deadline.After(now) {
+			ids = append(ids, id)
+		}
+	}
+	store.mutex.Unlock()
+
+	var instances []SagaInstance
+	for _, id := range ids {
+		if limit > 0 && len(instances) >= limit {
+			break
+		}
+
+		instance, err := store.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		instances = append(instances, instance)
+	}
+
+	return instances, nil
+}
@@ -0,0 +1,139 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+/*
+redisSagaStore saga stored as json on "<prefix><saga id>", waiting and compensating saga deadline kept on sorted set "<prefix>deadlines".
+save use WATCH on saga key, so concurrent save of the same saga return ErrSagaConflict.
+completed and compensated saga expired after ttl, failed saga is kept for manual action
+*/
+type redisSagaStore struct {
+	client redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedisSagaStore default prefix "rabbitmq:saga:" and ttl 7 days
+func NewRedisSagaStore(client redis.UniversalClient, prefix string, ttl time.Duration) SagaStore {
+	if prefix == "" {
+		prefix = "rabbitmq:saga:"
+	}
+
+	if ttl <= 0 {
+		ttl = 7 * 24 * time.Hour
+	}
+
+	return &redisSagaStore{
+		client: client,
+		prefix: prefix,
+		ttl:    ttl,
+	}
+}
+
+func (store *redisSagaStore) getDeadlineKey() string {
+	return store.prefix + "deadlines"
+}
+
+func (store *redisSagaStore) Get(ctx context.Context, id string) (SagaInstance, error) {
+	return store.get(ctx, store.client, id)
+}
+
+func (store *redisSagaStore) get(ctx context.Context, client redis.Cmdable, id string) (SagaInstance, error) {
+	data, err := client.Get(ctx, store.prefix+id).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return SagaInstance{}, ErrSagaNotFound
+	} else if err != nil {
+		return SagaInstance{}, err
+	}
+
+	var instance SagaInstance
+	err = json.Unmarshal(data, &instance)
+	return instance, err
+}
+
+func (store *redisSagaStore) Save(ctx context.Context, instance *SagaInstance) error {
+	key := store.prefix + instance.ID
+	saved := *instance
+	saved.Version++
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+
+	err = store.client.Watch(ctx, func(tx *redis.Tx) error {
+		stored, err := store.get(ctx, tx, instance.ID)
+		switch {
+		case errors.Is(err, ErrSagaNotFound):
+			if instance.Version > 0 {
+				return ErrSagaConflict
+			}
+		case err != nil:
+			return err
+		case instance.Version == 0:
+			return ErrSagaExists
+		case stored.Version != instance.Version:
+			return ErrSagaConflict
+		}
+
+		var ttl time.Duration
+		if saved.Status == SagaCompleted || saved.Status == SagaCompensated {
+			ttl = store.ttl
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, ttl)
+			if saved.hasDeadline() {
+				pipe.ZAdd(ctx, store.getDeadlineKey(), redis.Z{Score: float64(saved.Deadline.UnixMilli()), Member: saved.ID})
+			} else {
+				pipe.ZRem(ctx, store.getDeadlineKey(), saved.ID)
+			}
+
+			return nil
+		})
+
+		return err
+	}, key)
+	if errors.Is(err, redis.TxFailedErr) {
+		return ErrSagaConflict
+	} else if err != nil {
+		return err
+	}
+
+	instance.Version = saved.Version
+	return nil
+}
+
+func (store *redisSagaStore) FindExpired(ctx context.Context, now time.Time, limit int) ([]SagaInstance, error) {
+	ids, err := store.client.ZRangeByScore(ctx, store.getDeadlineKey(), &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixMilli(), 10),
+		Count: int64(limit),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var instances []SagaInstance
+	for _, id := range ids {
+		instance, err := store.Get(ctx, id)
+		if errors.Is(err, ErrSagaNotFound) {
+			store.client.ZRem(ctx, store.getDeadlineKey(), id)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		instances = append(instances, instance)
+	}
+
+	return instances, nil
+}
@@ -0,0 +1,473 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type testSagaRecorder struct {
+	mutex sync.Mutex
+	calls []string
+}
+
+func (recorder *testSagaRecorder) record(call string) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	recorder.calls = append(recorder.calls, call)
+}
+
+func (recorder *testSagaRecorder) getCalls() []string {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	return append([]string(nil), recorder.calls...)
+}
+
+func (recorder *testSagaRecorder) step(call string, err error) func(ctx context.Context, saga *SagaInstance) error {
+	return func(ctx context.Context, saga *SagaInstance) error {
+		recorder.record(call)
+		return err
+	}
+}
+
+// getTestCheckoutSaga create invoice -> wait invoice paid -> fulfill -> wait fulfilled -> notify
+func getTestCheckoutSaga(recorder *testSagaRecorder, fulfillErr error) SagaDefinition {
+	return SagaDefinition{
+		Name: "checkout",
+		Steps: []SagaStep{
+			{
+				Name:    "create-invoice",
+				Action:  recorder.step("create-invoice", nil),
+				WaitFor: "invoice-paid",
+				OnEvent: func(ctx context.Context, saga *SagaInstance, data ConsumerHandlerData) error {
+					saga.Data["paid"] = data.Data
+					return nil
+				},
+				FailOn:     []string{"invoice-expired"},
+				Timeout:    time.Hour,
+				Compensate: recorder.step("cancel-invoice", nil),
+			},
+			{
+				Name:       "fulfill",
+				Action:     recorder.step("fulfill", fulfillErr),
+				WaitFor:    "order-fulfilled",
+				Compensate: recorder.step("refund", nil),
+			},
+			{
+				Name:   "notify",
+				Action: recorder.step("notify", nil),
+			},
+		},
+	}
+}
+
+func getTestSagaDelivery(sagaID, eventType string, useCorrelationID bool) amqp.Delivery {
+	body, _ := json.Marshal(ConsumerHandlerData{EventType: eventType, Data: map[string]interface{}{"event": eventType}})
+	delivery := amqp.Delivery{Body: body}
+	if useCorrelationID {
+		delivery.CorrelationId = sagaID
+	} else {
+		delivery.Headers = amqp.Table{HeaderSagaID: sagaID}
+	}
+
+	return delivery
+}
+
+func TestSagaOrchestratorCheckout(t *testing.T) {
+	recorder := &testSagaRecorder{}
+	store := NewMemorySagaStore()
+	orchestrator, err := NewSagaOrchestrator(getTestCheckoutSaga(recorder, nil), store)
+	if err != nil {
+		t.Fail()
+		t.Log(err.Error())
+		return
+	}
+
+	ctx := context.Background()
+	saga, err := orchestrator.Start(ctx, "order-1", map[string]interface{}{"amount": 150000})
+	if err != nil || saga.Status != SagaWaiting || saga.Deadline.IsZero() {
+		t.Fail()
+		t.Logf("expected saga waiting invoice paid with deadline, got %+v (%v)", saga, err)
+		return
+	}
+
+	if _, err := orchestrator.Start(ctx, "order-1", nil); !errors.Is(err, ErrSagaExists) {
+		t.Fail()
+		t.Logf("expected ErrSagaExists, got %v", err)
+		return
+	}
+
+	handler := orchestrator.Handler()
+	deliveries := []amqp.Delivery{
+		getTestSagaDelivery("order-1", "order-fulfilled", false), // not the current step, ignored
+		getTestSagaDelivery("order-1", "invoice-paid", false),
+		getTestSagaDelivery("order-1", "order-fulfilled", true),
+		getTestSagaDelivery("order-1", "invoice-paid", false), // saga already completed, ignored
+	}
+
+	for _, delivery := range deliveries {
+		if err := handler(ctx, delivery); err != nil {
+			t.Fail()
+			t.Log(err.Error())
+			return
+		}
+	}
+
+	saga, err = store.Get(ctx, "order-1")
+	if err != nil || saga.Status != SagaCompleted {
+		t.Fail()
+		t.Logf("expected saga completed, got %+v (%v)", saga, err)
+		return
+	}
+
+	if paid, ok := saga.Data["paid"].(map[string]interface{}); !ok || paid["event"] != "invoice-paid" {
+		t.Fail()
+		t.Logf("expected paid event data stored on saga, got %v", saga.Data)
+		return
+	}
+
+	expectedCalls := []string{"create-invoice", "fulfill", "notify"}
+	if !reflect.DeepEqual(recorder.getCalls(), expectedCalls) {
+		t.Fail()
+		t.Logf("expected calls %v, got %v", expectedCalls, recorder.getCalls())
+		return
+	}
+
+	err = handler(ctx, getTestSagaDelivery("order-unknown", "invoice-paid", false))
+	var handlerErr *HandlerError
+	if !errors.As(err, &handlerErr) || handlerErr.Action != ActionDrop {
+		t.Fail()
+		t.Logf("expected unknown saga dropped, got %v", err)
+		return
+	}
+
+	t.Log("success run checkout saga")
+	return
+}
+
+func TestSagaOrchestratorCompensate(t *testing.T) {
+	ctx := context.Background()
+
+	// fail event on step 2 compensate step 2 and step 1
+	recorder := &testSagaRecorder{}
+	orchestrator, _ := NewSagaOrchestrator(getTestCheckoutSaga(recorder, nil), NewMemorySagaStore())
+	orchestrator.definition.Steps[1].FailOn = []string{"order-fulfill-failed"}
+
+	_, _ = orchestrator.Start(ctx, "order-1", nil)
+	_ = orchestrator.HandleEvent(ctx, "order-1", ConsumerHandlerData{EventType: "invoice-paid"})
+	_ = orchestrator.HandleEvent(ctx, "order-1", ConsumerHandlerData{EventType: "order-fulfill-failed"})
+
+	expectedCalls := []string{"create-invoice", "fulfill", "refund", "cancel-invoice"}
+	if !reflect.DeepEqual(recorder.getCalls(), expectedCalls) {
+		t.Fail()
+		t.Logf("expected calls %v, got %v", expectedCalls, recorder.getCalls())
+		return
+	}
+
+	// action error didn't compensate the failed step
+	recorder = &testSagaRecorder{}
+	orchestrator, _ = NewSagaOrchestrator(getTestCheckoutSaga(recorder, errors.New("out of stock")), NewMemorySagaStore())
+	_, _ = orchestrator.Start(ctx, "order-2", nil)
+	err := orchestrator.HandleEvent(ctx, "order-2", ConsumerHandlerData{EventType: "invoice-paid"})
+	if err != nil {
+		t.Fail()
+		t.Log(err.Error())
+		return
+	}
+
+	saga, _ := orchestrator.store.Get(ctx, "order-2")
+	expectedCalls = []string{"create-invoice", "fulfill", "cancel-invoice"}
+	if saga.Status != SagaCompensated || saga.Error != "step [fulfill]: out of stock" || !reflect.DeepEqual(recorder.getCalls(), expectedCalls) {
+		t.Fail()
+		t.Logf("expected saga compensated with calls %v, got %+v %v", expectedCalls, saga, recorder.getCalls())
+		return
+	}
+
+	// failed compensation need manual action
+	recorder = &testSagaRecorder{}
+	definition := getTestCheckoutSaga(recorder, nil)
+	definition.Steps[0].Compensate = recorder.step("cancel-invoice", errors.New("payment gateway unavailable"))
+	orchestrator, _ = NewSagaOrchestrator(definition, NewMemorySagaStore())
+	_, _ = orchestrator.Start(ctx, "order-3", nil)
+	_ = orchestrator.HandleEvent(ctx, "order-3", ConsumerHandlerData{EventType: "invoice-expired"})
+
+	saga, _ = orchestrator.store.Get(ctx, "order-3")
+	if saga.Status != SagaFailed {
+		t.Fail()
+		t.Logf("expected saga failed, got %+v", saga)
+		return
+	}
+
+	t.Log("success compensate saga")
+	return
+}
+
+func TestSagaOrchestratorTimeout(t *testing.T) {
+	ctx := context.Background()
+	recorder := &testSagaRecorder{}
+	definition := getTestCheckoutSaga(recorder, nil)
+	definition.Steps[0].Timeout = time.Millisecond
+
+	store := NewMemorySagaStore()
+	orchestrator, _ := NewSagaOrchestrator(definition, store)
+	_, _ = orchestrator.Start(ctx, "order-1", nil)
+	time.Sleep(5 * time.Millisecond)
+
+	total, err := orchestrator.CheckTimeouts(ctx)
+	if err != nil || total != 1 {
+		t.Fail()
+		t.Logf("expected 1 saga timeout, got %d (%v)", total, err)
+		return
+	}
+
+	saga, _ := store.Get(ctx, "order-1")
+	if saga.Status != SagaCompensated || !reflect.DeepEqual(recorder.getCalls(), []string{"create-invoice", "cancel-invoice"}) {
+		t.Fail()
+		t.Logf("expected saga compensated after timeout, got %+v %v", saga, recorder.getCalls())
+		return
+	}
+
+	if total, _ = orchestrator.CheckTimeouts(ctx); total != 0 {
+		t.Fail()
+		t.Log("expected compensated saga not checked again")
+		return
+	}
+
+	t.Log("success compensate saga after timeout")
+	return
+}
+
+func TestSagaOrchestratorResumeCompensation(t *testing.T) {
+	ctx := context.Background()
+	recorder := &testSagaRecorder{}
+	store := NewMemorySagaStore()
+	orchestrator, _ := NewSagaOrchestrator(getTestCheckoutSaga(recorder, nil), store)
+
+	// process stopped after compensation started
+	saga := SagaInstance{
+		ID:              "order-1",
+		Name:            "checkout",
+		Status:          SagaCompensating,
+		CurrentStep:     1,
+		Error:           "step [fulfill] failed by event [order-fulfill-failed]",
+		CompensateSteps: 2,
+		Deadline:        time.Now().UTC().Add(-time.Second),
+	}
+	_ = store.Save(ctx, &saga)
+
+	total, err := orchestrator.CheckTimeouts(ctx)
+	if err != nil || total != 1 {
+		t.Fail()
+		t.Logf("expected 1 saga compensation resumed, got %d (%v)", total, err)
+		return
+	}
+
+	saga, _ = store.Get(ctx, "order-1")
+	expectedCalls := []string{"refund", "cancel-invoice"}
+	if saga.Status != SagaCompensated || !saga.Deadline.IsZero() || !reflect.DeepEqual(recorder.getCalls(), expectedCalls) {
+		t.Fail()
+		t.Logf("expected saga compensated with calls %v, got %+v %v", expectedCalls, saga, recorder.getCalls())
+		return
+	}
+
+	// compensating saga before compensate timeout is not resumed
+	saga = SagaInstance{ID: "order-2", Name: "checkout", Status: SagaCompensating, CompensateSteps: 1, Deadline: time.Now().UTC().Add(time.Minute)}
+	_ = store.Save(ctx, &saga)
+	if total, _ = orchestrator.CheckTimeouts(ctx); total != 0 {
+		t.Fail()
+		t.Log("expected running compensation not resumed")
+		return
+	}
+
+	t.Log("success resume saga compensation")
+	return
+}
+
+func TestSagaOrchestratorResumeRunning(t *testing.T) {
+	ctx := context.Background()
+	recorder := &testSagaRecorder{}
+	store := NewMemorySagaStore()
+	orchestrator, _ := NewSagaOrchestrator(getTestCheckoutSaga(recorder, nil), store)
+
+	// process stopped after invoice paid, before fulfill step saved as waiting
+	saga := SagaInstance{
+		ID:          "order-1",
+		Name:        "checkout",
+		Status:      SagaRunning,
+		CurrentStep: 1,
+		Data:        map[string]interface{}{},
+		Deadline:    time.Now().UTC().Add(-time.Second),
+	}
+	_ = store.Save(ctx, &saga)
+
+	total, err := orchestrator.CheckTimeouts(ctx)
+	if err != nil || total != 1 {
+		t.Fail()
+		t.Logf("expected 1 running saga resumed, got %d (%v)", total, err)
+		return
+	}
+
+	saga, _ = store.Get(ctx, "order-1")
+	if saga.Status != SagaWaiting || !saga.Deadline.IsZero() || !reflect.DeepEqual(recorder.getCalls(), []string{"fulfill"}) {
+		t.Fail()
+		t.Logf("expected saga waiting for fulfilled event without deadline, got %+v %v", saga, recorder.getCalls())
+		return
+	}
+
+	if total, _ = orchestrator.CheckTimeouts(ctx); total != 0 {
+		t.Fail()
+		t.Log("expected waiting saga without step timeout not checked again")
+		return
+	}
+
+	t.Log("success resume running saga")
+	return
+}
+
+func TestSagaOrchestratorSkipUnknownStep(t *testing.T) {
+	ctx := context.Background()
+	recorder := &testSagaRecorder{}
+	store := NewMemorySagaStore()
+	orchestrator, _ := NewSagaOrchestrator(getTestCheckoutSaga(recorder, nil), store)
+
+	// saved by older definition with more steps
+	deadline := time.Now().UTC().Add(-time.Second)
+	sagas := []SagaInstance{
+		{ID: "order-1", Name: "checkout", Status: SagaWaiting, CurrentStep: 4, Deadline: deadline},
+		{ID: "order-2", Name: "checkout", Status: SagaRunning, CurrentStep: 3, Deadline: deadline},
+		{ID: "order-3", Name: "checkout", Status: SagaCompensating, CurrentStep: 2, CompensateSteps: 5, Deadline: deadline},
+	}
+
+	for idx := range sagas {
+		_ = store.Save(ctx, &sagas[idx])
+	}
+
+	total, err := orchestrator.CheckTimeouts(ctx)
+	if err != nil || total != 0 || len(recorder.getCalls()) > 0 {
+		t.Fail()
+		t.Logf("expected saga with unknown step skipped, got %d (%v) %v", total, err, recorder.getCalls())
+		return
+	}
+
+	t.Log("success skip saga with unknown step")
+	return
+}
+
+func TestRedisSagaStore(t *testing.T) {
+	client := getTestRedisClient(t)
+	if client == nil {
+		t.Skip("redis is unavailable")
+	}
+
+	ctx := context.Background()
+	prefix := "rabbitmq:test:saga:" + uuid.New().String() + ":"
+	store := NewRedisSagaStore(client, prefix, time.Minute)
+	t.Cleanup(func() {
+		keys, _ := client.Keys(ctx, prefix+"*").Result()
+		if len(keys) > 0 {
+			client.Del(ctx, keys...)
+		}
+	})
+
+	saga := SagaInstance{ID: "order-1", Status: SagaWaiting, Deadline: time.Now().UTC().Add(-time.Second)}
+	if err := store.Save(ctx, &saga); err != nil || saga.Version != 1 {
+		t.Fail()
+		t.Logf("expected saga created with version 1, got %d (%v)", saga.Version, err)
+		return
+	}
+
+	if err := store.Save(ctx, &SagaInstance{ID: "order-1"}); !errors.Is(err, ErrSagaExists) {
+		t.Fail()
+		t.Logf("expected ErrSagaExists, got %v", err)
+		return
+	}
+
+	expired, err := store.FindExpired(ctx, time.Now().UTC(), 10)
+	if err != nil || len(expired) != 1 || expired[0].ID != "order-1" {
+		t.Fail()
+		t.Logf("expected waiting saga expired, got %+v (%v)", expired, err)
+		return
+	}
+
+	stale := saga
+	saga.Status = SagaCompensating
+	if err := store.Save(ctx, &saga); err != nil {
+		t.Fail()
+		t.Log(err.Error())
+		return
+	}
+
+	stale.Status = SagaCompleted
+	if err := store.Save(ctx, &stale); !errors.Is(err, ErrSagaConflict) {
+		t.Fail()
+		t.Logf("expected ErrSagaConflict, got %v", err)
+		return
+	}
+
+	if expired, _ = store.FindExpired(ctx, time.Now().UTC(), 10); len(expired) != 1 || expired[0].Status != SagaCompensating {
+		t.Fail()
+		t.Logf("expected compensating saga kept on deadline index, got %+v", expired)
+		return
+	}
+
+	saga.Status = SagaCompensated
+	saga.Deadline = time.Time{}
+	_ = store.Save(ctx, &saga)
+	if expired, _ = store.FindExpired(ctx, time.Now().UTC(), 10); len(expired) != 0 {
+		t.Fail()
+		t.Logf("expected compensated saga removed from deadline index, got %+v", expired)
+		return
+	}
+
+	if ttl := client.TTL(ctx, prefix+"order-1").Val(); ttl <= 0 || ttl > time.Minute {
+		t.Fail()
+		t.Logf("expected compensated saga expired after store ttl, got %s", ttl)
+		return
+	}
+
+	if _, err := store.Get(ctx, "order-unknown"); !errors.Is(err, ErrSagaNotFound) {
+		t.Fail()
+		t.Logf("expected ErrSagaNotFound, got %v", err)
+		return
+	}
+
+	t.Log("success save saga on redis")
+	return
+}
+
+func TestMemorySagaStoreConflict(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemorySagaStore()
+
+	saga := SagaInstance{ID: "order-1", Status: SagaRunning}
+	if err := store.Save(ctx, &saga); err != nil || saga.Version != 1 {
+		t.Fail()
+		t.Logf("expected saga created with version 1, got %d (%v)", saga.Version, err)
+		return
+	}
+
+	stale := saga
+	saga.Status = SagaWaiting
+	if err := store.Save(ctx, &saga); err != nil {
+		t.Fail()
+		t.Log(err.Error())
+		return
+	}
+
+	stale.Status = SagaCompleted
+	if err := store.Save(ctx, &stale); !errors.Is(err, ErrSagaConflict) {
+		t.Fail()
+		t.Logf("expected ErrSagaConflict, got %v", err)
+		return
+	}
+
+	t.Log("success reject stale saga")
+	return
+}
@@ -1,6 +1,11 @@
 package rabbitmq
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
 	"github.com/google/uuid"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
@@ -16,6 +21,9 @@ type ConsumerHandlerData struct {
 // ConsumerHandler function for subscribers message handler
 type ConsumerHandler func(ConsumerHandlerData)
 
+// DeliveryHandler handler for raw delivery, returned error have the same behaviour as MessageHandler
+type DeliveryHandler func(ctx context.Context, delivery amqp.Delivery) error
+
 type ConsumerConfig struct {
 	Consumer  string     // Consumer tag (used to identify the consumer); empty for auto-generated
 	AutoAck   bool       // If true, messages are considered acknowledged once delivered
@@ -23,6 +31,9 @@ type ConsumerConfig struct {
 	NoLocal   bool       // If true, the server will not deliver messages published on this connection (not supported in RabbitMQ)
 	NoWait    bool       // If true, the server does not respond to the method (fire-and-forget)
 	Args      amqp.Table // Optional arguments (e.g., consumer priority)
+
+	PrefetchCount int // Max unacked messages delivered to this consumer, default same as Workers (ignored on AutoAck)
+	Workers       int // Total goroutine handling messages concurrently, default 1
 }
 
 func (base *QueueSetup) SetupQueue(queueDeclare *QueueDeclareConfig, consumerConfig *ConsumerConfig) *QueueSetup {
@@ -57,14 +68,15 @@ func (base *QueueSetup) SetupQueue(queueDeclare *QueueDeclareConfig, consumerCon
 		QueueConsumerConfig: consumerConfig,
 	}
 
-	if !consumerConfig.AutoAck && base.channel != nil {
-		loggingMessage("setting up qos", nil)
-		err := base.channel.Qos(1, 0, false)
-		if err != nil {
-			loggingMessage("error setting up QoS", err.Error())
-		}
+	if consumerConfig.Workers <= 0 {
+		consumerConfig.Workers = 1
+	}
+
+	if consumerConfig.PrefetchCount <= 0 {
+		consumerConfig.PrefetchCount = consumerConfig.Workers
 	}
 
+	base.reportConnectionState()
 	return base
 }
 
@@ -81,31 +93,77 @@ func (base *QueueSetup) SetupQueueBind(queueBindConfig *QueueBindConfig) *QueueS
 	return base
 }
 
+// AddConsumer panic if connection can't be opened or declaration failed, use AddConsumerE to get the error
 func (base *QueueSetup) AddConsumer(isReconnect bool) *QueueSetup {
-	err := base.openConnection()
+	queueSetup, err := base.AddConsumerE(isReconnect)
 	if err != nil {
-		loggingMessage("error open new connection", err.Error())
 		panic(err.Error())
 	}
 
+	return queueSetup
+}
+
+// AddConsumerE same as AddConsumer, but return error instead of panic, reconnect is only started if no error
+func (base *QueueSetup) AddConsumerE(isReconnect bool) (*QueueSetup, error) {
+	err := base.ensureConnection()
+	if err != nil {
+		base.getLogger().Error("Error open new connection", slog.Any("error", err))
+		return base, err
+	}
+
 	err = base.declareQueue()
 	if err != nil {
-		loggingMessage("error declare queue after open connection", err.Error())
-		panic(err.Error())
+		base.getLogger().Error("Error declare queue after open connection", slog.Any("error", err))
+		return base, err
+	}
+
+	err = base.declareRetryQueues()
+	if err != nil {
+		base.getLogger().Error("Error declare retry queues", slog.Any("error", err))
+		return base, err
 	}
 
 	if !isReconnect {
-		go base.reconnect()
+		base.startReconnect()
 	}
 
-	return base
+	return base, nil
 }
 
 func (base *QueueSetup) Consume(consumer ConsumerHandler) {
-	loggingMessage("Registering Consumer...", nil)
+	base.ConsumeWithError(AdaptConsumerHandler(consumer))
+}
+
+// ConsumeWithError returned error by handler decide ack, requeue, retry or dead-letter, see MessageHandler
+func (base *QueueSetup) ConsumeWithError(consumer MessageHandler) {
+	base.consume(newDeliveryHandler(consumer))
+}
+
+// ConsumeDelivery consume raw delivery, ex: message that is not using ConsumerHandlerData format
+func (base *QueueSetup) ConsumeDelivery(consumer DeliveryHandler) {
+	base.consume(consumer)
+}
+
+// newDeliveryHandler message that is not ConsumerHandlerData format is dead-lettered without calling the handler
+func newDeliveryHandler(consumer MessageHandler) DeliveryHandler {
+	return func(ctx context.Context, delivery amqp.Delivery) error {
+		var handlerData ConsumerHandlerData
+		err := json.Unmarshal(delivery.Body[:], &handlerData)
+		if err != nil {
+			return DeadLetter(fmt.Errorf("decode message: %w", err))
+		}
+
+		return consumer(handlerData)
+	}
+}
+
+func (base *QueueSetup) consume(consumer DeliveryHandler) {
+	consumer = chainMiddlewares(consumer, base.getConsumerMiddlewares())
+
+	base.getConsumerLogger().Info("Registering consumer")
 	deliveries, err := base.registerQueueConsumer()
 	if err != nil {
-		loggingMessage("Error register queue queueConsumer", err.Error())
+		base.getConsumerLogger().Error("Error register consumer", slog.Any("error", err))
 		panic(err.Error())
 	}
 
@@ -0,0 +1,298 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const HeaderDeath = "x-death"
+
+/*
+DeadLetterConfig declare dead letter exchange and queue together with the main queue,
+rejected message (see DeadLetter), expired message and message over queue length limit routed to dead letter queue
+
+	Example
+	queueDeclareConfig := &QueueDeclareConfig{
+		Durable: true,
+		DeadLetter: &DeadLetterConfig{
+			QueueArgs: amqp.Table{"x-message-ttl": int64(7 * 24 * time.Hour / time.Millisecond)}, // keep dead letter for 7 days
+		},
+	}
+*/
+type DeadLetterConfig struct {
+	Exchange   string     // default "<queue name>.dlx", declared as direct exchange
+	Queue      string     // default "<queue name>.dlq"
+	RoutingKey string     // default queue name
+	QueueArgs  amqp.Table // Optional arguments for dead letter queue
+}
+
+type DeadLetterMessages struct {
+	MessageID     string     `json:"message_id"`
+	CorrelationID string     `json:"correlation_id"`
+	Reason        string     `json:"reason"`         // latest x-death reason, ex: rejected, expired, maxlen
+	OriginalQueue string     `json:"original_queue"` // latest x-death queue
+	DeathCount    int64      `json:"death_count"`
+	RetryCount    int        `json:"retry_count"`
+	Headers       amqp.Table `json:"headers"`
+	Body          []byte     `json:"body"`
+	Timestamp     time.Time  `json:"timestamp"`
+}
+
+func newDeadLetterMessage(delivery amqp.Delivery) DeadLetterMessages {
+	message := DeadLetterMessages{
+		MessageID:     delivery.MessageId,
+		CorrelationID: delivery.CorrelationId,
+		RetryCount:    getRetryCount(delivery.Headers),
+		Headers:       delivery.Headers,
+		Body:          delivery.Body,
+		Timestamp:     delivery.Timestamp,
+	}
+
+	deaths, _ := delivery.Headers[HeaderDeath].([]interface{})
+	if len(deaths) > 0 {
+		if death, ok := deaths[0].(amqp.Table); ok { // latest death is the first
+			message.Reason, _ = death["reason"].(string)
+			message.OriginalQueue, _ = death["queue"].(string)
+			message.DeathCount, _ = death["count"].(int64)
+		}
+	}
+
+	return message
+}
+
+func (config *DeadLetterConfig) setDefault(queueName string) {
+	if config.Exchange == "" {
+		config.Exchange = queueName + ".dlx"
+	}
+
+	if config.Queue == "" {
+		config.Queue = queueName + ".dlq"
+	}
+
+	if config.RoutingKey == "" {
+		config.RoutingKey = queueName
+	}
+}
+
+// declareDeadLetter declare dead letter exchange and queue, return main queue args with dead letter exchange
+func (base *QueueSetup) declareDeadLetter(queueDeclareConfig *QueueDeclareConfig) (amqp.Table, error) {
+	deadLetterConfig := queueDeclareConfig.DeadLetter
+	deadLetterConfig.setDefault(base.queueName)
+
+	err := base.channel.ExchangeDeclare(deadLetterConfig.Exchange, amqp.ExchangeDirect, queueDeclareConfig.Durable, false, false, false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = base.channel.QueueDeclare(deadLetterConfig.Queue, queueDeclareConfig.Durable, false, false, false, deadLetterConfig.QueueArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	err = base.channel.QueueBind(deadLetterConfig.Queue, deadLetterConfig.RoutingKey, deadLetterConfig.Exchange, false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return deadLetterConfig.getQueueArgs(queueDeclareConfig.Args), nil
+}
+
+// getQueueArgs main queue args with dead letter exchange, args is copied
+func (config *DeadLetterConfig) getQueueArgs(queueArgs amqp.Table) amqp.Table {
+	args := amqp.Table{}
+	for key, value := range queueArgs {
+		args[key] = value
+	}
+
+	args["x-dead-letter-exchange"] = config.Exchange
+	args["x-dead-letter-routing-key"] = config.RoutingKey
+	return args
+}
+
+// getDeadLetterQueue dead letter queue, or parking lot queue if only retry is configured,
+// use getParkingLotQueue to get parking lot queue when both is configured
+func (base *QueueSetup) getDeadLetterQueue() (string, error) {
+	if base.queueConfig != nil && base.queueConfig.QueueDeclareConfig != nil && base.queueConfig.QueueDeclareConfig.DeadLetter != nil {
+		deadLetterConfig := base.queueConfig.QueueDeclareConfig.DeadLetter
+		deadLetterConfig.setDefault(base.queueName)
+		return deadLetterConfig.Queue, nil
+	}
+
+	if base.retryConfig != nil {
+		return base.retryConfig.ParkingLotQueue, nil
+	}
+
+	return "", fmt.Errorf("dead letter queue for queue [%s] is not configured", base.queueName)
+}
+
+// getParkingLotQueue parking lot queue from SetupRetry, message moved there after max retry attempts
+func (base *QueueSetup) getParkingLotQueue() (string, error) {
+	if base.retryConfig == nil {
+		return "", fmt.Errorf("parking lot queue for queue [%s] is not configured", base.queueName)
+	}
+
+	return base.retryConfig.ParkingLotQueue, nil
+}
+
+// InspectDeadLetters get dead letter messages without removing it from dead letter queue
+func (base *QueueSetup) InspectDeadLetters(limit int) ([]DeadLetterMessages, error) {
+	deadLetterQueue, err := base.getDeadLetterQueue()
+	if err != nil {
+		return nil, err
+	}
+
+	return base.inspectMessages(deadLetterQueue, limit)
+}
+
+// InspectParkingLot same as InspectDeadLetters, but for parking lot queue (see SetupRetry)
+func (base *QueueSetup) InspectParkingLot(limit int) ([]DeadLetterMessages, error) {
+	parkingLotQueue, err := base.getParkingLotQueue()
+	if err != nil {
+		return nil, err
+	}
+
+	return base.inspectMessages(parkingLotQueue, limit)
+}
+
+func (base *QueueSetup) inspectMessages(deadLetterQueue string, limit int) ([]DeadLetterMessages, error) {
+	channel, err := base.newChannel()
+	if err != nil {
+		return nil, err
+	}
+	defer channel.Close()
+
+	// message stay unacked until done, so the same message is not received twice
+	var deliveries []amqp.Delivery
+	defer func() {
+		for _, delivery := range deliveries {
+			_ = delivery.Nack(false, true)
+		}
+	}()
+
+	var messages []DeadLetterMessages
+	for len(messages) < limit {
+		delivery, ok, err := channel.Get(deadLetterQueue, false)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			break // dead letter queue is empty
+		}
+
+		deliveries = append(deliveries, delivery)
+		messages = append(messages, newDeadLetterMessage(delivery))
+	}
+
+	return messages, nil
+}
+
+// RedriveDeadLetters move dead letter messages back to the queue, x-retry header is reset and other headers (including x-death) is kept.
+// return total message moved
+func (base *QueueSetup) RedriveDeadLetters(ctx context.Context, limit int) (int, error) {
+	deadLetterQueue, err := base.getDeadLetterQueue()
+	if err != nil {
+		return 0, err
+	}
+
+	return base.redriveMessages(ctx, deadLetterQueue, limit)
+}
+
+// RedriveParkingLot same as RedriveDeadLetters, but for parking lot queue (see SetupRetry)
+func (base *QueueSetup) RedriveParkingLot(ctx context.Context, limit int) (int, error) {
+	parkingLotQueue, err := base.getParkingLotQueue()
+	if err != nil {
+		return 0, err
+	}
+
+	return base.redriveMessages(ctx, parkingLotQueue, limit)
+}
+
+func (base *QueueSetup) redriveMessages(ctx context.Context, deadLetterQueue string, limit int) (int, error) {
+	channel, err := base.newChannel()
+	if err != nil {
+		return 0, err
+	}
+	defer channel.Close()
+
+	err = channel.Confirm(false)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int
+	for total < limit {
+		delivery, ok, err := channel.Get(deadLetterQueue, false)
+		if err != nil {
+			return total, err
+		}
+
+		if !ok {
+			break
+		}
+
+		headers := amqp.Table{}
+		for key, value := range delivery.Headers {
+			headers[key] = value
+		}
+		delete(headers, HeaderRetry)
+
+		confirmation, err := channel.PublishWithDeferredConfirmWithContext(ctx, "", base.queueName, false, false, deliveryToPublishing(delivery, headers))
+		if err != nil {
+			_ = delivery.Nack(false, true)
+			return total, err
+		}
+
+		isAcked, err := confirmation.WaitContext(ctx)
+		if err != nil || !isAcked {
+			_ = delivery.Nack(false, true)
+			if err == nil {
+				err = ErrPublishNacked
+			}
+
+			return total, err
+		}
+
+		// only removed from dead letter queue after broker confirm the message
+		err = delivery.Ack(false)
+		if err != nil {
+			return total, err
+		}
+
+		total++
+	}
+
+	return total, nil
+}
+
+// PurgeDeadLetters remove all messages on dead letter queue, return total message removed
+func (base *QueueSetup) PurgeDeadLetters() (int, error) {
+	deadLetterQueue, err := base.getDeadLetterQueue()
+	if err != nil {
+		return 0, err
+	}
+
+	return base.purgeMessages(deadLetterQueue)
+}
+
+// PurgeParkingLot same as PurgeDeadLetters, but for parking lot queue (see SetupRetry)
+func (base *QueueSetup) PurgeParkingLot() (int, error) {
+	parkingLotQueue, err := base.getParkingLotQueue()
+	if err != nil {
+		return 0, err
+	}
+
+	return base.purgeMessages(parkingLotQueue)
+}
+
+func (base *QueueSetup) purgeMessages(deadLetterQueue string) (int, error) {
+	channel := base.getChannel()
+	if channel == nil {
+		return 0, ErrChannelNotOpen
+	}
+
+	return channel.QueuePurge(deadLetterQueue, false)
+}
@@ -0,0 +1,91 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestNewDeadLetterMessage(t *testing.T) {
+	delivery := amqp.Delivery{
+		MessageId: "message-1",
+		Headers: amqp.Table{
+			HeaderRetry: int32(3),
+			HeaderDeath: []interface{}{
+				amqp.Table{"reason": "rejected", "queue": "orders", "count": int64(2)},
+				amqp.Table{"reason": "expired", "queue": "orders.retry.1000ms", "count": int64(3)},
+			},
+		},
+		Body: []byte(`{"event_type":"order-created"}`),
+	}
+
+	message := newDeadLetterMessage(delivery)
+	if message.Reason != "rejected" || message.OriginalQueue != "orders" || message.DeathCount != 2 || message.RetryCount != 3 {
+		t.Fail()
+		t.Logf("unexpected dead letter message %+v", message)
+		return
+	}
+
+	t.Log("success parse dead letter message")
+	return
+}
+
+func TestGetDeadLetterQueue(t *testing.T) {
+	queueSetup := &QueueSetup{queueName: "orders"}
+	if _, err := queueSetup.getDeadLetterQueue(); err == nil {
+		t.Fail()
+		t.Log("expected error when dead letter queue is not configured")
+		return
+	}
+
+	if _, err := queueSetup.getParkingLotQueue(); err == nil {
+		t.Fail()
+		t.Log("expected error when parking lot queue is not configured")
+		return
+	}
+
+	queueSetup.SetupRetry(nil)
+	if deadLetterQueue, _ := queueSetup.getDeadLetterQueue(); deadLetterQueue != "orders.parking-lot" {
+		t.Fail()
+		t.Logf("expected parking lot queue, got [%s]", deadLetterQueue)
+		return
+	}
+
+	queueSetup.SetupQueue(&QueueDeclareConfig{DeadLetter: &DeadLetterConfig{}}, nil)
+	if deadLetterQueue, _ := queueSetup.getDeadLetterQueue(); deadLetterQueue != "orders.dlq" {
+		t.Fail()
+		t.Logf("expected dead letter queue, got [%s]", deadLetterQueue)
+		return
+	}
+
+	if parkingLotQueue, _ := queueSetup.getParkingLotQueue(); parkingLotQueue != "orders.parking-lot" {
+		t.Fail()
+		t.Logf("expected parking lot queue reachable with dead letter configured, got [%s]", parkingLotQueue)
+		return
+	}
+
+	t.Log("success get dead letter queue")
+	return
+}
+
+func TestDeadLetterWithoutConnection(t *testing.T) {
+	queueSetup := &QueueSetup{queueName: "orders"}
+	queueSetup.SetupQueue(&QueueDeclareConfig{DeadLetter: &DeadLetterConfig{}}, nil)
+
+	if _, err := queueSetup.InspectDeadLetters(10); !errors.Is(err, amqp.ErrClosed) {
+		t.Fail()
+		t.Logf("expected amqp.ErrClosed on inspect, got %v", err)
+		return
+	}
+
+	if _, err := queueSetup.RedriveDeadLetters(context.Background(), 10); !errors.Is(err, amqp.ErrClosed) {
+		t.Fail()
+		t.Logf("expected amqp.ErrClosed on redrive, got %v", err)
+		return
+	}
+
+	t.Log("success return error without connection")
+	return
+}
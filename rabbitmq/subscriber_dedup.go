@@ -0,0 +1,204 @@
+package rabbitmq
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/redis/go-redis/v9"
+)
+
+/*
+SetupDeduplication skip message with message id that is already handled, ex: redelivered after connection lost
+or republished by retry. message id is assigned on publish when empty.
+call before Consume, deduplication run before middlewares added using Use
+
+	Example
+	queue := NewBaseQueue("", "invoice-paid").
+		SetupQueue(nil, nil).
+		SetupDeduplication(NewRedisIdempotencyStore(redisClient, "", 24*time.Hour)).
+		AddConsumer(false)
+*/
+func (base *QueueSetup) SetupDeduplication(store IdempotencyStore) *QueueSetup {
+	base.dedupStore = store
+	return base
+}
+
+func (base *QueueSetup) getConsumerMiddlewares() []Middleware {
+	if base.dedupStore == nil {
+		return base.middlewares
+	}
+
+	return append([]Middleware{IdempotencyMiddleware(base.dedupStore)}, base.middlewares...)
+}
+
+// assignMessageID message without message id can't be deduplicated by consumer
+func assignMessageID(msgs []amqp.Publishing) {
+	for idx := range msgs {
+		if msgs[idx].MessageId == "" {
+			msgs[idx].MessageId = uuid.New().String()
+		}
+	}
+}
+
+type lruEntry struct {
+	key       string
+	expiredAt time.Time
+}
+
+// lruIdempotencyStore remove least recently used processed key when capacity is reached,
+// claimed key is kept separately until processed or released, so it's not removed while the message is handled
+type lruIdempotencyStore struct {
+	mutex    sync.Mutex
+	capacity int
+	ttl      time.Duration
+	entries  *list.List
+	keys     map[string]*list.Element
+	claimed  map[string]bool
+}
+
+// NewLRUIdempotencyStore only for single consumer process, default capacity 10000 processed key and ttl 24 hour
+func NewLRUIdempotencyStore(capacity int, ttl time.Duration) IdempotencyStore {
+	if capacity <= 0 {
+		capacity = 10000
+	}
+
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+
+	return &lruIdempotencyStore{
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  list.New(),
+		keys:     make(map[string]*list.Element),
+		claimed:  make(map[string]bool),
+	}
+}
+
+func (store *lruIdempotencyStore) Claim(ctx context.Context, key string) (ClaimResult, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.claimed[key] {
+		return ClaimInProgress, nil
+	}
+
+	if element, ok := store.keys[key]; ok {
+		if time.Now().Before(element.Value.(*lruEntry).expiredAt) {
+			store.entries.MoveToFront(element)
+			return ClaimProcessed, nil
+		}
+
+		store.entries.Remove(element)
+		delete(store.keys, key)
+	}
+
+	store.claimed[key] = true
+	return ClaimAcquired, nil
+}
+
+func (store *lruIdempotencyStore) MarkProcessed(ctx context.Context, key string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.claimed, key)
+	if element, ok := store.keys[key]; ok {
+		element.Value.(*lruEntry).expiredAt = time.Now().Add(store.ttl)
+		store.entries.MoveToFront(element)
+		return nil
+	}
+
+	store.keys[key] = store.entries.PushFront(&lruEntry{key: key, expiredAt: time.Now().Add(store.ttl)})
+	for store.entries.Len() > store.capacity {
+		oldest := store.entries.Back()
+		store.entries.Remove(oldest)
+		delete(store.keys, oldest.Value.(*lruEntry).key)
+	}
+
+	return nil
+}
+
+func (store *lruIdempotencyStore) Release(ctx context.Context, key string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.claimed, key) // processed key is not claimed anymore, so it's kept
+	return nil
+}
+
+const redisClaimValue = "processing"
+
+// claimScript set claim if key didn't exist, return ClaimResult
+var claimScript = redis.NewScript(`
+local value = redis.call("GET", KEYS[1])
+if not value then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 0
+end
+if value == ARGV[1] then
+	return 1
+end
+return 2`)
+
+// releaseClaimScript only delete claim that is not yet marked processed
+var releaseClaimScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+/*
+redisIdempotencyStore shared by every consumer process, claimed atomically so only one worker handle the message.
+claim expired after claim timeout if the process stopped before the message is handled, processed key expired after ttl
+*/
+type redisIdempotencyStore struct {
+	client       redis.UniversalClient
+	prefix       string
+	ttl          time.Duration
+	claimTimeout time.Duration
+}
+
+// NewRedisIdempotencyStore default prefix "rabbitmq:processed:" and ttl 24 hour, claim timeout is 5 minute (or ttl if shorter).
+// message handled longer than claim timeout can be handled again by other worker
+func NewRedisIdempotencyStore(client redis.UniversalClient, prefix string, ttl time.Duration) IdempotencyStore {
+	if prefix == "" {
+		prefix = "rabbitmq:processed:"
+	}
+
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+
+	claimTimeout := 5 * time.Minute
+	if ttl < claimTimeout {
+		claimTimeout = ttl
+	}
+
+	return &redisIdempotencyStore{
+		client:       client,
+		prefix:       prefix,
+		ttl:          ttl,
+		claimTimeout: claimTimeout,
+	}
+}
+
+func (store *redisIdempotencyStore) Claim(ctx context.Context, key string) (ClaimResult, error) {
+	result, err := claimScript.Run(ctx, store.client, []string{store.prefix + key}, redisClaimValue, store.claimTimeout.Milliseconds()).Int()
+	if err != nil {
+		return ClaimInProgress, err
+	}
+
+	return ClaimResult(result), nil
+}
+
+func (store *redisIdempotencyStore) MarkProcessed(ctx context.Context, key string) error {
+	return store.client.Set(ctx, store.prefix+key, time.Now().UTC().Format(time.RFC3339), store.ttl).Err()
+}
+
+func (store *redisIdempotencyStore) Release(ctx context.Context, key string) error {
+	return releaseClaimScript.Run(ctx, store.client, []string{store.prefix + key}, redisClaimValue).Err()
+}
@@ -0,0 +1,194 @@
+package rabbitmq
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/redis/go-redis/v9"
+)
+
+// getTestRedisClient redis from REDIS_ADDR (default localhost:6379), nil if redis is unavailable
+func getTestRedisClient(t *testing.T) redis.UniversalClient {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Logf("redis [%s] unavailable, redis store is not tested: %v", addr, err)
+		_ = client.Close()
+		return nil
+	}
+
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+
+	return client
+}
+
+func TestConsumerDeduplication(t *testing.T) {
+	queueSetup := getTestConsumerQueue(nil).SetupDeduplication(NewLRUIdempotencyStore(0, 0))
+
+	totalHandled := 0
+	handler := chainMiddlewares(func(ctx context.Context, delivery amqp.Delivery) error {
+		totalHandled++
+		return nil
+	}, queueSetup.getConsumerMiddlewares())
+
+	acknowledger := &testAcknowledger{}
+	for deliveryTag := uint64(1); deliveryTag <= 3; deliveryTag++ {
+		delivery := getTestDelivery(acknowledger, deliveryTag, "invoice-paid")
+		delivery.MessageId = "message-1"
+		delivery.Redelivered = deliveryTag > 1
+		queueSetup.handleDelivery(handler, delivery, false)
+	}
+
+	if totalHandled != 1 {
+		t.Fail()
+		t.Logf("expected duplicate message handled once, got %d", totalHandled)
+		return
+	}
+
+	if acknowledger.totalAcked() != 3 {
+		t.Fail()
+		t.Logf("expected duplicate message acked, got %d acked", acknowledger.totalAcked())
+		return
+	}
+
+	t.Log("success skip duplicate message")
+	return
+}
+
+func TestLRUIdempotencyStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewLRUIdempotencyStore(2, 50*time.Millisecond)
+
+	// claimed key is not counted on capacity, so it's not removed while handled
+	for _, key := range []string{"message-1", "message-2", "message-3"} {
+		if result, _ := store.Claim(ctx, key); result != ClaimAcquired {
+			t.Fail()
+			t.Logf("expected [%s] claimed, got %d", key, result)
+			return
+		}
+	}
+
+	if result, _ := store.Claim(ctx, "message-1"); result != ClaimInProgress {
+		t.Fail()
+		t.Logf("expected claimed key in progress, got %d", result)
+		return
+	}
+
+	_ = store.MarkProcessed(ctx, "message-1")
+	_ = store.MarkProcessed(ctx, "message-2")
+	_, _ = store.Claim(ctx, "message-1") // message-2 become least recently used
+	_ = store.MarkProcessed(ctx, "message-3")
+
+	expectedResults := []struct {
+		key    string
+		result ClaimResult
+	}{
+		{key: "message-1", result: ClaimProcessed},
+		{key: "message-3", result: ClaimProcessed},
+		{key: "message-2", result: ClaimAcquired}, // removed when message-3 processed
+	}
+
+	for _, expected := range expectedResults {
+		if result, _ := store.Claim(ctx, expected.key); result != expected.result {
+			t.Fail()
+			t.Logf("expected [%s] claim result %d, got %d", expected.key, expected.result, result)
+			return
+		}
+	}
+
+	_ = store.Release(ctx, "message-2")
+	_ = store.Release(ctx, "message-1") // processed key is not released
+	if result, _ := store.Claim(ctx, "message-2"); result != ClaimAcquired {
+		t.Fail()
+		t.Log("expected released key claimed again")
+		return
+	}
+
+	if result, _ := store.Claim(ctx, "message-1"); result != ClaimProcessed {
+		t.Fail()
+		t.Log("expected processed key not released")
+		return
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if result, _ := store.Claim(ctx, "message-1"); result != ClaimAcquired {
+		t.Fail()
+		t.Log("expected processed key expired after ttl")
+		return
+	}
+
+	t.Log("success evict and expire processed message id")
+	return
+}
+
+func TestIdempotencyStoreConcurrentClaim(t *testing.T) {
+	stores := map[string]IdempotencyStore{"lru": NewLRUIdempotencyStore(0, 0)}
+	if client := getTestRedisClient(t); client != nil {
+		stores["redis"] = NewRedisIdempotencyStore(client, "rabbitmq:test:processed:"+uuid.New().String()+":", time.Minute)
+	}
+
+	ctx := context.Background()
+	for name, store := range stores {
+		var totalClaimed, totalInProgress int32
+		var waitGroup sync.WaitGroup
+		for idx := 0; idx < 20; idx++ {
+			waitGroup.Add(1)
+			go func() {
+				defer waitGroup.Done()
+				switch result, _ := store.Claim(ctx, "message-1"); result {
+				case ClaimAcquired:
+					atomic.AddInt32(&totalClaimed, 1)
+				case ClaimInProgress:
+					atomic.AddInt32(&totalInProgress, 1)
+				}
+			}()
+		}
+
+		waitGroup.Wait()
+		if totalClaimed != 1 || totalInProgress != 19 {
+			t.Fail()
+			t.Logf("expected [%s] message claimed by one worker and in progress for others, got %d claimed %d in progress", name, totalClaimed, totalInProgress)
+			return
+		}
+
+		_ = store.MarkProcessed(ctx, "message-1")
+		_ = store.Release(ctx, "message-1") // processed key is not released
+		if result, _ := store.Claim(ctx, "message-1"); result != ClaimProcessed {
+			t.Fail()
+			t.Logf("expected [%s] processed message not claimed again, got %d", name, result)
+			return
+		}
+	}
+
+	t.Log("success claim message once")
+	return
+}
+
+func TestAssignMessageID(t *testing.T) {
+	msgs := []amqp.Publishing{{}, {MessageId: "message-1"}}
+	assignMessageID(msgs)
+
+	if msgs[0].MessageId == "" || msgs[1].MessageId != "message-1" {
+		t.Fail()
+		t.Logf("unexpected message id %q %q", msgs[0].MessageId, msgs[1].MessageId)
+		return
+	}
+
+	t.Log("success assign message id")
+	return
+}
@@ -1,6 +1,7 @@
 package rabbitmq
 
 import (
+	"log/slog"
 	"os"
 
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -64,36 +65,53 @@ func (base *QueueSetup) SetupExchange(exchangeDeclareConfig *ExchangeDeclareConf
 	return base
 }
 
+// AddConsumerExchange panic if connection can't be opened or declaration failed, use AddConsumerExchangeE to get the error
 func (base *QueueSetup) AddConsumerExchange(isReconnect bool) *QueueSetup {
-	err := base.openConnection()
+	queueSetup, err := base.AddConsumerExchangeE(isReconnect)
 	if err != nil {
-		loggingMessage("error open new connection", err.Error())
 		panic(err.Error())
 	}
 
+	return queueSetup
+}
+
+// AddConsumerExchangeE same as AddConsumerExchange, but return error instead of panic, reconnect is only started if no error
+func (base *QueueSetup) AddConsumerExchangeE(isReconnect bool) (*QueueSetup, error) {
+	err := base.ensureConnection()
+	if err != nil {
+		base.getLogger().Error("Error open new connection", slog.Any("error", err))
+		return base, err
+	}
+
 	err = base.exchangeDeclare()
 	if err != nil {
-		loggingMessage("error declare exchange after open connection", err.Error())
-		panic(err.Error())
+		base.getLogger().Error("Error declare exchange after open connection", slog.Any("error", err))
+		return base, err
 	}
 
 	err = base.declareQueue()
 	if err != nil {
-		loggingMessage("error declare queue after exchange declare", err.Error())
-		panic(err.Error())
+		base.getLogger().Error("Error declare queue after exchange declare", slog.Any("error", err))
+		return base, err
 	}
 
 	err = base.bindQueue()
 	if err != nil {
-		loggingMessage("error bind queue after queue declare", err.Error())
-		panic(err.Error())
+		base.getLogger().Error("Error bind queue after queue declare", slog.Any("error", err))
+		return base, err
+	}
+
+	err = base.declareRetryQueues()
+	if err != nil {
+		base.getLogger().Error("Error declare retry queues", slog.Any("error", err))
+		return base, err
 	}
 
 	if !isReconnect {
-		go base.reconnect()
+		base.startReconnect()
 	}
 
-	return base
+	return base, nil
 }
 
 func (base *QueueSetup) exchangeDeclare() error {
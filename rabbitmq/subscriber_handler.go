@@ -0,0 +1,99 @@
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MessageHandler function for subscribers message handler, returned error decide what happen to the message:
+//   - nil                      : ack
+//   - Requeue(err)             : nack and requeue, message redelivered immediately
+//   - RetryLater(err, delay)   : retry the message with x-retry header, until max retry reached
+//   - Drop(err)                : ack, message is discarded
+//   - DeadLetter(err)          : reject without requeue, routed to DLX if configured
+//   - other error              : same as RetryLater(err, 0)
+type MessageHandler func(data ConsumerHandlerData) error
+
+// AdaptConsumerHandler adapter for ConsumerHandler, panic on handler still retry the message
+func AdaptConsumerHandler(consumer ConsumerHandler) MessageHandler {
+	return func(data ConsumerHandlerData) error {
+		consumer(data)
+		return nil
+	}
+}
+
+type HandlerAction int
+
+const (
+	ActionAck HandlerAction = iota
+	ActionRequeue
+	ActionRetry
+	ActionDrop
+	ActionDeadLetter
+)
+
+func (action HandlerAction) String() string {
+	switch action {
+	case ActionAck:
+		return "ack"
+	case ActionRequeue:
+		return "requeue"
+	case ActionRetry:
+		return "retry"
+	case ActionDrop:
+		return "drop"
+	case ActionDeadLetter:
+		return "dead-letter"
+	default:
+		return fmt.Sprintf("unknown action [%d]", action)
+	}
+}
+
+type HandlerError struct {
+	Action HandlerAction
+	Delay  time.Duration // only for ActionRetry, 0 use default retry delay
+	Err    error
+}
+
+func (handlerError *HandlerError) Error() string {
+	if handlerError.Err == nil {
+		return handlerError.Action.String()
+	}
+
+	return fmt.Sprintf("%s: %s", handlerError.Action.String(), handlerError.Err.Error())
+}
+
+func (handlerError *HandlerError) Unwrap() error {
+	return handlerError.Err
+}
+
+func Requeue(err error) error {
+	return &HandlerError{Action: ActionRequeue, Err: err}
+}
+
+func RetryLater(err error, delay time.Duration) error {
+	return &HandlerError{Action: ActionRetry, Delay: delay, Err: err}
+}
+
+func Drop(err error) error {
+	return &HandlerError{Action: ActionDrop, Err: err}
+}
+
+func DeadLetter(err error) error {
+	return &HandlerError{Action: ActionDeadLetter, Err: err}
+}
+
+// getHandlerAction action for error returned by MessageHandler
+func getHandlerAction(err error) (HandlerAction, time.Duration) {
+	if err == nil {
+		return ActionAck, 0
+	}
+
+	var handlerError *HandlerError
+	if errors.As(err, &handlerError) {
+		return handlerError.Action, handlerError.Delay
+	}
+
+	return ActionRetry, 0
+}
@@ -0,0 +1,238 @@
+package rabbitmq
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const HeaderRetry = "x-retry"
+
+/*
+RetryConfig retry failed message using retry queues, every delay on the schedule have their own queue
+with x-message-ttl, expired message dead-lettered back to the main queue using default exchange.
+Message moved to parking lot queue after max attempts reached
+
+	Exponential Example (1s, 2s, 4s, 8s, 10s)
+	retryConfig := &RetryConfig{
+		MaxAttempts:  5,
+		InitialDelay: time.Second,
+		Multiplier:   2,
+		MaxDelay:     10 * time.Second,
+	}
+
+	Custom Schedule Example
+	retryConfig := &RetryConfig{
+		MaxAttempts: 4,
+		Delays:      []time.Duration{5 * time.Second, time.Minute, 10 * time.Minute}, // last delay used for next attempts
+	}
+*/
+type RetryConfig struct {
+	MaxAttempts     int             // retry before message moved to parking lot queue, default 3
+	InitialDelay    time.Duration   // delay for first retry, default 1 second
+	Multiplier      float64         // multiplier delay for next retry, default 2
+	MaxDelay        time.Duration   // 0 for no max delay
+	Delays          []time.Duration // custom schedule, override exponential delay
+	ParkingLotQueue string          // default "<queue name>.parking-lot"
+}
+
+// SetupRetry call before AddConsumer or AddConsumerExchange, retry queues declared together with the main queue
+func (base *QueueSetup) SetupRetry(retryConfig *RetryConfig) *QueueSetup {
+	if retryConfig == nil {
+		retryConfig = &RetryConfig{}
+	}
+
+	retryConfig.setDefault(base.queueName)
+	base.retryConfig = retryConfig
+	return base
+}
+
+func (config *RetryConfig) setDefault(queueName string) {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 3
+	}
+
+	if config.InitialDelay <= 0 {
+		config.InitialDelay = time.Second
+	}
+
+	if config.Multiplier <= 0 {
+		config.Multiplier = 2
+	}
+
+	if config.ParkingLotQueue == "" {
+		config.ParkingLotQueue = queueName + ".parking-lot"
+	}
+}
+
+// Schedule delay for every retry attempt, index 0 for first retry
+func (config *RetryConfig) Schedule() []time.Duration {
+	schedule := make([]time.Duration, config.MaxAttempts)
+	for idx := range schedule {
+		if len(config.Delays) > 0 {
+			schedule[idx] = config.Delays[int(math.Min(float64(idx), float64(len(config.Delays)-1)))]
+			continue
+		}
+
+		delay := time.Duration(float64(config.InitialDelay) * math.Pow(config.Multiplier, float64(idx)))
+		if config.MaxDelay > 0 && delay > config.MaxDelay {
+			delay = config.MaxDelay
+		}
+
+		schedule[idx] = delay
+	}
+
+	return schedule
+}
+
+func getRetryQueueName(queueName string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%dms", queueName, delay.Milliseconds())
+}
+
+func getRetryQueueArgs(queueName string, delay time.Duration) amqp.Table {
+	return amqp.Table{
+		"x-message-ttl":             delay.Milliseconds(),
+		"x-dead-letter-exchange":    "", // default exchange, routed back to main queue by name
+		"x-dead-letter-routing-key": queueName,
+	}
+}
+
+// getRetryDelay delay for the attempt, requested delay (see RetryLater) use the nearest retry queue delay
+func (config *RetryConfig) getRetryDelay(attempt int, requestedDelay time.Duration) time.Duration {
+	schedule := config.Schedule()
+	if requestedDelay <= 0 {
+		return schedule[attempt-1]
+	}
+
+	selected := time.Duration(0)
+	for _, delay := range schedule {
+		if delay >= requestedDelay && (selected == 0 || delay < selected) {
+			selected = delay
+		}
+	}
+
+	if selected == 0 { // requested delay longer than every retry queue
+		for _, delay := range schedule {
+			if delay > selected {
+				selected = delay
+			}
+		}
+	}
+
+	return selected
+}
+
+func (base *QueueSetup) declareRetryQueues() error {
+	if base.retryConfig == nil {
+		return nil
+	}
+
+	durable := base.queueConfig.QueueDeclareConfig.Durable
+
+	declared := make(map[string]bool)
+	for _, delay := range base.retryConfig.Schedule() {
+		retryQueueName := getRetryQueueName(base.queueName, delay)
+		if declared[retryQueueName] {
+			continue
+		}
+
+		_, err := base.channel.QueueDeclare(retryQueueName, durable, false, false, false, getRetryQueueArgs(base.queueName, delay))
+		if err != nil {
+			return err
+		}
+
+		declared[retryQueueName] = true
+	}
+
+	_, err := base.channel.QueueDeclare(base.retryConfig.ParkingLotQueue, durable, false, false, false, nil)
+	return err
+}
+
+func getRetryCount(headers amqp.Table) int {
+	retryCount := 0
+	if val, ok := headers[HeaderRetry]; ok {
+		switch v := val.(type) {
+		case int32:
+			retryCount = int(v)
+		case int64:
+			retryCount = int(v)
+		case int:
+			retryCount = v
+		case float64:
+			retryCount = int(v)
+		}
+	}
+
+	return retryCount
+}
+
+// retryWithQueues publish message to retry queue, or parking lot queue after max attempts,
+// original message is acked after republished, so it's not dead-lettered twice
+func (base *QueueSetup) retryWithQueues(delivery amqp.Delivery, isAutoAck bool, requestedDelay time.Duration) {
+	retryCount := getRetryCount(delivery.Headers) + 1
+	headers := getRetryHeaders(delivery.Headers, retryCount)
+
+	logger := base.getDeliveryLogger(delivery)
+	action := ActionDeadLetter
+	routingKey := base.retryConfig.ParkingLotQueue
+	if retryCount <= base.retryConfig.MaxAttempts {
+		delay := base.retryConfig.getRetryDelay(retryCount, requestedDelay)
+		routingKey = getRetryQueueName(base.queueName, delay)
+		action = ActionRetry
+		base.logMessage(logger, "Retrying message", slog.Int("retry", retryCount), slog.Duration("delay", delay))
+	} else {
+		logger.Warn("Exceeded max retries, sending to parking lot queue", slog.Int("max_attempts", base.retryConfig.MaxAttempts))
+	}
+
+	err := base.getChannel().Publish("", routingKey, false, false, deliveryToPublishing(delivery, headers))
+	if isAutoAck {
+		if err == nil {
+			base.getMetrics().MessageSettled(base.queueName, base.getRole(), action)
+		}
+
+		return
+	}
+
+	if err != nil {
+		logger.Error("Failed to publish message to retry queue", slog.String("retry_queue", routingKey), slog.Any("error", err))
+		_ = delivery.Nack(false, true) // keep the message, redelivered immediately
+		base.getMetrics().MessageSettled(base.queueName, base.getRole(), ActionRequeue)
+		return
+	}
+
+	_ = delivery.Ack(false)
+	base.getMetrics().MessageSettled(base.queueName, base.getRole(), action)
+}
+
+// getRetryHeaders copy of delivery headers with x-retry, delivery headers is not changed
+func getRetryHeaders(deliveryHeaders amqp.Table, retryCount int) amqp.Table {
+	headers := amqp.Table{}
+	for key, value := range deliveryHeaders {
+		headers[key] = value
+	}
+
+	headers[HeaderRetry] = retryCount
+	return headers
+}
+
+// deliveryToPublishing keep delivery properties when message republished,
+// expiration and user id is not copied, so republished message didn't expire again or rejected by broker
+func deliveryToPublishing(delivery amqp.Delivery, headers amqp.Table) amqp.Publishing {
+	return amqp.Publishing{
+		Headers:         headers,
+		ContentType:     delivery.ContentType,
+		ContentEncoding: delivery.ContentEncoding,
+		DeliveryMode:    delivery.DeliveryMode,
+		Priority:        delivery.Priority,
+		CorrelationId:   delivery.CorrelationId,
+		ReplyTo:         delivery.ReplyTo,
+		MessageId:       delivery.MessageId,
+		Timestamp:       delivery.Timestamp,
+		Type:            delivery.Type,
+		AppId:           delivery.AppId,
+		Body:            delivery.Body,
+	}
+}
@@ -0,0 +1,101 @@
+package rabbitmq
+
+import (
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestRetryConfigSchedule(t *testing.T) {
+	queueSetup := &QueueSetup{queueName: "orders"}
+	queueSetup.SetupRetry(&RetryConfig{
+		MaxAttempts:  5,
+		InitialDelay: time.Second,
+		MaxDelay:     5 * time.Second,
+	})
+
+	retryConfig := queueSetup.retryConfig
+	expectedSchedule := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for idx, delay := range retryConfig.Schedule() {
+		if delay != expectedSchedule[idx] {
+			t.Fail()
+			t.Logf("expected delay [%s] for attempt %d, got [%s]", expectedSchedule[idx], idx+1, delay)
+			return
+		}
+	}
+
+	if retryConfig.ParkingLotQueue != "orders.parking-lot" {
+		t.Fail()
+		t.Logf("unexpected parking lot queue [%s]", retryConfig.ParkingLotQueue)
+		return
+	}
+
+	if getRetryQueueName("orders", 2*time.Second) != "orders.retry.2000ms" {
+		t.Fail()
+		t.Logf("unexpected retry queue name [%s]", getRetryQueueName("orders", 2*time.Second))
+		return
+	}
+
+	t.Log("success generate retry schedule")
+	return
+}
+
+func TestRetryConfigRequestedDelay(t *testing.T) {
+	retryConfig := &RetryConfig{
+		MaxAttempts: 4,
+		Delays:      []time.Duration{time.Second, 30 * time.Second, time.Minute},
+	}
+
+	testCases := []struct {
+		attempt        int
+		requestedDelay time.Duration
+		expectedDelay  time.Duration
+	}{
+		{attempt: 1, requestedDelay: 0, expectedDelay: time.Second},
+		{attempt: 4, requestedDelay: 0, expectedDelay: time.Minute}, // last delay used for next attempts
+		{attempt: 1, requestedDelay: 10 * time.Second, expectedDelay: 30 * time.Second},
+		{attempt: 1, requestedDelay: time.Hour, expectedDelay: time.Minute},
+	}
+
+	for _, testCase := range testCases {
+		delay := retryConfig.getRetryDelay(testCase.attempt, testCase.requestedDelay)
+		if delay != testCase.expectedDelay {
+			t.Fail()
+			t.Logf("expected delay [%s], got [%s]", testCase.expectedDelay, delay)
+			return
+		}
+	}
+
+	t.Log("success select retry queue delay")
+	return
+}
+
+func TestDeliveryToPublishingRetry(t *testing.T) {
+	delivery := amqp.Delivery{
+		Headers:       amqp.Table{"x-tenant": "tenant-1", HeaderRetry: int32(1)},
+		MessageId:     "message-1",
+		CorrelationId: "correlation-1",
+		ReplyTo:       "reply-queue",
+		Type:          "order-created",
+		Priority:      5,
+		Body:          []byte(`{"event_type":"order-created"}`),
+	}
+
+	msg := deliveryToPublishing(delivery, getRetryHeaders(delivery.Headers, 2))
+	if msg.MessageId != "message-1" || msg.CorrelationId != "correlation-1" || msg.ReplyTo != "reply-queue" ||
+		msg.Type != "order-created" || msg.Priority != 5 {
+		t.Fail()
+		t.Logf("expected delivery properties kept on retry, got %+v", msg)
+		return
+	}
+
+	if msg.Headers[HeaderRetry] != 2 || msg.Headers["x-tenant"] != "tenant-1" || delivery.Headers[HeaderRetry] != int32(1) {
+		t.Fail()
+		t.Logf("expected retry header on copied headers only, got %v and %v", msg.Headers, delivery.Headers)
+		return
+	}
+
+	t.Log("success keep delivery properties on retry")
+	return
+}
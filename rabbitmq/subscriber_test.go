@@ -0,0 +1,163 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// testAcknowledger record ack/nack/reject from consumer without rabbitmq
+type testAcknowledger struct {
+	mutex    sync.Mutex
+	acked    []uint64
+	nacked   []uint64
+	rejected []uint64
+}
+
+func (ack *testAcknowledger) Ack(tag uint64, multiple bool) error {
+	ack.mutex.Lock()
+	defer ack.mutex.Unlock()
+	ack.acked = append(ack.acked, tag)
+	return nil
+}
+
+func (ack *testAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	ack.mutex.Lock()
+	defer ack.mutex.Unlock()
+	ack.nacked = append(ack.nacked, tag)
+	return nil
+}
+
+func (ack *testAcknowledger) Reject(tag uint64, requeue bool) error {
+	ack.mutex.Lock()
+	defer ack.mutex.Unlock()
+	ack.rejected = append(ack.rejected, tag)
+	return nil
+}
+
+func (ack *testAcknowledger) totalAcked() int {
+	ack.mutex.Lock()
+	defer ack.mutex.Unlock()
+	return len(ack.acked)
+}
+
+func getTestConsumerQueue(consumerConfig *ConsumerConfig) *QueueSetup {
+	ctx, cancel := context.WithCancel(context.Background())
+	queueSetup := &QueueSetup{queueName: "test-queue", ctx: ctx, cancel: cancel}
+	return queueSetup.SetupQueue(nil, consumerConfig)
+}
+
+func getTestDelivery(acknowledger amqp.Acknowledger, deliveryTag uint64, eventType string) amqp.Delivery {
+	body, _ := json.Marshal(ConsumerHandlerData{EventType: eventType, Data: map[string]interface{}{"id": deliveryTag}})
+	return amqp.Delivery{
+		Acknowledger: acknowledger,
+		DeliveryTag:  deliveryTag,
+		RoutingKey:   "test-queue",
+		Body:         body,
+	}
+}
+
+func TestConsumerWorkerPool(t *testing.T) {
+	const totalWorker = 3
+
+	queueSetup := getTestConsumerQueue(&ConsumerConfig{Workers: totalWorker})
+	if queueSetup.queueConfig.QueueConsumerConfig.PrefetchCount != totalWorker {
+		t.Fail()
+		t.Log("prefetch count should default to total workers")
+		return
+	}
+
+	acknowledger := &testAcknowledger{}
+	deliveries := make(chan amqp.Delivery, totalWorker)
+
+	var running sync.WaitGroup
+	running.Add(totalWorker)
+	release := make(chan struct{})
+	queueSetup.executeMessageConsumer(newDeliveryHandler(AdaptConsumerHandler(func(data ConsumerHandlerData) {
+		running.Done()
+		<-release // slow handler, only finished when all workers got message
+	})), deliveries, false)
+
+	for i := 1; i <= totalWorker; i++ {
+		deliveries <- getTestDelivery(acknowledger, uint64(i), "test-created")
+	}
+
+	concurrent := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(concurrent)
+	}()
+
+	select {
+	case <-concurrent:
+	case <-time.After(time.Second):
+		t.Fail()
+		t.Log("messages should be handled concurrently by workers")
+		return
+	}
+
+	close(release)
+	close(deliveries)
+	queueSetup.waitGroup.Wait()
+
+	if acknowledger.totalAcked() != totalWorker {
+		t.Fail()
+		t.Logf("expected %d acked messages, got %d", totalWorker, acknowledger.totalAcked())
+		return
+	}
+
+	t.Log("success handle message with worker pool")
+	return
+}
+
+func TestConsumerHandlerError(t *testing.T) {
+	queueSetup := getTestConsumerQueue(nil)
+	acknowledger := &testAcknowledger{}
+
+	handlerErr := errors.New("handler error")
+	handler := func(data ConsumerHandlerData) error {
+		switch data.EventType {
+		case "requeue":
+			return Requeue(handlerErr)
+		case "drop":
+			return Drop(handlerErr)
+		case "dead-letter":
+			return fmt.Errorf("wrapped: %w", DeadLetter(handlerErr))
+		default:
+			return nil
+		}
+	}
+
+	queueSetup.handleDelivery(newDeliveryHandler(handler), getTestDelivery(acknowledger, 1, "success"), false)
+	queueSetup.handleDelivery(newDeliveryHandler(handler), getTestDelivery(acknowledger, 2, "requeue"), false)
+	queueSetup.handleDelivery(newDeliveryHandler(handler), getTestDelivery(acknowledger, 3, "drop"), false)
+	queueSetup.handleDelivery(newDeliveryHandler(handler), getTestDelivery(acknowledger, 4, "dead-letter"), false)
+	queueSetup.handleDelivery(newDeliveryHandler(handler), amqp.Delivery{Acknowledger: acknowledger, DeliveryTag: 5, Body: []byte("not json")}, false)
+
+	if len(acknowledger.acked) != 2 || acknowledger.acked[0] != 1 || acknowledger.acked[1] != 3 {
+		t.Fail()
+		t.Logf("expected success and dropped message acked, got %v", acknowledger.acked)
+		return
+	}
+
+	if len(acknowledger.nacked) != 1 || acknowledger.nacked[0] != 2 {
+		t.Fail()
+		t.Logf("expected requeue message nacked, got %v", acknowledger.nacked)
+		return
+	}
+
+	if len(acknowledger.rejected) != 2 || acknowledger.rejected[0] != 4 || acknowledger.rejected[1] != 5 {
+		t.Fail()
+		t.Logf("expected dead letter and malformed message rejected, got %v", acknowledger.rejected)
+		return
+	}
+
+	t.Log("success handle message based on handler error")
+	return
+}
@@ -0,0 +1,612 @@
+package rabbitmq
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	DriftMissing  = "missing"  // exchange or queue is not declared on broker
+	DriftMismatch = "mismatch" // declared with different type, flags or args
+)
+
+/*
+Topology exchanges, queues and bindings declared together at startup, see LoadTopology.
+queue dead letter and retry declared the same as DeadLetterConfig and RetryConfig,
+so QueueSetup using QueueConfig didn't conflict with the declared queue
+
+	JSON Example
+	{
+		"exchanges": [
+			{"name": "orders", "kind": "topic", "durable": true}
+		],
+		"queues": [
+			{
+				"name": "invoice-paid",
+				"durable": true,
+				"args": {"x-max-length": 10000},
+				"dead_letter": {"queue_args": {"x-message-ttl": 604800000}},
+				"retry": {"max_attempts": 5, "initial_delay": "1s", "multiplier": 2, "max_delay": "1m"}
+			}
+		],
+		"bindings": [
+			{"exchange": "orders", "queue": "invoice-paid", "routing_key": "invoice.paid"}
+		]
+	}
+*/
+type Topology struct {
+	Exchanges []TopologyExchange `json:"exchanges" yaml:"exchanges"`
+	Queues    []TopologyQueue    `json:"queues" yaml:"queues"`
+	Bindings  []TopologyBinding  `json:"bindings" yaml:"bindings"`
+}
+
+type TopologyExchange struct {
+	Name       string                 `json:"name" yaml:"name"`
+	Kind       string                 `json:"kind" yaml:"kind"` // default direct
+	Durable    bool                   `json:"durable" yaml:"durable"`
+	AutoDelete bool                   `json:"auto_delete" yaml:"auto_delete"`
+	Internal   bool                   `json:"internal" yaml:"internal"`
+	Args       map[string]interface{} `json:"args" yaml:"args"`
+}
+
+type TopologyQueue struct {
+	Name       string                 `json:"name" yaml:"name"`
+	Durable    bool                   `json:"durable" yaml:"durable"`
+	AutoDelete bool                   `json:"auto_delete" yaml:"auto_delete"`
+	Exclusive  bool                   `json:"exclusive" yaml:"exclusive"`
+	Args       map[string]interface{} `json:"args" yaml:"args"`
+	DeadLetter *TopologyDeadLetter    `json:"dead_letter" yaml:"dead_letter"` // If not nil, dead letter exchange and queue declared, see DeadLetterConfig
+	Retry      *TopologyRetry         `json:"retry" yaml:"retry"`             // If not nil, retry queues and parking lot queue declared, see RetryConfig
+}
+
+type TopologyDeadLetter struct {
+	Exchange   string                 `json:"exchange" yaml:"exchange"`
+	Queue      string                 `json:"queue" yaml:"queue"`
+	RoutingKey string                 `json:"routing_key" yaml:"routing_key"`
+	QueueArgs  map[string]interface{} `json:"queue_args" yaml:"queue_args"`
+}
+
+// TopologyRetry delay using duration string, ex: 500ms, 5s, 1m
+type TopologyRetry struct {
+	MaxAttempts     int      `json:"max_attempts" yaml:"max_attempts"`
+	InitialDelay    string   `json:"initial_delay" yaml:"initial_delay"`
+	Multiplier      float64  `json:"multiplier" yaml:"multiplier"`
+	MaxDelay        string   `json:"max_delay" yaml:"max_delay"`
+	Delays          []string `json:"delays" yaml:"delays"`
+	ParkingLotQueue string   `json:"parking_lot_queue" yaml:"parking_lot_queue"`
+}
+
+type TopologyBinding struct {
+	Exchange   string                 `json:"exchange" yaml:"exchange"`
+	Queue      string                 `json:"queue" yaml:"queue"`
+	RoutingKey string                 `json:"routing_key" yaml:"routing_key"`
+	Args       map[string]interface{} `json:"args" yaml:"args"`
+}
+
+// TopologyDrift difference between topology and broker, Detail is the error from broker
+type TopologyDrift struct {
+	Kind   string // exchange or queue
+	Name   string
+	Reason string // DriftMissing or DriftMismatch
+	Detail string
+}
+
+func (drift TopologyDrift) String() string {
+	if drift.Detail == "" {
+		return fmt.Sprintf("%s [%s] %s", drift.Kind, drift.Name, drift.Reason)
+	}
+
+	return fmt.Sprintf("%s [%s] %s: %s", drift.Kind, drift.Name, drift.Reason, drift.Detail)
+}
+
+/*
+LoadTopology parse and validate topology, nil unmarshal use json with unknown field rejected.
+yaml need the unmarshal from yaml package
+
+	Example
+	topology, err := LoadTopology(data, yaml.Unmarshal)
+*/
+func LoadTopology(data []byte, unmarshal func(data []byte, value interface{}) error) (*Topology, error) {
+	if unmarshal == nil {
+		unmarshal = unmarshalJSONStrict
+	}
+
+	topology := &Topology{}
+	if err := unmarshal(data, topology); err != nil {
+		return nil, fmt.Errorf("parse topology: %w", err)
+	}
+
+	if _, err := topology.getPlan(); err != nil {
+		return nil, err
+	}
+
+	return topology, nil
+}
+
+// LoadTopologyFile nil unmarshal only support .json file
+func LoadTopologyFile(path string, unmarshal func(data []byte, value interface{}) error) (*Topology, error) {
+	if unmarshal == nil && !strings.EqualFold(filepath.Ext(path), ".json") {
+		return nil, fmt.Errorf("topology file [%s] need unmarshal func, only json is supported by default", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return LoadTopology(data, unmarshal)
+}
+
+func unmarshalJSONStrict(data []byte, value interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(value)
+}
+
+// QueueConfig queue declare and retry config of the queue on topology, retry config is nil if retry is not configured
+//
+//	Example
+//	queueDeclareConfig, retryConfig, err := topology.QueueConfig("invoice-paid")
+//	queue := NewBaseQueue("", "invoice-paid").
+//		SetupQueue(queueDeclareConfig, nil).
+//		SetupRetry(retryConfig).
+//		AddConsumer(false)
+func (topology *Topology) QueueConfig(name string) (*QueueDeclareConfig, *RetryConfig, error) {
+	for _, queue := range topology.Queues {
+		if queue.Name == name {
+			return queue.getConfig()
+		}
+	}
+
+	return nil, nil, fmt.Errorf("queue [%s] is not on topology", name)
+}
+
+func (queue TopologyQueue) getConfig() (*QueueDeclareConfig, *RetryConfig, error) {
+	queueDeclareConfig := &QueueDeclareConfig{
+		Durable:    queue.Durable,
+		AutoDelete: queue.AutoDelete,
+		Exclusive:  queue.Exclusive,
+		Args:       toTopologyTable(queue.Args),
+	}
+
+	if queue.DeadLetter != nil {
+		queueDeclareConfig.DeadLetter = &DeadLetterConfig{
+			Exchange:   queue.DeadLetter.Exchange,
+			Queue:      queue.DeadLetter.Queue,
+			RoutingKey: queue.DeadLetter.RoutingKey,
+			QueueArgs:  toTopologyTable(queue.DeadLetter.QueueArgs),
+		}
+		queueDeclareConfig.DeadLetter.setDefault(queue.Name)
+	}
+
+	if queue.Retry == nil {
+		return queueDeclareConfig, nil, nil
+	}
+
+	retryConfig := &RetryConfig{
+		MaxAttempts:     queue.Retry.MaxAttempts,
+		Multiplier:      queue.Retry.Multiplier,
+		ParkingLotQueue: queue.Retry.ParkingLotQueue,
+	}
+
+	var err error
+	if retryConfig.InitialDelay, err = parseTopologyDuration(queue.Retry.InitialDelay); err != nil {
+		return nil, nil, fmt.Errorf("queue [%s] retry initial delay: %w", queue.Name, err)
+	}
+
+	if retryConfig.MaxDelay, err = parseTopologyDuration(queue.Retry.MaxDelay); err != nil {
+		return nil, nil, fmt.Errorf("queue [%s] retry max delay: %w", queue.Name, err)
+	}
+
+	for _, value := range queue.Retry.Delays {
+		delay, err := parseTopologyDuration(value)
+		if err != nil || delay <= 0 {
+			return nil, nil, fmt.Errorf("queue [%s] retry delay [%s] is not valid", queue.Name, value)
+		}
+
+		retryConfig.Delays = append(retryConfig.Delays, delay)
+	}
+
+	retryConfig.setDefault(queue.Name)
+	return queueDeclareConfig, retryConfig, nil
+}
+
+func parseTopologyDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	return time.ParseDuration(value)
+}
+
+// toTopologyTable json number decoded as float64, whole number changed to int64
+// so broker accept it for integer args, ex: x-message-ttl
+func toTopologyTable(args map[string]interface{}) amqp.Table {
+	if len(args) == 0 {
+		return nil
+	}
+
+	table := amqp.Table{}
+	for key, value := range args {
+		table[key] = toTopologyValue(value)
+	}
+
+	return table
+}
+
+func toTopologyValue(value interface{}) interface{} {
+	switch typedValue := value.(type) {
+	case float64:
+		if typedValue == math.Trunc(typedValue) {
+			return int64(typedValue)
+		}
+	case int:
+		return int64(typedValue)
+	case map[string]interface{}:
+		return toTopologyTable(typedValue)
+	case map[interface{}]interface{}: // yaml v2 map
+		table := amqp.Table{}
+		for key, item := range typedValue {
+			table[fmt.Sprint(key)] = toTopologyValue(item)
+		}
+
+		return table
+	case []interface{}:
+		items := make([]interface{}, len(typedValue))
+		for idx, item := range typedValue {
+			items[idx] = toTopologyValue(item)
+		}
+
+		return items
+	}
+
+	return value
+}
+
+type topologyExchangeDeclaration struct {
+	name       string
+	kind       string
+	durable    bool
+	autoDelete bool
+	internal   bool
+	args       amqp.Table
+}
+
+type topologyQueueDeclaration struct {
+	name       string
+	durable    bool
+	autoDelete bool
+	exclusive  bool
+	args       amqp.Table
+}
+
+type topologyBindingDeclaration struct {
+	queue      string
+	routingKey string
+	exchange   string
+	args       amqp.Table
+}
+
+// topologyPlan declaration order, exchanges first then queues and bindings
+type topologyPlan struct {
+	exchanges []topologyExchangeDeclaration
+	queues    []topologyQueueDeclaration
+	bindings  []topologyBindingDeclaration
+}
+
+// addExchange the same declaration is added once, ex: dead letter exchange shared by many queues
+func (plan *topologyPlan) addExchange(declaration topologyExchangeDeclaration) error {
+	for _, exchange := range plan.exchanges {
+		if exchange.name != declaration.name {
+			continue
+		}
+
+		if !reflect.DeepEqual(exchange, declaration) {
+			return fmt.Errorf("exchange [%s] declared twice with different config on topology", declaration.name)
+		}
+
+		return nil
+	}
+
+	plan.exchanges = append(plan.exchanges, declaration)
+	return nil
+}
+
+// addQueue the same declaration is added once, ex: dead letter exchange shared by many queues
+func (plan *topologyPlan) addQueue(declaration topologyQueueDeclaration) error {
+	for _, queue := range plan.queues {
+		if queue.name != declaration.name {
+			continue
+		}
+
+		if !reflect.DeepEqual(queue, declaration) {
+			return fmt.Errorf("queue [%s] declared twice with different config on topology", declaration.name)
+		}
+
+		return nil
+	}
+
+	plan.queues = append(plan.queues, declaration)
+	return nil
+}
+
+// getPlan validate topology and add dead letter and retry declaration of every queue
+func (topology *Topology) getPlan() (*topologyPlan, error) {
+	plan := &topologyPlan{}
+	for _, exchange := range topology.Exchanges {
+		if exchange.Name == "" {
+			return nil, errors.New("topology exchange name is empty")
+		}
+
+		kind := exchange.Kind
+		if kind == "" {
+			kind = amqp.ExchangeDirect
+		}
+
+		err := plan.addExchange(topologyExchangeDeclaration{
+			name:       exchange.Name,
+			kind:       kind,
+			durable:    exchange.Durable,
+			autoDelete: exchange.AutoDelete,
+			internal:   exchange.Internal,
+			args:       toTopologyTable(exchange.Args),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, queue := range topology.Queues {
+		if queue.Name == "" {
+			return nil, errors.New("topology queue name is empty")
+		}
+
+		queueDeclareConfig, retryConfig, err := queue.getConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		args := queueDeclareConfig.Args
+		if deadLetter := queueDeclareConfig.DeadLetter; deadLetter != nil {
+			err = plan.addExchange(topologyExchangeDeclaration{name: deadLetter.Exchange, kind: amqp.ExchangeDirect, durable: queue.Durable})
+			if err != nil {
+				return nil, err
+			}
+
+			err = plan.addQueue(topologyQueueDeclaration{name: deadLetter.Queue, durable: queue.Durable, args: deadLetter.QueueArgs})
+			if err != nil {
+				return nil, err
+			}
+
+			plan.bindings = append(plan.bindings, topologyBindingDeclaration{queue: deadLetter.Queue, routingKey: deadLetter.RoutingKey, exchange: deadLetter.Exchange})
+			args = deadLetter.getQueueArgs(args)
+		}
+
+		if retryConfig != nil {
+			declared := make(map[string]bool)
+			for _, delay := range retryConfig.Schedule() {
+				retryQueueName := getRetryQueueName(queue.Name, delay)
+				if declared[retryQueueName] {
+					continue
+				}
+
+				declared[retryQueueName] = true
+				err = plan.addQueue(topologyQueueDeclaration{name: retryQueueName, durable: queue.Durable, args: getRetryQueueArgs(queue.Name, delay)})
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			err = plan.addQueue(topologyQueueDeclaration{name: retryConfig.ParkingLotQueue, durable: queue.Durable})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		err = plan.addQueue(topologyQueueDeclaration{
+			name:       queue.Name,
+			durable:    queue.Durable,
+			autoDelete: queue.AutoDelete,
+			exclusive:  queue.Exclusive,
+			args:       args,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, binding := range topology.Bindings {
+		if binding.Exchange == "" || binding.Queue == "" {
+			return nil, fmt.Errorf("topology binding [%s] to [%s] need exchange and queue name", binding.Queue, binding.Exchange)
+		}
+
+		plan.bindings = append(plan.bindings, topologyBindingDeclaration{
+			queue:      binding.Queue,
+			routingKey: binding.RoutingKey,
+			exchange:   binding.Exchange,
+			args:       toTopologyTable(binding.Args),
+		})
+	}
+
+	return plan, nil
+}
+
+// topologyChannel implemented by *amqp.Channel
+type topologyChannel interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	ExchangeDeclarePassive(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	Close() error
+}
+
+func getTopologyChannelOpener(connection *amqp.Connection) func() (topologyChannel, error) {
+	return func() (topologyChannel, error) {
+		if connection == nil || connection.IsClosed() {
+			return nil, amqp.ErrClosed
+		}
+
+		channel, err := connection.Channel()
+		if err != nil {
+			return nil, err
+		}
+
+		return channel, nil
+	}
+}
+
+/*
+Declare every exchange, queue and binding, already declared with the same config is not changed.
+declared with different config failed with precondition failed error from broker, use Diff to get every difference.
+existing binding that is not on topology is not removed
+*/
+func (topology *Topology) Declare(connection *amqp.Connection) error {
+	return topology.declare(getTopologyChannelOpener(connection))
+}
+
+func (topology *Topology) declare(openChannel func() (topologyChannel, error)) error {
+	plan, err := topology.getPlan()
+	if err != nil {
+		return err
+	}
+
+	channel, err := openChannel()
+	if err != nil {
+		return err
+	}
+	defer channel.Close()
+
+	for _, exchange := range plan.exchanges {
+		err = channel.ExchangeDeclare(exchange.name, exchange.kind, exchange.durable, exchange.autoDelete, exchange.internal, false, exchange.args)
+		if err != nil {
+			return fmt.Errorf("declare exchange [%s]: %w", exchange.name, err)
+		}
+	}
+
+	for _, queue := range plan.queues {
+		_, err = channel.QueueDeclare(queue.name, queue.durable, queue.autoDelete, queue.exclusive, false, queue.args)
+		if err != nil {
+			return fmt.Errorf("declare queue [%s]: %w", queue.name, err)
+		}
+	}
+
+	for _, binding := range plan.bindings {
+		err = channel.QueueBind(binding.queue, binding.routingKey, binding.exchange, false, binding.args)
+		if err != nil {
+			return fmt.Errorf("bind queue [%s] to exchange [%s]: %w", binding.queue, binding.exchange, err)
+		}
+	}
+
+	return nil
+}
+
+/*
+Diff compare topology with broker without declaring anything, return empty drift if every exchange and queue match.
+binding can't be checked using amqp, so binding is not compared.
+broker close the channel on every drift, so every exchange and queue checked on new channel
+
+	Example
+	drifts, err := topology.Diff(connection)
+	for _, drift := range drifts {
+		fmt.Println(drift.String()) // queue [invoice-paid] mismatch: PRECONDITION_FAILED - inequivalent arg 'x-max-length' ...
+	}
+*/
+func (topology *Topology) Diff(connection *amqp.Connection) ([]TopologyDrift, error) {
+	return topology.diff(getTopologyChannelOpener(connection))
+}
+
+func (topology *Topology) diff(openChannel func() (topologyChannel, error)) ([]TopologyDrift, error) {
+	plan, err := topology.getPlan()
+	if err != nil {
+		return nil, err
+	}
+
+	var drifts []TopologyDrift
+	for _, exchange := range plan.exchanges {
+		drift, err := diffTopologyEntity(openChannel, "exchange", exchange.name,
+			func(channel topologyChannel) error {
+				return channel.ExchangeDeclarePassive(exchange.name, exchange.kind, exchange.durable, exchange.autoDelete, exchange.internal, false, exchange.args)
+			},
+			func(channel topologyChannel) error {
+				return channel.ExchangeDeclare(exchange.name, exchange.kind, exchange.durable, exchange.autoDelete, exchange.internal, false, exchange.args)
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if drift != nil {
+			drifts = append(drifts, *drift)
+		}
+	}
+
+	for _, queue := range plan.queues {
+		drift, err := diffTopologyEntity(openChannel, "queue", queue.name,
+			func(channel topologyChannel) error {
+				_, err := channel.QueueDeclarePassive(queue.name, queue.durable, queue.autoDelete, queue.exclusive, false, queue.args)
+				return err
+			},
+			func(channel topologyChannel) error {
+				_, err := channel.QueueDeclare(queue.name, queue.durable, queue.autoDelete, queue.exclusive, false, queue.args)
+				return err
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if drift != nil {
+			drifts = append(drifts, *drift)
+		}
+	}
+
+	return drifts, nil
+}
+
+// diffTopologyEntity passive declare to check entity exist, then declare with the same config
+// only for existing entity, so nothing is created. declare failed if the config is different
+func diffTopologyEntity(openChannel func() (topologyChannel, error), kind, name string, declarePassive, declare func(channel topologyChannel) error) (*TopologyDrift, error) {
+	channel, err := openChannel()
+	if err != nil {
+		return nil, err
+	}
+	defer channel.Close()
+
+	err = declarePassive(channel)
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.NotFound {
+		return &TopologyDrift{Kind: kind, Name: name, Reason: DriftMissing}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("check %s [%s]: %w", kind, name, err)
+	}
+
+	err = declare(channel)
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.PreconditionFailed {
+		return &TopologyDrift{Kind: kind, Name: name, Reason: DriftMismatch, Detail: amqpErr.Reason}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("check %s [%s]: %w", kind, name, err)
+	}
+
+	return nil, nil
+}
+
+// DeclareTopology declare topology using new channel on queue connection, see Topology.Declare
+func (base *QueueSetup) DeclareTopology(topology *Topology) error {
+	return topology.Declare(base.connection)
+}
+
+// DiffTopology see Topology.Diff
+func (base *QueueSetup) DiffTopology(topology *Topology) ([]TopologyDrift, error) {
+	return topology.Diff(base.connection)
+}
@@ -0,0 +1,314 @@
+package rabbitmq
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type testTopologyEntity struct {
+	kind string
+	args amqp.Table
+}
+
+// testTopologyBroker keep declared entity, declare with different kind or args failed with precondition failed
+type testTopologyBroker struct {
+	exchanges map[string]testTopologyEntity
+	queues    map[string]testTopologyEntity
+	bindings  []string
+}
+
+type testTopologyChannel struct {
+	broker *testTopologyBroker
+}
+
+func newTestTopologyBroker() *testTopologyBroker {
+	return &testTopologyBroker{
+		exchanges: make(map[string]testTopologyEntity),
+		queues:    make(map[string]testTopologyEntity),
+	}
+}
+
+func (broker *testTopologyBroker) openChannel() (topologyChannel, error) {
+	return &testTopologyChannel{broker: broker}, nil
+}
+
+func declareTestTopologyEntity(entities map[string]testTopologyEntity, name string, entity testTopologyEntity, passive bool) error {
+	existing, ok := entities[name]
+	if !ok && passive {
+		return &amqp.Error{Code: amqp.NotFound, Reason: "NOT_FOUND - no entity '" + name + "'"}
+	}
+
+	if !ok {
+		entities[name] = entity
+		return nil
+	}
+
+	if !passive && (existing.kind != entity.kind || !reflect.DeepEqual(existing.args, entity.args)) {
+		return &amqp.Error{Code: amqp.PreconditionFailed, Reason: "PRECONDITION_FAILED - inequivalent arg for '" + name + "'"}
+	}
+
+	return nil
+}
+
+func (channel *testTopologyChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	return declareTestTopologyEntity(channel.broker.exchanges, name, testTopologyEntity{kind: kind, args: args}, false)
+}
+
+func (channel *testTopologyChannel) ExchangeDeclarePassive(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	return declareTestTopologyEntity(channel.broker.exchanges, name, testTopologyEntity{kind: kind, args: args}, true)
+}
+
+func (channel *testTopologyChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	return amqp.Queue{Name: name}, declareTestTopologyEntity(channel.broker.queues, name, testTopologyEntity{args: args}, false)
+}
+
+func (channel *testTopologyChannel) QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	return amqp.Queue{Name: name}, declareTestTopologyEntity(channel.broker.queues, name, testTopologyEntity{args: args}, true)
+}
+
+func (channel *testTopologyChannel) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	channel.broker.bindings = append(channel.broker.bindings, exchange+"->"+name+":"+key)
+	return nil
+}
+
+func (channel *testTopologyChannel) Close() error {
+	return nil
+}
+
+const testTopologyJSON = `{
+	"exchanges": [
+		{"name": "orders", "kind": "topic", "durable": true}
+	],
+	"queues": [
+		{
+			"name": "invoice-paid",
+			"durable": true,
+			"args": {"x-max-length": 10000},
+			"dead_letter": {"exchange": "orders.dlx"},
+			"retry": {"max_attempts": 3, "delays": ["1s", "5s"]}
+		},
+		{
+			"name": "order-created",
+			"durable": true,
+			"dead_letter": {"exchange": "orders.dlx"}
+		}
+	],
+	"bindings": [
+		{"exchange": "orders", "queue": "invoice-paid", "routing_key": "invoice.paid"}
+	]
+}`
+
+func TestLoadTopology(t *testing.T) {
+	topology, err := LoadTopology([]byte(testTopologyJSON), nil)
+	if err != nil {
+		t.Fail()
+		t.Log(err.Error())
+		return
+	}
+
+	queueDeclareConfig, retryConfig, err := topology.QueueConfig("invoice-paid")
+	if err != nil {
+		t.Fail()
+		t.Log(err.Error())
+		return
+	}
+
+	if maxLength, ok := queueDeclareConfig.Args["x-max-length"].(int64); !ok || maxLength != 10000 {
+		t.Fail()
+		t.Logf("expected x-max-length as int64, got %#v", queueDeclareConfig.Args["x-max-length"])
+		return
+	}
+
+	if queueDeclareConfig.DeadLetter.Queue != "invoice-paid.dlq" || retryConfig.ParkingLotQueue != "invoice-paid.parking-lot" {
+		t.Fail()
+		t.Logf("expected default dead letter and parking lot queue, got [%s] and [%s]", queueDeclareConfig.DeadLetter.Queue, retryConfig.ParkingLotQueue)
+		return
+	}
+
+	expectedSchedule := []time.Duration{time.Second, 5 * time.Second, 5 * time.Second}
+	if !reflect.DeepEqual(retryConfig.Schedule(), expectedSchedule) {
+		t.Fail()
+		t.Logf("expected retry schedule %v, got %v", expectedSchedule, retryConfig.Schedule())
+		return
+	}
+
+	invalidTopologies := []string{
+		`{"queues": [{"name": "invoice-paid", "unknown": true}]}`,
+		`{"queues": [{"name": ""}]}`,
+		`{"queues": [{"name": "invoice-paid", "retry": {"delays": ["soon"]}}]}`,
+		`{"bindings": [{"queue": "invoice-paid"}]}`,
+		`{"queues": [{"name": "invoice-paid"}, {"name": "invoice-paid", "durable": true}]}`,
+	}
+
+	for _, invalidTopology := range invalidTopologies {
+		if _, err := LoadTopology([]byte(invalidTopology), nil); err == nil {
+			t.Fail()
+			t.Logf("expected error load topology %s", invalidTopology)
+			return
+		}
+	}
+
+	t.Log("success load topology")
+	return
+}
+
+// unmarshalTestYAML decode the same as yaml package, number as int and nested map as map[interface{}]interface{} (yaml v2)
+func unmarshalTestYAML(data []byte, value interface{}) error {
+	topology := value.(*Topology)
+	topology.Queues = []TopologyQueue{
+		{
+			Name:    "invoice-paid",
+			Durable: true,
+			Args: map[string]interface{}{
+				"x-max-length": 10000,
+				"x-queue-type": "quorum",
+				"x-nested":     map[interface{}]interface{}{"nested": 5, "ratio": 0.5},
+				"x-list":       []interface{}{1, map[interface{}]interface{}{"key": 2}},
+			},
+			DeadLetter: &TopologyDeadLetter{QueueArgs: map[string]interface{}{"x-message-ttl": 604800000}},
+		},
+	}
+
+	return nil
+}
+
+func TestLoadTopologyYAML(t *testing.T) {
+	topology, err := LoadTopology([]byte("queues: [...]"), unmarshalTestYAML)
+	if err != nil {
+		t.Fail()
+		t.Log(err.Error())
+		return
+	}
+
+	queueDeclareConfig, _, err := topology.QueueConfig("invoice-paid")
+	if err != nil {
+		t.Fail()
+		t.Log(err.Error())
+		return
+	}
+
+	expectedArgs := amqp.Table{
+		"x-max-length": int64(10000),
+		"x-queue-type": "quorum",
+		"x-nested":     amqp.Table{"nested": int64(5), "ratio": 0.5},
+		"x-list":       []interface{}{int64(1), amqp.Table{"key": int64(2)}},
+	}
+
+	if !reflect.DeepEqual(queueDeclareConfig.Args, expectedArgs) {
+		t.Fail()
+		t.Logf("expected yaml args converted to amqp table, got %#v", queueDeclareConfig.Args)
+		return
+	}
+
+	if ttl := queueDeclareConfig.DeadLetter.QueueArgs["x-message-ttl"]; ttl != int64(604800000) {
+		t.Fail()
+		t.Logf("expected dead letter ttl as int64, got %#v", ttl)
+		return
+	}
+
+	if err := (amqp.Table)(queueDeclareConfig.Args).Validate(); err != nil {
+		t.Fail()
+		t.Logf("expected valid amqp table, got %v", err)
+		return
+	}
+
+	path := filepath.Join(t.TempDir(), "topology.yaml")
+	_ = os.WriteFile(path, []byte("queues: [...]"), 0644)
+	if _, err := LoadTopologyFile(path, nil); err == nil {
+		t.Fail()
+		t.Log("expected error load yaml file without unmarshal")
+		return
+	}
+
+	if _, err := LoadTopologyFile(path, unmarshalTestYAML); err != nil {
+		t.Fail()
+		t.Log(err.Error())
+		return
+	}
+
+	t.Log("success load yaml topology")
+	return
+}
+
+func TestTopologyDeclareAndDiff(t *testing.T) {
+	topology, err := LoadTopology([]byte(testTopologyJSON), nil)
+	if err != nil {
+		t.Fail()
+		t.Log(err.Error())
+		return
+	}
+
+	broker := newTestTopologyBroker()
+	drifts, err := topology.diff(broker.openChannel)
+	if err != nil || len(drifts) != 9 { // 2 exchanges, 2 dead letter queues, 2 retry queues, parking lot and 2 queues
+		t.Fail()
+		t.Logf("expected every entity missing, got %v (%v)", drifts, err)
+		return
+	}
+
+	if len(broker.exchanges) != 0 || len(broker.queues) != 0 {
+		t.Fail()
+		t.Log("diff should not declare anything")
+		return
+	}
+
+	// declared twice, already declared entity is not changed
+	for idx := 0; idx < 2; idx++ {
+		if err := topology.declare(broker.openChannel); err != nil {
+			t.Fail()
+			t.Log(err.Error())
+			return
+		}
+	}
+
+	retryQueue, ok := broker.queues["invoice-paid.retry.5000ms"]
+	if !ok || retryQueue.args["x-dead-letter-routing-key"] != "invoice-paid" {
+		t.Fail()
+		t.Logf("expected retry queue declared, got %v", broker.queues)
+		return
+	}
+
+	if broker.queues["invoice-paid"].args["x-dead-letter-exchange"] != "orders.dlx" {
+		t.Fail()
+		t.Logf("expected dead letter exchange on queue args, got %v", broker.queues["invoice-paid"].args)
+		return
+	}
+
+	drifts, err = topology.diff(broker.openChannel)
+	if err != nil || len(drifts) != 0 {
+		t.Fail()
+		t.Logf("expected no drift after declare, got %v (%v)", drifts, err)
+		return
+	}
+
+	broker.queues["order-created"] = testTopologyEntity{args: amqp.Table{"x-max-length": int64(5)}}
+	delete(broker.exchanges, "orders")
+
+	drifts, err = topology.diff(broker.openChannel)
+	if err != nil || len(drifts) != 2 {
+		t.Fail()
+		t.Logf("expected 2 drift, got %v (%v)", drifts, err)
+		return
+	}
+
+	if drifts[0].Kind != "exchange" || drifts[0].Name != "orders" || drifts[0].Reason != DriftMissing {
+		t.Fail()
+		t.Logf("expected missing exchange, got %s", drifts[0].String())
+		return
+	}
+
+	if drifts[1].Name != "order-created" || drifts[1].Reason != DriftMismatch || !strings.Contains(drifts[1].Detail, "PRECONDITION_FAILED") {
+		t.Fail()
+		t.Logf("expected mismatch queue, got %s", drifts[1].String())
+		return
+	}
+
+	t.Log("success declare topology and report drift")
+	return
+}
@@ -0,0 +1,167 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Envelope same message format as ConsumerHandlerData, with typed data
+type Envelope[T any] struct {
+	EventType           string `json:"event_type"`
+	Date                string `json:"date"`
+	Data                T      `json:"data"`
+	CurrentExchangeName string `json:"current_exchange_name"`
+	TotalReHit          int64  `json:"total_re_hit"`
+}
+
+/*
+Publisher publish typed data wrapped on Envelope, queue need to be set up using AddPublisher
+
+	Example
+	type OrderCreated struct {
+		OrderID string  `json:"order_id"`
+		Amount  float64 `json:"amount"`
+	}
+
+	queue := NewBaseQueue("", "order-created").AddPublisher(nil, nil)
+	publisher := NewPublisher[OrderCreated](queue, "order-created", nil)
+	err := publisher.Publish(ctx, OrderCreated{OrderID: "order-1", Amount: 150000})
+*/
+type Publisher[T any] struct {
+	queue     *QueueSetup
+	eventType string
+	codec     Codec
+}
+
+// NewPublisher nil codec use JSON
+func NewPublisher[T any](queue *QueueSetup, eventType string, codec Codec) *Publisher[T] {
+	if codec == nil {
+		codec = NewJSONCodec()
+	}
+
+	return &Publisher[T]{
+		queue:     queue,
+		eventType: eventType,
+		codec:     codec,
+	}
+}
+
+func (publisher *Publisher[T]) Publish(ctx context.Context, data T) error {
+	return publisher.PublishWithOptions(ctx, data, nil)
+}
+
+// PublishWithOptions see QueueSetup.PublishWithOptions
+func (publisher *Publisher[T]) PublishWithOptions(ctx context.Context, data T, options *PublishOptions) error {
+	results := publisher.publishBatch(ctx, []T{data}, options)
+	return results[0].Err
+}
+
+func (publisher *Publisher[T]) PublishBatch(ctx context.Context, listData []T) []PublishResult {
+	return publisher.publishBatch(ctx, listData, nil)
+}
+
+func (publisher *Publisher[T]) publishBatch(ctx context.Context, listData []T, options *PublishOptions) []PublishResult {
+	results := make([]PublishResult, len(listData))
+
+	var msgs []amqp.Publishing
+	var msgIndexes []int
+	for idx, data := range listData {
+		msg, err := publisher.newPublishing(data)
+		if err != nil {
+			results[idx] = PublishResult{Index: idx, Err: err}
+			continue
+		}
+
+		options.apply(&msg)
+		msgs = append(msgs, msg)
+		msgIndexes = append(msgIndexes, idx)
+	}
+
+	if len(msgs) == 0 {
+		return results
+	}
+
+	queue := publisher.queue
+	queue.logMessage(queue.getLogger(), "Publishing typed message", slog.String("event_type", publisher.eventType), slog.Int("total", len(msgs)))
+	for _, result := range publisher.queue.publishMessages(ctx, options.getRoutingKey(publisher.queue.queueName), msgs) {
+		result.Index = msgIndexes[result.Index]
+		results[result.Index] = result
+	}
+
+	return results
+}
+
+func (publisher *Publisher[T]) newPublishing(data T) (amqp.Publishing, error) {
+	body, err := publisher.codec.Encode(Envelope[T]{
+		EventType:           publisher.eventType,
+		Date:                time.Now().UTC().Format(time.RFC3339Nano),
+		Data:                data,
+		CurrentExchangeName: publisher.queue.exchangeName,
+	})
+	if err != nil {
+		return amqp.Publishing{}, fmt.Errorf("encode message: %w", err)
+	}
+
+	msg := publisher.queue.newPublishing(body)
+	msg.ContentType = publisher.codec.ContentType()
+	msg.Type = publisher.eventType
+	return msg, nil
+}
+
+// TypedHandler returned error have the same behaviour as MessageHandler
+type TypedHandler[T any] func(ctx context.Context, event Envelope[T]) error
+
+/*
+Consumer decode message to Envelope before calling handler, message that can't be decoded is dead-lettered,
+configure DeadLetter on QueueDeclareConfig to keep it, otherwise it's discarded by broker
+
+	Example
+	queue := NewBaseQueue("", "order-created").
+		SetupQueue(&QueueDeclareConfig{Durable: true, DeadLetter: &DeadLetterConfig{}}, nil).
+		AddConsumer(false)
+
+	consumer := NewConsumer[OrderCreated](queue, nil)
+	consumer.Consume(func(ctx context.Context, event Envelope[OrderCreated]) error {
+		return createInvoice(event.Data.OrderID, event.Data.Amount)
+	})
+*/
+type Consumer[T any] struct {
+	queue *QueueSetup
+	codec Codec
+}
+
+// NewConsumer nil codec use JSON
+func NewConsumer[T any](queue *QueueSetup, codec Codec) *Consumer[T] {
+	if codec == nil {
+		codec = NewJSONCodec()
+	}
+
+	return &Consumer[T]{
+		queue: queue,
+		codec: codec,
+	}
+}
+
+func (consumer *Consumer[T]) Consume(handler TypedHandler[T]) {
+	consumer.queue.consume(consumer.newDeliveryHandler(handler))
+}
+
+func (consumer *Consumer[T]) newDeliveryHandler(handler TypedHandler[T]) DeliveryHandler {
+	return func(ctx context.Context, delivery amqp.Delivery) error {
+		if delivery.ContentType != "" && delivery.ContentType != consumer.codec.ContentType() {
+			return DeadLetter(fmt.Errorf("unsupported content type [%s], expected [%s]", delivery.ContentType, consumer.codec.ContentType()))
+		}
+
+		var event Envelope[T]
+		err := consumer.codec.Decode(delivery.Body, &event)
+		if err != nil {
+			return DeadLetter(fmt.Errorf("decode message: %w", err))
+		}
+
+		return handler(ctx, event)
+	}
+}
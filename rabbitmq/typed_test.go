@@ -0,0 +1,90 @@
+package rabbitmq
+
+import (
+	"context"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+type testOrderCreated struct {
+	OrderID string  `json:"order_id"`
+	Amount  float64 `json:"amount"`
+}
+
+func TestTypedPublisherConsumer(t *testing.T) {
+	queueSetup := &QueueSetup{
+		queueName:   "order-created",
+		queueConfig: &QueueConfig{QueuePublisherConfig: &PublisherConfig{}},
+	}
+
+	for _, codec := range []Codec{NewJSONCodec(), NewGobCodec()} {
+		publisher := NewPublisher[testOrderCreated](queueSetup, "order-created", codec)
+		msg, err := publisher.newPublishing(testOrderCreated{OrderID: "order-1", Amount: 150000})
+		if err != nil {
+			t.Fail()
+			t.Log(err.Error())
+			return
+		}
+
+		var received Envelope[testOrderCreated]
+		consumer := NewConsumer[testOrderCreated](queueSetup, codec)
+		handler := consumer.newDeliveryHandler(func(ctx context.Context, event Envelope[testOrderCreated]) error {
+			received = event
+			return nil
+		})
+
+		acknowledger := &testAcknowledger{}
+		queueSetup.handleDelivery(handler, amqp.Delivery{
+			Acknowledger: acknowledger,
+			DeliveryTag:  1,
+			ContentType:  msg.ContentType,
+			Body:         msg.Body,
+		}, false)
+
+		if received.EventType != "order-created" || received.Data.OrderID != "order-1" || received.Data.Amount != 150000 {
+			t.Fail()
+			t.Logf("unexpected received message using [%s] %+v", codec.ContentType(), received)
+			return
+		}
+
+		if len(acknowledger.acked) != 1 {
+			t.Fail()
+			t.Logf("expected message acked using [%s]", codec.ContentType())
+			return
+		}
+	}
+
+	t.Log("success publish and consume typed message")
+	return
+}
+
+func TestTypedConsumerDecodeError(t *testing.T) {
+	queueSetup := &QueueSetup{queueName: "order-created"}
+
+	var isCalled bool
+	consumer := NewConsumer[testOrderCreated](queueSetup, nil)
+	handler := consumer.newDeliveryHandler(func(ctx context.Context, event Envelope[testOrderCreated]) error {
+		isCalled = true
+		return nil
+	})
+
+	acknowledger := &testAcknowledger{}
+	queueSetup.handleDelivery(handler, amqp.Delivery{Acknowledger: acknowledger, DeliveryTag: 1, Body: []byte(`{"data": "invalid"}`)}, false)
+	queueSetup.handleDelivery(handler, amqp.Delivery{Acknowledger: acknowledger, DeliveryTag: 2, ContentType: ContentTypeGob, Body: []byte(`{}`)}, false)
+
+	if isCalled {
+		t.Fail()
+		t.Log("handler should not be called for message that can't be decoded")
+		return
+	}
+
+	if len(acknowledger.rejected) != 2 {
+		t.Fail()
+		t.Logf("expected message dead-lettered, got %v", acknowledger.rejected)
+		return
+	}
+
+	t.Log("success dead-letter message that can't be decoded")
+	return
+}